@@ -8,6 +8,9 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,7 +18,11 @@ import (
 	"github.com/maansaake/arbiter/pkg/module"
 	"github.com/maansaake/arbiter/pkg/report"
 	"github.com/maansaake/arbiter/pkg/report/collection"
+	eventreport "github.com/maansaake/arbiter/pkg/report/event"
 	interactivereport "github.com/maansaake/arbiter/pkg/report/interactive"
+	junitreport "github.com/maansaake/arbiter/pkg/report/junit"
+	progressreport "github.com/maansaake/arbiter/pkg/report/progress"
+	"github.com/maansaake/arbiter/pkg/report/stats"
 	yamlreport "github.com/maansaake/arbiter/pkg/report/yaml"
 	"github.com/maansaake/arbiter/pkg/subcommand/cli"
 	"github.com/maansaake/arbiter/pkg/subcommand/file"
@@ -36,8 +43,43 @@ type (
 		duration time.Duration
 		// reportPath is the file path to write the report to.
 		reportPath string
+		// reportFormat is the format of the final report, yaml or junit.
+		reportFormat string
+		// thresholds decide if an operation passed, used by report formats with a pass/fail outcome.
+		thresholds report.Thresholds
 		// interactive is set when an interactive TUI reporting is used.
 		interactive bool
+		// progress is the interval of plain text progress summaries, disabled if 0.
+		progress time.Duration
+		// eventsPath is the file path to stream raw invocation events to, disabled if empty.
+		eventsPath string
+		// eventsFormat is the encoding of the event stream, ndjson or csv.
+		eventsFormat string
+		// eventsGzip is set when the event stream should be gzip compressed.
+		eventsGzip bool
+		// eventsSample is the fraction of invocations recorded in the event stream.
+		eventsSample float64
+		// workerLimit is the maximum number of concurrent workers per workload.
+		workerLimit int
+		// maxInFlight is the maximum number of concurrent invocations across all
+		// workloads, unlimited if 0.
+		maxInFlight int
+		// iterations is the total number of invocations, and iterationsPerOp the
+		// number of invocations per operation, unlimited if 0.
+		iterations      uint
+		iterationsPerOp uint
+		// abort are the conditions under which the traffic of a failing operation
+		// is aborted, with the action parsed from abortAction.
+		abort       traffic.AbortConditions
+		abortAction string
+		// readyTimeout bounds the wait for each module implementing
+		// module.Readier to become ready, and stopTimeout the stop of each module.
+		readyTimeout time.Duration
+		stopTimeout  time.Duration
+		// label is a name of the run recorded in the report.
+		label string
+		// tags are key-value pairs describing the run, recorded in the report.
+		tags map[string]string
 		// logger is used for info-level logging.
 		logger logr.Logger
 		// errorLogger is the logger used for error logs by the reporter.
@@ -58,7 +100,14 @@ const (
 	defaultErrorLogPath = "error.log"
 	defaultDuration     = time.Minute * 5
 	defaultReportPath   = "report.yaml"
+	defaultJUnitPath    = "report.xml"
+	reportFormatYAML    = "yaml"
+	reportFormatJUnit   = "junit"
 	defaultInteractive  = false
+	defaultEventsFormat = string(eventreport.FormatNDJSON)
+	defaultEventsSample = 1.0
+	defaultReadyTimeout = time.Minute
+	defaultStopTimeout  = 30 * time.Second
 )
 
 // defaultOpts sets zero-value fields to their defaults.
@@ -81,6 +130,12 @@ var (
 	// It is used to wrap any errors from traffic or module stopping to allow
 	// callers to check for this specific case.
 	ErrStopping = errors.New("error stopping traffic or modules")
+	// ErrReportExtension is returned when a report is exported from the TUI to
+	// a path without the extension of a report format.
+	ErrReportExtension = errors.New("unknown report extension")
+	// ErrStopTimeout is returned when a module does not stop within the stop
+	// timeout.
+	ErrStopTimeout = errors.New("module stop timed out")
 
 	//nolint:gochecknoglobals // package-level since env-var
 	logVerbosity = envparser.Register(&envparser.Opts[int]{
@@ -93,7 +148,7 @@ var (
 	workerLimit = envparser.Register(&envparser.Opts[int]{
 		Name:  "ABTR_WORKER_LIMIT",
 		Desc:  "Set the maximum number of concurrent workers per workload. Default is 10.",
-		Value: 10, //nolint:mnd // default value
+		Value: defaultWorkerLimit,
 	})
 )
 
@@ -130,12 +185,18 @@ func Run(modules module.Modules, opts *Opts) error {
 	}
 
 	abtr := &abtr{
-		opts:        opts,
-		duration:    defaultDuration,
-		reportPath:  defaultReportPath,
-		interactive: defaultInteractive,
-		logger:      infoLogger,
-		errorLogger: errorLogger,
+		opts:         opts,
+		duration:     defaultDuration,
+		reportPath:   defaultReportPath,
+		reportFormat: reportFormatYAML,
+		interactive:  defaultInteractive,
+		eventsFormat: defaultEventsFormat,
+		eventsSample: defaultEventsSample,
+		workerLimit:  workerLimit.Value(),
+		readyTimeout: defaultReadyTimeout,
+		stopTimeout:  defaultStopTimeout,
+		logger:       infoLogger,
+		errorLogger:  errorLogger,
 	}
 
 	cliCmd, fileCmd, err := abtr.buildRunnerCmds(modules)
@@ -147,8 +208,9 @@ func Run(modules module.Modules, opts *Opts) error {
 		cliCmd,
 		fileCmd,
 		&cobra.Command{
-			Use:   gen.FlagsetName,
-			Short: "Generate a test model file.",
+			Use:   gen.FlagsetName + " [path]",
+			Short: "Generate a test model file, written to stdout if no path is given.",
+			Args:  cobra.MaximumNArgs(1),
 			RunE: func(_ *cobra.Command, args []string) error {
 				return gen.Generate(args, modules)
 			},
@@ -173,7 +235,7 @@ func (a *abtr) buildRunnerCmds(modules module.Modules) (*cobra.Command, *cobra.C
 	}
 	cliCmd.Flags().AddFlagSet(runnerFlagSet)
 
-	runnerPreRunE := func(_ *cobra.Command, _ []string) error {
+	runnerPreRunE := func(cmd *cobra.Command, _ []string) error {
 		if a.duration < 1*time.Second {
 			return errors.New("duration must be at least 1 second")
 		}
@@ -182,29 +244,54 @@ func (a *abtr) buildRunnerCmds(modules module.Modules) (*cobra.Command, *cobra.C
 			return errors.New("report path cannot be empty")
 		}
 
+		if a.maxInFlight < 0 {
+			return errors.New("max in-flight cannot be negative")
+		}
+
+		if a.readyTimeout <= 0 {
+			return errors.New("ready timeout must be positive")
+		}
+		if a.stopTimeout <= 0 {
+			return errors.New("stop timeout must be positive")
+		}
+
+		action, err := traffic.ParseAbortAction(a.abortAction) //nolint:govet // shad
+		if err != nil {
+			return err
+		}
+		a.abort.Action = action
+		if err = validateAbort(&a.abort); err != nil {
+			return err
+		}
+
+		if a.progress < 0 {
+			return errors.New("progress interval cannot be negative")
+		}
+		if a.progress > 0 && a.interactive {
+			return errors.New("progress cannot be combined with interactive mode")
+		}
+
+		if err = a.validateReport(cmd.Flags().Changed("report-path")); err != nil {
+			return err
+		}
+
 		// err is fine since the file does not have to exist prior to the test ending.
-		stat, err := os.Stat(a.reportPath) //nolint:govet // shad
+		stat, err := os.Stat(a.reportPath)
 		if err == nil && stat.IsDir() {
 			return errors.New("report path cannot be a directory")
 		}
 
-		return nil
+		return a.validateEventFlags()
 	}
 	cliCmd.PreRunE = runnerPreRunE
 
-	fileCmd := &cobra.Command{
-		Use:     file.FlagsetName,
-		Short:   "Run from a test model file.",
-		PreRunE: runnerPreRunE,
-		RunE: func(_ *cobra.Command, args []string) error {
-			meta, err := file.Parse(args, modules) //nolint:govet // shad
-			if err != nil {
-				return err
-			}
-
-			return a.run(meta)
-		},
+	fileCmd, err := file.NewCommand(modules, func(m module.Metadata) error {
+		return a.run(m)
+	})
+	if err != nil {
+		return nil, nil, err
 	}
+	fileCmd.PreRunE = runnerPreRunE
 	fileCmd.Flags().AddFlagSet(runnerFlagSet)
 
 	return cliCmd, fileCmd, nil
@@ -225,7 +312,106 @@ func (a *abtr) buildRunnerFlagSet() *pflag.FlagSet {
 		"report-path",
 		"r",
 		defaultReportPath,
-		"Path to the final report.",
+		"Path to the final report, report.xml by default with the junit format.",
+	)
+	runnerFlagSet.StringVar(
+		&a.reportFormat,
+		"report-format",
+		reportFormatYAML,
+		"Format of the final report, yaml or junit.",
+	)
+	runnerFlagSet.IntVar(
+		&a.maxInFlight,
+		"max-in-flight",
+		0,
+		"Maximum number of concurrent invocations across all operations, unlimited if 0.",
+	)
+	runnerFlagSet.UintVar(
+		&a.iterations,
+		"iterations",
+		0,
+		"Total number of invocations across all operations, after which the test ends early. Unlimited if 0.",
+	)
+	runnerFlagSet.UintVar(
+		&a.iterationsPerOp,
+		"iterations-per-op",
+		0,
+		"Number of invocations of each operation without its own iterations flag, after which the test ends early. "+
+			"Unlimited if 0.",
+	)
+	runnerFlagSet.DurationVar(
+		&a.readyTimeout,
+		"ready-timeout",
+		defaultReadyTimeout,
+		"Maximum time to wait for each module with a readiness check to become ready before traffic starts.",
+	)
+	runnerFlagSet.DurationVar(
+		&a.stopTimeout,
+		"stop-timeout",
+		defaultStopTimeout,
+		"Maximum time to wait for each module to stop.",
+	)
+	runnerFlagSet.StringVar(
+		&a.label,
+		"label",
+		"",
+		"A name of the run, recorded in the report.",
+	)
+	runnerFlagSet.StringToStringVar(
+		&a.tags,
+		"tag",
+		nil,
+		"Key-value pairs describing the run, recorded in the report, e.g. env=staging,build=42.",
+	)
+	runnerFlagSet.Float64Var(
+		&a.thresholds.MaxErrorRate,
+		"threshold-error-rate",
+		0,
+		"Maximum fraction of failed invocations per operation, e.g. 0.05 for 5%.",
+	)
+	runnerFlagSet.DurationVar(
+		&a.thresholds.MaxAverageLatency,
+		"threshold-avg-latency",
+		0,
+		"Maximum average latency per operation.",
+	)
+	runnerFlagSet.DurationVar(
+		&a.thresholds.MaxLatency,
+		"threshold-max-latency",
+		0,
+		"Maximum latency of any invocation of an operation.",
+	)
+	runnerFlagSet.Float64Var(
+		&a.abort.MaxErrorRate,
+		"abort-error-rate",
+		0,
+		"Fraction of failed invocations of an operation within the abort window, e.g. 0.5 for 50%, "+
+			"that triggers the abort action. Disabled if 0.",
+	)
+	runnerFlagSet.DurationVar(
+		&a.abort.Window,
+		"abort-window",
+		traffic.DefaultAbortWindow,
+		"Sliding window the abort error rate is measured over.",
+	)
+	runnerFlagSet.UintVar(
+		&a.abort.MinCalls,
+		"abort-min-calls",
+		traffic.DefaultAbortMinCalls,
+		"Number of invocations within the abort window required before the abort error rate is checked.",
+	)
+	runnerFlagSet.UintVar(
+		&a.abort.ConsecutiveFailures,
+		"abort-consecutive-failures",
+		0,
+		"Number of failed invocations of an operation in a row that triggers the abort action. Disabled if 0.",
+	)
+	runnerFlagSet.StringVar(
+		&a.abortAction,
+		"abort-action",
+		string(traffic.AbortStop),
+		"Action taken when an abort condition triggers: stop the test, disable the operation, "+
+			"or backoff to halve its rate.",
 	)
 	runnerFlagSet.BoolVarP(
 		&a.interactive,
@@ -234,134 +420,405 @@ func (a *abtr) buildRunnerFlagSet() *pflag.FlagSet {
 		defaultInteractive,
 		"Start in interactive TUI mode with per-operation statistics in real time.",
 	)
+	runnerFlagSet.DurationVar(
+		&a.progress,
+		"progress",
+		0,
+		"Interval of plain text progress summaries printed to stdout, for CI logs. Disabled if 0.",
+	)
+	runnerFlagSet.StringVar(
+		&a.eventsPath,
+		"events-path",
+		"",
+		"Path to stream a record of every operation invocation to. Disabled if empty.",
+	)
+	runnerFlagSet.StringVar(
+		&a.eventsFormat,
+		"events-format",
+		defaultEventsFormat,
+		"Format of the event stream, ndjson or csv.",
+	)
+	runnerFlagSet.BoolVar(
+		&a.eventsGzip,
+		"events-gzip",
+		false,
+		"Compress the event stream with gzip.",
+	)
+	runnerFlagSet.Float64Var(
+		&a.eventsSample,
+		"events-sample",
+		defaultEventsSample,
+		"Fraction of invocations to record in the event stream, in the range (0, 1].",
+	)
 	return runnerFlagSet
 }
 
-func (a *abtr) run(metadata module.Metadata) error {
-	a.logger.Info("Starting modules")
+// validateEventFlags verifies the event stream flags, if an event stream path is set.
+func (a *abtr) validateEventFlags() error {
+	if a.eventsPath == "" {
+		return nil
+	}
 
-	if err := a.startModules(metadata); err != nil {
-		a.logger.Error(err, "Start failure")
+	if _, err := eventreport.ParseFormat(a.eventsFormat); err != nil {
 		return err
 	}
-	a.logger.Info("All modules started")
 
+	if a.eventsSample <= 0 || a.eventsSample > 1 {
+		return errors.New("events sample must be in the range (0, 1]")
+	}
+
+	stat, err := os.Stat(a.eventsPath)
+	if err == nil && stat.IsDir() {
+		return errors.New("events path cannot be a directory")
+	}
+
+	return nil
+}
+
+// run the test with the CLI reporters until SIGINT, SIGTERM or until the test
+// duration runs out.
+func (a *abtr) run(metadata module.Metadata) error {
 	// Start signal interceptor for SIGINT and SIGTERM
 	signalCtx, signalCancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer signalCancel()
 
-	reporter := a.setupReporter(
-		metadata,
+	runMetadata := a.runMetadata(metadata)
+	// The scheduler is created up front so the TUI can control traffic.
+	sched := a.newScheduler()
+	reporter, collector := a.setupReporter(
+		metadata, runMetadata, sched,
 		signalCtx, signalCancel,
 	)
 
-	// Traffic context with a timeout of the test's >>> duration <<<
-	timeoutCtx, timeoutCancel := context.WithTimeout(signalCtx, a.duration)
-	defer timeoutCancel()
-	a.logger.Info("Traffic will run for: " + a.duration.String())
+	_, err := a.execute(signalCtx, signalCancel, metadata, runMetadata, sched, reporter, collector)
+	return err
+}
 
-	// The reporter runs in its own context to allow reporting to finalize separately from traffic and module
-	// shutdown.
-	reporterCtx, reporterCancel := context.WithCancel(context.Background())
-	defer reporterCancel()
-	reporter.Start(reporterCtx)
+// runMetadata records the configuration of the run.
+func (a *abtr) runMetadata(metadata module.Metadata) *report.RunMetadata {
+	m := report.NewRunMetadata(metadata, a.duration, a.workerLimit)
+	m.MaxInFlight = a.maxInFlight
+	m.Iterations = a.iterations
+	m.IterationsPerOp = a.iterationsPerOp
+	if !a.abort.IsZero() {
+		abort := a.abort.WithDefaults()
+		m.Abort = &report.AbortConfig{
+			MaxErrorRate:        abort.MaxErrorRate,
+			Window:              abort.Window,
+			MinCalls:            abort.MinCalls,
+			ConsecutiveFailures: abort.ConsecutiveFailures,
+			Action:              string(abort.Action),
+		}
+	}
+	m.Label = a.label
+	m.Tags = a.tags
 
-	sched := traffic.New(&traffic.Opts{
-		Logger:      a.logger,
-		WorkerLimit: workerLimit.Value(),
-	})
+	return m
+}
 
-	// Run traffic.
-	if err := sched.Run(timeoutCtx, metadata, reporter); err != nil {
-		reporter.ReportError(err) // Report is done in case of early traffic failure, to highlight issues in the TUI.
-		a.logger.Error(err, "Failed to start traffic")
-		return err
+// startModules starts the input modules in order, those implementing
+// module.ContextRunner with ctx. If a module fails to start, the modules already
+// started are stopped in reverse order, and their errors are joined to the
+// start error.
+func (a *abtr) startModules(ctx context.Context, meta []*module.Meta) error {
+	for i, m := range meta {
+		a.logger.Info("Starting", "module", m.Name())
+
+		var err error
+		if runner, ok := m.Module.(module.ContextRunner); ok {
+			err = runner.RunContext(ctx)
+		} else {
+			err = m.Run()
+		}
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to start module %s: %w", m.Name(), err), a.stopModules(ctx, meta[:i]))
+		}
+	}
+
+	return nil
+}
+
+// stopModules stops the modules in the reverse order of starting them, and
+// joins their errors.
+func (a *abtr) stopModules(ctx context.Context, meta []*module.Meta) error {
+	var err error
+	for _, m := range slices.Backward(meta) {
+		a.logger.Info("Stopping", "module", m.Name())
+		if stopErr := a.stopModule(ctx, m); stopErr != nil {
+			a.logger.Error(stopErr, "Module stop reported an error", "module", m.Name())
+			err = errors.Join(err, fmt.Errorf("module %s stop: %w", m.Name(), stopErr))
+		}
 	}
 
-	a.logger.Info("Awaiting completion (SIGINT/SIGTERM or duration timeout)")
+	return err
+}
+
+// stopModule stops a module within the stop timeout. A module implementing
+// module.ContextStopper is given ctx with the timeout, the Stop of any other
+// module is abandoned when it runs out.
+func (a *abtr) stopModule(ctx context.Context, m *module.Meta) error {
+	ctx, cancel := context.WithTimeout(ctx, a.stopTimeout)
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() {
+		if stopper, ok := m.Module.(module.ContextStopper); ok {
+			stopped <- stopper.StopContext(ctx)
+			return
+		}
+		stopped <- m.Stop()
+	}()
+
 	select {
-	case <-signalCtx.Done():
-		a.logger.Info("Got stop signal")
-		// no need to call timeoutCancel() here since the traffic context is a child of the signal context,
-		// so will be cancelled automatically.
-		// timeoutCancel()
-	case <-timeoutCtx.Done():
-		a.logger.Info("Deadline exceeded")
-		// Needed to terminate the parent context, in case other's are reliant on it.
-		signalCancel()
-	}
-
-	// stopErr accumulates any errors from stopping traffic and modules, and finalising the report,
-	// to be returned at the end of the function.
-	var stopErr error
-	if stopErr = sched.Stop(); stopErr != nil {
-		a.logger.Error(stopErr, "Error when stopping traffic")
-		stopErr = fmt.Errorf("%w: traffic stop: %w", ErrStopping, stopErr)
-	}
-
-	// Now that traffic has been stopped, we can stop the reporter to allow it to finalise the report.
-	reporterCancel()
-
-	a.logger.Info("Stopping modules")
-	for _, m := range metadata {
-		if moduleStopErr := m.Stop(); moduleStopErr != nil {
-			a.logger.Error(moduleStopErr, "Module stop reported an error", "module", m.Name())
-			stopErr = errors.Join(stopErr, fmt.Errorf("module %s stop: %w", m.Name(), moduleStopErr))
+	case err := <-stopped:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w after %s", ErrStopTimeout, a.stopTimeout)
+	}
+}
+
+// loadFeeders loads the feeders of the enabled operations, once each if shared
+// by operations.
+func (a *abtr) loadFeeders(meta []*module.Meta) error {
+	loaded := make(map[*module.Feeder]bool)
+	for _, m := range meta {
+		for _, op := range m.Ops() {
+			if op.Disabled {
+				continue
+			}
+
+			for _, feeder := range op.Feeders {
+				if loaded[feeder] {
+					continue
+				}
+				loaded[feeder] = true
+
+				a.logger.Info("Loading feeder", "module", m.Name(), "op", op.Name, "feeder", feeder.Name, "path", feeder.Path)
+				if err := feeder.Load(); err != nil {
+					return fmt.Errorf("operation %s.%s: %w", m.Name(), op.Name, err)
+				}
+			}
 		}
 	}
 
-	a.logger.Info("Finalising report")
-	reporterStopErr := reporter.Finalise()
-	if reporterStopErr != nil {
-		a.logger.Error(reporterStopErr, "Error when finalising report")
-		stopErr = errors.Join(stopErr, fmt.Errorf("reporter stop: %w", reporterStopErr))
+	return nil
+}
+
+// readyModules waits for the modules implementing module.Readier to become
+// ready, each within the ready timeout.
+func (a *abtr) readyModules(ctx context.Context, meta []*module.Meta) error {
+	for _, m := range meta {
+		readier, ok := m.Module.(module.Readier)
+		if !ok {
+			continue
+		}
+
+		a.logger.Info("Awaiting ready", "module", m.Name(), "timeout", a.readyTimeout)
+		readyCtx, cancel := context.WithTimeout(ctx, a.readyTimeout)
+		err := readier.Ready(readyCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("module %s not ready: %w", m.Name(), err)
+		}
 	}
 
-	return stopErr
+	return nil
+}
+
+// opSetup is an operation of a module implementing module.OpHooks.
+type opSetup struct {
+	hooks   module.OpHooks
+	mod, op string
 }
 
-// startModules starts the input modules and logs any errors.
-func (a *abtr) startModules(meta []*module.Meta) error {
+// opSetups returns the enabled operations of the modules implementing
+// module.OpHooks, in the order they are set up.
+func opSetups(meta []*module.Meta) []opSetup {
+	var setups []opSetup
 	for _, m := range meta {
-		a.logger.Info("Starting", "module", m.Name())
-		if err := m.Run(); err != nil {
-			return fmt.Errorf("failed to start module %s: %w", m.Name(), err)
+		hooks, ok := m.Module.(module.OpHooks)
+		if !ok {
+			continue
+		}
+
+		for _, op := range m.Ops() {
+			if !op.Disabled {
+				setups = append(setups, opSetup{hooks: hooks, mod: m.Name(), op: op.Name})
+			}
+		}
+	}
+
+	return setups
+}
+
+// setupOps calls Setup for the enabled operations of the modules implementing
+// module.OpHooks. If an operation fails to be set up, those already set up are
+// torn down, and their errors are joined to the setup error.
+func (a *abtr) setupOps(meta []*module.Meta) error {
+	setups := opSetups(meta)
+	for i, s := range setups {
+		a.logger.Info("Setting up", "module", s.mod, "op", s.op)
+		if err := s.hooks.Setup(s.op); err != nil {
+			return errors.Join(
+				fmt.Errorf("failed to set up operation %s.%s: %w", s.mod, s.op, err),
+				a.teardown(setups[:i]),
+			)
 		}
 	}
 
 	return nil
 }
 
-// setupReporter creates the reporter(s). In interactive mode a collection reporter is
-// returned that fans out to both a YAML reporter and the live TUI reporter.
-// trafficCancel is called by the interactive reporter when the user requests an early
-// stop (e.g. Ctrl-C inside the TUI), triggering the same shutdown path as
-// SIGINT/SIGTERM on the parent context. trafficCtx is used by the interactive
-// reporter to monitor the traffic progression and display helpful messages in the TUI.
+// teardownOps calls Teardown for the operations set up by setupOps.
+func (a *abtr) teardownOps(meta []*module.Meta) error {
+	return a.teardown(opSetups(meta))
+}
+
+// teardown tears down the operations in the reverse order of setting them up,
+// and joins their errors.
+func (a *abtr) teardown(setups []opSetup) error {
+	var err error
+	for _, s := range slices.Backward(setups) {
+		a.logger.Info("Tearing down", "module", s.mod, "op", s.op)
+		if teardownErr := s.hooks.Teardown(s.op); teardownErr != nil {
+			err = errors.Join(err, fmt.Errorf("operation %s.%s teardown: %w", s.mod, s.op, teardownErr))
+		}
+	}
+
+	return err
+}
+
+// setupReporter creates the reporters and returns a collection reporter that
+// fans out to them, and the stats collector it includes. A stats collector is
+// always first in the collection, aggregating the operation results that are
+// read by the final report's reporter (YAML or JUnit) and the live TUI
+// reporter in interactive mode, or the progress reporter if a progress
+// interval is set. The event stream reporter is added if an events path is
+// set. trafficCancel is called by the interactive reporter when the user
+// requests an early stop (e.g. Ctrl-C inside the TUI), triggering the same
+// shutdown path as SIGINT/SIGTERM on the parent context. trafficCtx is used by
+// the interactive reporter to monitor the traffic progression and display
+// helpful messages in the TUI, and sched is controlled from the TUI.
 func (a *abtr) setupReporter(
 	metadata module.Metadata,
+	runMetadata *report.RunMetadata,
+	sched traffic.Scheduler,
 	//nolint:revive // the traffic context is special and not releated to the function really
 	trafficCtx context.Context, trafficCancel func(),
+) (report.Reporter, *stats.Collector) {
+	collector := stats.NewCollector()
+	reporters := []report.Reporter{collector}
+
+	// Both the report and those exported from the TUI start with the test.
+	start := time.Now()
+	reporters = append(reporters, a.newReportWriter(a.reportFormat, a.reportPath, start, metadata, runMetadata, collector))
+
+	if a.interactive {
+		reporters = append(reporters, interactivereport.New(&interactivereport.Opts{
+			Metadata:      metadata,
+			Duration:      a.duration,
+			Stats:         collector,
+			TrafficCtx:    trafficCtx,
+			TrafficCancel: trafficCancel,
+			Controller:    sched,
+			Thresholds:    a.thresholds,
+			Export: func(path string) error {
+				format, err := reportFormatOf(path)
+				if err != nil {
+					return err
+				}
+
+				return a.newReportWriter(format, path, start, metadata, runMetadata, collector).Finalise()
+			},
+		}))
+	}
+
+	if a.progress > 0 {
+		reporters = append(reporters, progressreport.New(&progressreport.Opts{
+			Interval: a.progress,
+			Duration: a.duration,
+			Stats:    collector,
+			Logger:   a.logger,
+		}))
+	}
+
+	if a.eventsPath != "" {
+		// The format has been validated by the runner pre-run.
+		format, _ := eventreport.ParseFormat(a.eventsFormat)
+		reporters = append(reporters, eventreport.New(&eventreport.Opts{
+			Path:       a.eventsPath,
+			Format:     format,
+			Gzip:       a.eventsGzip,
+			SampleRate: a.eventsSample,
+			Logger:     a.logger,
+		}))
+	}
+
+	return collection.New(reporters...), collector
+}
+
+// newReportWriter creates the reporter writing the final report in format to
+// path, from the results in collector.
+func (a *abtr) newReportWriter(
+	format, path string,
+	start time.Time,
+	metadata module.Metadata,
+	runMetadata *report.RunMetadata,
+	collector *stats.Collector,
 ) report.Reporter {
-	yamlR := yamlreport.New(&yamlreport.Opts{
-		Path:        a.reportPath,
+	if format == reportFormatJUnit {
+		return junitreport.New(&junitreport.Opts{
+			Start:       start,
+			Path:        path,
+			Metadata:    metadata,
+			Thresholds:  a.thresholds,
+			RunMetadata: runMetadata,
+			Stats:       collector,
+			Logger:      a.logger,
+			ErrorLogger: a.errorLogger,
+		})
+	}
+
+	return yamlreport.New(&yamlreport.Opts{
+		Start:       start,
+		Path:        path,
+		RunMetadata: runMetadata,
+		Stats:       collector,
 		Logger:      a.logger,
 		ErrorLogger: a.errorLogger,
 	})
+}
 
-	if a.interactive {
-		return collection.New(
-			yamlR,
-			interactivereport.New(
-				metadata,
-				a.duration,
-				trafficCtx,
-				trafficCancel,
-			),
-		)
-	}
-
-	return yamlR
+// validateReport validates the report format, and the report path against it.
+// Unless set by flag, the path is defaulted to match the format.
+func (a *abtr) validateReport(pathSet bool) error {
+	if a.reportFormat != reportFormatYAML && a.reportFormat != reportFormatJUnit {
+		return fmt.Errorf("report format must be %s or %s", reportFormatYAML, reportFormatJUnit)
+	}
+
+	if !pathSet && a.reportFormat == reportFormatJUnit {
+		a.reportPath = defaultJUnitPath
+	}
+
+	// A path without a known extension is written in the format as is.
+	if format, err := reportFormatOf(a.reportPath); err == nil && format != a.reportFormat {
+		return fmt.Errorf("report path %s is not of the %s report format", a.reportPath, a.reportFormat)
+	}
+
+	return nil
+}
+
+// reportFormatOf returns the report format of a path by its extension, .yaml
+// or .yml for YAML and .xml for JUnit.
+func reportFormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return reportFormatYAML, nil
+	case ".xml":
+		return reportFormatJUnit, nil
+	default:
+		return "", fmt.Errorf("%w: %q, use .yaml, .yml or .xml", ErrReportExtension, filepath.Ext(path))
+	}
 }
 
 // setupLoggers initialises the info and error loggers from the provided options.
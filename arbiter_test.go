@@ -1,6 +1,7 @@
 package arbiter
 
 import (
+	"errors"
 	"os"
 	"testing"
 
@@ -44,6 +45,17 @@ func TestRun_ParsingFailed(t *testing.T) {
 		}
 	})
 
+	t.Run("progress with interactive", func(t *testing.T) {
+		os.Args = []string{"arbiter", cli.FlagsetName, "-d", "1s", "-i", "--progress", "10s"}
+
+		modules := module.Modules{&modulemock.Module{SetName: "mock"}}
+
+		err := Run(modules, nil)
+		if err == nil || err.Error() != "progress cannot be combined with interactive mode" {
+			t.Fatalf("expected progress error, got %v", err)
+		}
+	})
+
 	t.Run("report path is a directory", func(t *testing.T) {
 		// Create a temporary directory to use as the report path
 		dir := t.TempDir()
@@ -58,3 +70,50 @@ func TestRun_ParsingFailed(t *testing.T) {
 		}
 	})
 }
+
+func TestReportFormatOf(t *testing.T) {
+	for path, want := range map[string]string{
+		"report.yaml":    reportFormatYAML,
+		"out/report.YML": reportFormatYAML,
+		"junit.xml":      reportFormatJUnit,
+	} {
+		got, err := reportFormatOf(path)
+		if err != nil || got != want {
+			t.Errorf("reportFormatOf(%q) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+
+	if _, err := reportFormatOf("report.txt"); !errors.Is(err, ErrReportExtension) {
+		t.Fatalf("expected ErrReportExtension, got %v", err)
+	}
+}
+
+func TestValidateReport(t *testing.T) {
+	tests := []struct {
+		name, path, format string
+		pathSet            bool
+		want               string
+		err                bool
+	}{
+		{name: "yaml default", path: defaultReportPath, format: reportFormatYAML, want: "report.yaml"},
+		{name: "junit default", path: defaultReportPath, format: reportFormatJUnit, want: "report.xml"},
+		{name: "junit path", path: "out/junit.xml", format: reportFormatJUnit, pathSet: true, want: "out/junit.xml"},
+		{name: "no extension", path: "out/report", format: reportFormatJUnit, pathSet: true, want: "out/report"},
+		{name: "junit to yaml", path: "report.yaml", format: reportFormatJUnit, pathSet: true, err: true},
+		{name: "yaml to xml", path: "report.xml", format: reportFormatYAML, pathSet: true, err: true},
+		{name: "unknown format", path: defaultReportPath, format: "json", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &abtr{reportPath: tt.path, reportFormat: tt.format}
+			err := a.validateReport(tt.pathSet)
+			if tt.err != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tt.err, err)
+			}
+			if !tt.err && a.reportPath != tt.want {
+				t.Fatalf("expected path %s, got %s", tt.want, a.reportPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Package arbitertest runs Arbiter modules from Go tests, failing the test if
+// an operation breaches its thresholds.
+package arbitertest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/maansaake/arbiter"
+	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/traffic"
+)
+
+// Opts contains options for a test run.
+type Opts struct {
+	// Args sets module args, keyed by their CLI flag name without the leading
+	// dashes, e.g. "sample.important".
+	Args map[string]string
+	// Rates sets the rate per minute of operations, keyed by "<module>.<op>".
+	Rates map[string]uint
+	// Duration of the test. Defaults to 5 seconds if not set.
+	Duration time.Duration
+	// WorkerLimit is the maximum number of concurrent workers per workload.
+	WorkerLimit int
+	// MaxInFlight is the maximum number of concurrent invocations across all
+	// operations. Unlimited if not set.
+	MaxInFlight int
+	// Iterations is the total number of invocations, after which the test
+	// ends before the duration runs out. Unlimited if not set.
+	Iterations uint
+	// IterationsPerOp is the number of invocations of each operation without
+	// iterations of its own. Unlimited if not set.
+	IterationsPerOp uint
+	// Abort are the conditions under which the traffic of a failing operation
+	// is aborted. The test fails if an abort condition stops the run.
+	Abort traffic.AbortConditions
+	// Thresholds each operation must stay within for the test to pass. If no
+	// threshold is set, the test fails if any invocation failed.
+	Thresholds report.Thresholds
+	// Reporters receive the operation results in addition to the report.
+	Reporters []report.Reporter
+}
+
+const defaultDuration = 5 * time.Second
+
+// Run runs the modules for the duration of the options and returns the report.
+// Logs are written to tb, and a summary of each operation is logged when the
+// run ends. Each threshold breach, and an abort condition stopping the run, is
+// reported with tb.Errorf, while a failure to run the modules at all fails the
+// test immediately. A nil opts runs with the defaults.
+func Run(tb testing.TB, modules module.Modules, opts *Opts) *report.Report {
+	tb.Helper()
+
+	if opts == nil {
+		opts = &Opts{}
+	}
+
+	duration := opts.Duration
+	if duration == 0 {
+		duration = defaultDuration
+	}
+
+	rep, err := arbiter.Execute(tb.Context(), &arbiter.Config{
+		Modules:         modules,
+		Args:            opts.Args,
+		Rates:           opts.Rates,
+		Duration:        duration,
+		WorkerLimit:     opts.WorkerLimit,
+		MaxInFlight:     opts.MaxInFlight,
+		Iterations:      opts.Iterations,
+		IterationsPerOp: opts.IterationsPerOp,
+		Abort:           opts.Abort,
+		Reporters:       opts.Reporters,
+		Logger:          testr.NewWithInterface(tb, testr.Options{}),
+	})
+	if rep == nil {
+		tb.Fatalf("arbiter run failed: %v", err)
+	}
+	if err != nil {
+		tb.Errorf("arbiter run did not stop cleanly: %v", err)
+	}
+
+	tb.Log(Summary(rep))
+
+	if rep.Aborted != "" {
+		tb.Errorf("arbiter run aborted: %s", rep.Aborted)
+	}
+
+	for _, name := range opNames(rep) {
+		mod, op, _ := strings.Cut(name, ".")
+		details := rep.Operation(mod, op)
+		for _, v := range opts.Thresholds.Check(
+			uint64(details.Executions),
+			uint64(details.NOK),
+			details.Timing.Average,
+			details.Timing.Longest,
+		) {
+			tb.Errorf("%s: %s", name, v)
+		}
+	}
+
+	return rep
+}
+
+// Summary formats a table of the executions and latencies of each operation
+// in the report.
+func Summary(rep *report.Report) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "arbiter ran for %s\n", rep.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "%-30s %10s %10s %12s %12s %12s %12s\n", "OPERATION", "CALLS", "FAILED", "AVG", "P50", "P95", "P99")
+
+	for _, name := range opNames(rep) {
+		mod, op, _ := strings.Cut(name, ".")
+		details := rep.Operation(mod, op)
+		fmt.Fprintf(&b, "%-30s %10d %10d %12s %12s %12s %12s\n",
+			name,
+			details.Executions,
+			details.NOK,
+			details.Timing.Average,
+			details.Timing.P50,
+			details.Timing.P95,
+			details.Timing.P99,
+		)
+	}
+
+	return b.String()
+}
+
+/*INTERNAL*/
+
+// opNames returns the "<module>.<op>" names of the operations in the report, sorted.
+func opNames(rep *report.Report) []string {
+	var names []string
+	for mod, m := range rep.Modules {
+		for op := range m.Operations {
+			names = append(names, mod+"."+op)
+		}
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,130 @@
+package arbitertest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+	"github.com/maansaake/arbiter/pkg/report"
+)
+
+// recorder records test failures instead of failing the test.
+type recorder struct {
+	testing.TB
+
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func newMock() *modulemock.Module {
+	return &modulemock.Module{
+		SetName: "mock",
+		SetOps: module.Ops{
+			&module.Op{
+				Name: "ok",
+				Rate: 6000,
+				Do: func() (module.Result, error) {
+					return module.Result{Duration: 2 * time.Millisecond}, nil
+				},
+			},
+			&module.Op{
+				Name: "fail",
+				Rate: 6000,
+				Do: func() (module.Result, error) {
+					return module.Result{}, errors.New("fail")
+				},
+			},
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	rep := Run(t, module.Modules{newMock()}, &Opts{
+		Args:     map[string]string{"mock.op.fail.disable": "true"},
+		Duration: 500 * time.Millisecond,
+	})
+
+	if op := rep.Operation("mock", "ok"); op == nil || op.Executions == 0 {
+		t.Fatal("expected ok operation to have been executed")
+	}
+
+	for _, name := range []string{"info.log", "error.log"} {
+		if _, err := os.Stat(name); err == nil {
+			t.Fatalf("expected no %s to be created", name)
+		}
+	}
+}
+
+func TestRun_Thresholds(t *testing.T) {
+	tests := []struct {
+		name       string
+		thresholds report.Thresholds
+		wantErrors []string
+	}{
+		{
+			name:       "no thresholds",
+			wantErrors: []string{"mock.fail: "},
+		},
+		{
+			name:       "error rate",
+			thresholds: report.Thresholds{MaxErrorRate: 0.5},
+			wantErrors: []string{"mock.fail: error rate"},
+		},
+		{
+			name:       "latency",
+			thresholds: report.Thresholds{MaxErrorRate: 1, MaxAverageLatency: time.Millisecond},
+			wantErrors: []string{"mock.ok: average latency"},
+		},
+		{
+			name:       "passing",
+			thresholds: report.Thresholds{MaxErrorRate: 1, MaxLatency: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{TB: t}
+			Run(r, module.Modules{newMock()}, &Opts{
+				Duration:   200 * time.Millisecond,
+				Thresholds: tt.thresholds,
+			})
+
+			if len(r.errors) != len(tt.wantErrors) {
+				t.Fatalf("expected %d errors, got %v", len(tt.wantErrors), r.errors)
+			}
+			for i, want := range tt.wantErrors {
+				if !strings.HasPrefix(r.errors[i], want) {
+					t.Fatalf("expected error starting with %q, got %q", want, r.errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	rep := &report.Report{
+		Duration: time.Second,
+		Modules: map[string]*report.ModuleReport{
+			"mock": {Operations: map[string]*report.OperationDetails{
+				"b": {Executions: 2, Timing: &report.OperationTiming{}},
+				"a": {Executions: 1, Timing: &report.OperationTiming{}},
+			}},
+		},
+	}
+
+	lines := strings.Split(strings.TrimSpace(Summary(rep)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d", len(lines))
+	}
+	if !strings.HasPrefix(lines[2], "mock.a") || !strings.HasPrefix(lines[3], "mock.b") {
+		t.Fatalf("expected sorted operations, got %v", lines[2:])
+	}
+}
@@ -29,12 +29,12 @@ func New() module.Module {
 	}
 
 	s.args = module.Args{
-		&module.Arg[int]{
-			Name: "testdelay",
-			Desc: "The delay for the 'test' action.",
-			Handler: func(v int) {
-				s.testDelay = time.Duration(v * int(time.Millisecond))
-				zerologr.Info("Set value for testdelay", "value", s.testDelay)
+		&module.Arg[time.Duration]{
+			Name:  "testdelay",
+			Desc:  "The delay for the 'test' action.",
+			Value: &s.testDelay,
+			Handler: func(v time.Duration) {
+				zerologr.Info("Set value for testdelay", "value", v)
 			},
 		},
 		&module.Arg[int]{
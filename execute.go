@@ -0,0 +1,361 @@
+package arbiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/collection"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+	"github.com/maansaake/arbiter/pkg/subcommand/cli"
+	"github.com/maansaake/arbiter/pkg/traffic"
+	"github.com/spf13/pflag"
+)
+
+// Config configures a test run started with Execute.
+type Config struct {
+	// Modules to run the test with.
+	Modules module.Modules
+	// Args sets module args, keyed by their CLI flag name without the leading
+	// dashes, e.g. "sample.important". Values are parsed as if given on the
+	// command line, so operations can be disabled with e.g.
+	// "sample.op.broken.disable": "true". Args not given here are set from
+	// their environment variables, if set.
+	Args map[string]string
+	// Rates sets the rate per minute of operations, keyed by "<module>.<op>".
+	Rates map[string]uint
+	// Duration of the test. Defaults to 5 minutes if not set.
+	Duration time.Duration
+	// WorkerLimit is the maximum number of concurrent workers per workload.
+	// Defaults to 10 if not set. Operations with a MaxConcurrency override it.
+	WorkerLimit int
+	// MaxInFlight is the maximum number of concurrent invocations across all
+	// operations. Unlimited if not set.
+	MaxInFlight int
+	// Iterations is the total number of invocations across all operations,
+	// after which the test ends. Unlimited if not set.
+	Iterations uint
+	// IterationsPerOp is the number of invocations of each operation without
+	// iterations of its own. The test ends once all operations are done.
+	// Unlimited if not set.
+	IterationsPerOp uint
+	// Abort are the conditions under which the traffic of a failing operation
+	// is aborted. None are checked if not set.
+	Abort traffic.AbortConditions
+	// Reporters receive the operation results in addition to the statistics
+	// the returned report is built from.
+	Reporters []report.Reporter
+	// ReadyTimeout is the maximum time to wait for each module implementing
+	// module.Readier to become ready. Defaults to 1 minute if not set.
+	ReadyTimeout time.Duration
+	// StopTimeout is the maximum time to wait for each module to stop.
+	// Defaults to 30 seconds if not set.
+	StopTimeout time.Duration
+	// Label is a name of the run, recorded in the report metadata.
+	Label string
+	// Tags are key-value pairs describing the run, recorded in the report metadata.
+	Tags map[string]string
+	// Logger is used for info-level logging. Logs are discarded if not set.
+	Logger logr.Logger
+}
+
+const defaultWorkerLimit = 10
+
+// ErrConfig is returned by Execute when the config is invalid.
+var ErrConfig = errors.New("invalid config")
+
+// Execute runs a test with the given config until the duration runs out or ctx
+// is cancelled, and returns the report of the run. Unlike Run, no command line
+// arguments are parsed, no signal handlers are installed and no log or report
+// files are written, unless by reporters of the config.
+//
+// A report is returned also when stopping traffic, modules or reporters fails,
+// alongside an error wrapping ErrStopping.
+func Execute(ctx context.Context, cfg *Config) (*report.Report, error) {
+	if err := module.Validate(cfg.Modules); err != nil {
+		return nil, err
+	}
+
+	metadata, err := cfg.bind()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &abtr{
+		duration:        cfg.Duration,
+		workerLimit:     cfg.WorkerLimit,
+		maxInFlight:     cfg.MaxInFlight,
+		iterations:      cfg.Iterations,
+		iterationsPerOp: cfg.IterationsPerOp,
+		abort:           cfg.Abort,
+		readyTimeout:    cfg.ReadyTimeout,
+		stopTimeout:     cfg.StopTimeout,
+		label:           cfg.Label,
+		tags:            cfg.Tags,
+		logger:          cfg.Logger,
+	}
+	if a.duration == 0 {
+		a.duration = defaultDuration
+	}
+	if a.duration < 0 {
+		return nil, fmt.Errorf("%w: duration must be positive", ErrConfig)
+	}
+	if a.maxInFlight < 0 {
+		return nil, fmt.Errorf("%w: max in-flight cannot be negative", ErrConfig)
+	}
+	if a.readyTimeout == 0 {
+		a.readyTimeout = defaultReadyTimeout
+	}
+	if a.readyTimeout < 0 {
+		return nil, fmt.Errorf("%w: ready timeout must be positive", ErrConfig)
+	}
+	if a.stopTimeout == 0 {
+		a.stopTimeout = defaultStopTimeout
+	}
+	if a.stopTimeout < 0 {
+		return nil, fmt.Errorf("%w: stop timeout must be positive", ErrConfig)
+	}
+	if err = validateAbort(&a.abort); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	if a.workerLimit == 0 {
+		a.workerLimit = defaultWorkerLimit
+	}
+	if a.logger.GetSink() == nil {
+		a.logger = logr.Discard()
+	}
+
+	collector := stats.NewCollector()
+	reporter := collection.New(append([]report.Reporter{collector}, cfg.Reporters...)...)
+
+	trafficCtx, trafficCancel := context.WithCancel(ctx)
+	defer trafficCancel()
+
+	return a.execute(
+		trafficCtx, trafficCancel, metadata, a.runMetadata(metadata), a.newScheduler(), reporter, collector,
+	)
+}
+
+// bind applies the args and rates of the config, and then environment
+// variables, to the modules through the same flags as the cli subcommand.
+func (c *Config) bind() (module.Metadata, error) {
+	binding, err := cli.Bind(pflag.NewFlagSet(cli.FlagsetName, pflag.ContinueOnError), c.Modules)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range c.Args {
+		if err = binding.Set(name, value); err != nil {
+			return nil, fmt.Errorf("%w: arg %s: %w", ErrConfig, name, err)
+		}
+	}
+
+	for name, rate := range c.Rates {
+		mod, op, ok := strings.Cut(name, ".")
+		if !ok {
+			return nil, fmt.Errorf("%w: rate key %q is not on the form <module>.<op>", ErrConfig, name)
+		}
+
+		if err = binding.Set(cli.OpFlagName(mod, op, "rate"), fmt.Sprint(rate)); err != nil {
+			return nil, fmt.Errorf("%w: rate %s: %w", ErrConfig, name, err)
+		}
+	}
+
+	if err = binding.SetFromEnv(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+
+	if err = binding.CheckRequired(); err != nil {
+		return nil, err
+	}
+
+	return binding.Metadata, nil
+}
+
+// execute starts the modules, waits for them to be ready and sets up their
+// operations, then runs traffic until the duration runs out, all iterations are
+// done, an abort condition stops the test or ctx is done. It then stops
+// traffic, tears down the operations, stops the modules and finalises the
+// reporter. cancel is called when traffic ends before ctx is done, to terminate
+// ctx for anyone else relying on it. Traffic is run by sched. The returned
+// report is built from the collector, which must receive operation results
+// through the reporter, and includes runMetadata.
+func (a *abtr) execute(
+	ctx context.Context, cancel context.CancelFunc,
+	metadata module.Metadata,
+	runMetadata *report.RunMetadata,
+	sched traffic.Scheduler,
+	reporter report.Reporter,
+	collector *stats.Collector,
+) (*report.Report, error) {
+	for _, m := range metadata {
+		if values := m.Args().Values(); len(values) > 0 {
+			a.logger.Info("Module args", argKeysAndValues(m.Name(), values)...)
+		}
+	}
+
+	// Modules are started in dependency order, and share resources through the
+	// registry carried by ctx. runCtx is not cancelled before the modules are
+	// stopped.
+	ordered, err := module.Order(metadata)
+	if err != nil {
+		return nil, err
+	}
+	ctx = module.WithRegistry(ctx, module.NewRegistry())
+	runCtx := context.WithoutCancel(ctx)
+
+	// Feeders are loaded before the modules start, to fail on missing or broken
+	// files without starting anything.
+	if err = a.loadFeeders(ordered); err != nil {
+		a.logger.Error(err, "Feeder failure")
+		return nil, err
+	}
+
+	a.logger.Info("Starting modules")
+
+	if err = a.startModules(runCtx, ordered); err != nil {
+		a.logger.Error(err, "Start failure")
+		return nil, err
+	}
+	a.logger.Info("All modules started")
+
+	// Modules that fail to get ready or set up are stopped again.
+	if err = a.readyModules(ctx, ordered); err != nil {
+		a.logger.Error(err, "Ready failure")
+		return nil, errors.Join(err, a.stopModules(runCtx, ordered))
+	}
+	if err = a.setupOps(ordered); err != nil {
+		a.logger.Error(err, "Setup failure")
+		return nil, errors.Join(err, a.stopModules(runCtx, ordered))
+	}
+
+	// Traffic context with a timeout of the test's >>> duration <<<
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, a.duration)
+	defer timeoutCancel()
+	a.logger.Info("Traffic will run for: " + a.duration.String())
+
+	// The reporter runs in its own context to allow reporting to finalize separately from traffic and module
+	// shutdown.
+	reporterCtx, reporterCancel := context.WithCancel(context.Background())
+	defer reporterCancel()
+	start := time.Now()
+	reporter.Start(reporterCtx)
+
+	// Run traffic.
+	if err = sched.Run(timeoutCtx, metadata, reporter); err != nil {
+		reporter.ReportError(err) // Report is done in case of early traffic failure, to highlight issues in the TUI.
+		a.logger.Error(err, "Failed to start traffic")
+		reporterCancel()
+		err = errors.Join(err, a.teardownOps(ordered), a.stopModules(runCtx, ordered))
+		return nil, errors.Join(err, a.finaliseReporter(reporter))
+	}
+
+	a.logger.Info("Awaiting completion (stop, duration timeout, iterations done or abort)")
+	select {
+	case <-timeoutCtx.Done():
+		if ctx.Err() != nil {
+			a.logger.Info("Got stop signal")
+		} else {
+			a.logger.Info("Deadline exceeded")
+			// Needed to terminate the parent context, in case other's are reliant on it.
+			cancel()
+		}
+	case <-sched.Done():
+		a.logger.Info("All operations done")
+		cancel()
+	case <-sched.Aborted():
+		a.logger.Info("Aborted")
+		cancel()
+	}
+
+	// stopErr accumulates any errors from stopping traffic and modules, and finalising the report,
+	// to be returned at the end of the function.
+	var stopErr error
+	if err := sched.Stop(); err != nil {
+		a.logger.Error(err, "Error when stopping traffic")
+		stopErr = fmt.Errorf("traffic stop: %w", err)
+	}
+
+	// Now that traffic has been stopped, we can stop the reporter to allow it to finalise the report.
+	reporterCancel()
+	rep := report.NewReport(start, collector.Snapshot(), runMetadata)
+
+	if err = a.teardownOps(ordered); err != nil {
+		a.logger.Error(err, "Operation teardown reported an error")
+		stopErr = errors.Join(stopErr, err)
+	}
+
+	a.logger.Info("Stopping modules")
+	if err = a.stopModules(runCtx, ordered); err != nil {
+		stopErr = errors.Join(stopErr, err)
+	}
+
+	if err = a.finaliseReporter(reporter); err != nil {
+		stopErr = errors.Join(stopErr, err)
+	}
+
+	if stopErr != nil {
+		return rep, fmt.Errorf("%w: %w", ErrStopping, stopErr)
+	}
+
+	return rep, nil
+}
+
+// finaliseReporter finalises the report once the context of the reporter is
+// cancelled.
+func (a *abtr) finaliseReporter(reporter report.Reporter) error {
+	a.logger.Info("Finalising report")
+	if err := reporter.Finalise(); err != nil {
+		a.logger.Error(err, "Error when finalising report")
+		return fmt.Errorf("reporter stop: %w", err)
+	}
+
+	return nil
+}
+
+// newScheduler creates the traffic scheduler of a run.
+func (a *abtr) newScheduler() traffic.Scheduler {
+	return traffic.New(&traffic.Opts{
+		Logger:          a.logger,
+		WorkerLimit:     a.workerLimit,
+		MaxInFlight:     a.maxInFlight,
+		Iterations:      a.iterations,
+		IterationsPerOp: a.iterationsPerOp,
+		Abort:           a.abort,
+	})
+}
+
+// validateAbort checks the abort conditions, and that the action is known if
+// set.
+func validateAbort(abort *traffic.AbortConditions) error {
+	if abort.MaxErrorRate < 0 || abort.MaxErrorRate > 1 {
+		return errors.New("abort error rate must be between 0 and 1")
+	}
+	if abort.Window < 0 {
+		return errors.New("abort window cannot be negative")
+	}
+	if abort.Action != "" {
+		if _, err := traffic.ParseAbortAction(string(abort.Action)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// argKeysAndValues returns the module name and arg values as logger key-value
+// pairs. Secret values are already redacted.
+func argKeysAndValues(mod string, values []module.ArgValue) []any {
+	kv := make([]any, 0, 2+2*len(values)) //nolint:mnd // key-value pairs
+	kv = append(kv, "module", mod)
+	for _, v := range values {
+		kv = append(kv, v.Name, v.Value)
+	}
+
+	return kv
+}
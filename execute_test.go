@@ -0,0 +1,601 @@
+package arbiter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+	"github.com/maansaake/arbiter/pkg/traffic"
+)
+
+func newExecuteMock(delay *int) *modulemock.Module {
+	return &modulemock.Module{
+		SetName: "mock",
+		SetArgs: module.Args{
+			&module.Arg[int]{Name: "delay", Required: true, Value: delay},
+		},
+		SetOps: module.Ops{
+			&module.Op{
+				Name: "ok",
+				Do: func() (module.Result, error) {
+					return module.Result{Duration: time.Duration(*delay) * time.Millisecond}, nil
+				},
+			},
+			&module.Op{
+				Name: "fail",
+				Do: func() (module.Result, error) {
+					return module.Result{}, errors.New("fail")
+				},
+			},
+		},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	delay := 0
+	collector := stats.NewCollector()
+
+	rep, err := Execute(context.Background(), &Config{
+		Modules:   module.Modules{newExecuteMock(&delay)},
+		Args:      map[string]string{"mock.delay": "5", "mock.op.fail.disable": "true"},
+		Rates:     map[string]uint{"mock.ok": 6000},
+		Duration:  time.Second,
+		Reporters: []report.Reporter{collector},
+		Label:     "smoke",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delay != 5 {
+		t.Fatalf("expected delay arg to be 5, got %d", delay)
+	}
+
+	op := rep.Operation("mock", "ok")
+	if op == nil {
+		t.Fatal("expected ok operation in report")
+	}
+	if op.Executions == 0 || op.NOK != 0 {
+		t.Fatalf("unexpected executions %d and failures %d", op.Executions, op.NOK)
+	}
+	if op.Timing.Average != 5*time.Millisecond {
+		t.Fatalf("expected average of 5ms, got %s", op.Timing.Average)
+	}
+	if rep.Operation("mock", "fail") != nil {
+		t.Fatal("disabled operation should not be in report")
+	}
+	if rep.Duration < time.Second {
+		t.Fatalf("expected duration of at least 1s, got %s", rep.Duration)
+	}
+
+	if rep.Metadata == nil || rep.Metadata.Label != "smoke" {
+		t.Fatal("expected run metadata with the label")
+	}
+	if cfg := rep.Metadata.Modules["mock"]; cfg == nil || cfg.Operations["ok"].Rate != 6000 {
+		t.Fatal("expected the configured rate in the run metadata")
+	}
+
+	if s := collector.Snapshot().Op("mock", "ok"); s == nil || s.Executions == 0 {
+		t.Fatal("expected config reporter to receive operation results")
+	}
+}
+
+func TestExecute_Cancel(t *testing.T) {
+	delay := 0
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	rep, err := Execute(ctx, &Config{
+		Modules: module.Modules{newExecuteMock(&delay)},
+		Args:    map[string]string{"mock.delay": "0"},
+		Rates:   map[string]uint{"mock.ok": 600, "mock.fail": 600},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep == nil {
+		t.Fatal("expected a report")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected execute to stop when cancelled, took %s", elapsed)
+	}
+}
+
+func TestExecute_Iterations(t *testing.T) {
+	delay := 0
+	mod := newExecuteMock(&delay)
+	// The invocations take time, so the test only ends once the last of them
+	// has completed.
+	mod.SetOps[0].Do = func() (module.Result, error) {
+		time.Sleep(5 * time.Millisecond)
+		return module.Result{}, nil
+	}
+	collector := stats.NewCollector()
+
+	start := time.Now()
+	rep, err := Execute(context.Background(), &Config{
+		Modules:     module.Modules{mod},
+		Args:        map[string]string{"mock.delay": "0", "mock.op.fail.disable": "true"},
+		Rates:       map[string]uint{"mock.ok": 60000},
+		Duration:    time.Minute,
+		Iterations:  20,
+		WorkerLimit: 1,
+		Reporters:   []report.Reporter{collector},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected execute to stop once iterations are done, took %s", elapsed)
+	}
+	if op := rep.Operation("mock", "ok"); op == nil || op.Executions != 20 {
+		t.Fatal("expected 20 executions")
+	}
+	if rep.Metadata.Iterations != 20 {
+		t.Fatal("expected the iterations in the run metadata")
+	}
+}
+
+func TestExecute_Abort(t *testing.T) {
+	delay := 0
+
+	start := time.Now()
+	rep, err := Execute(context.Background(), &Config{
+		Modules:  module.Modules{newExecuteMock(&delay)},
+		Args:     map[string]string{"mock.delay": "0"},
+		Rates:    map[string]uint{"mock.ok": 600, "mock.fail": 6000},
+		Duration: time.Minute,
+		Abort:    traffic.AbortConditions{ConsecutiveFailures: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected execute to stop once aborted, took %s", elapsed)
+	}
+	if rep.Aborted != "mock.fail: 5 consecutive failures" {
+		t.Fatal("expected the abort reason in the report, got", rep.Aborted)
+	}
+	if aborts := rep.Operation("mock", "fail").Aborts; len(aborts) != 1 || aborts[0].Action != "stop" {
+		t.Fatal("unexpected aborts", aborts)
+	}
+}
+
+// lifecycleModule records the calls of its lifecycle hooks.
+type lifecycleModule struct {
+	*modulemock.Module
+	calls    []string
+	notReady bool
+}
+
+func (m *lifecycleModule) Ready(ctx context.Context) error {
+	m.calls = append(m.calls, "ready")
+	if m.notReady {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+func (m *lifecycleModule) Setup(op string) error {
+	m.calls = append(m.calls, "setup "+op)
+	return nil
+}
+
+func (m *lifecycleModule) Teardown(op string) error {
+	m.calls = append(m.calls, "teardown "+op)
+	return nil
+}
+
+func TestExecute_Lifecycle(t *testing.T) {
+	delay := 0
+	mod := &lifecycleModule{Module: newExecuteMock(&delay)}
+
+	rep, err := Execute(context.Background(), &Config{
+		Modules:  module.Modules{mod},
+		Args:     map[string]string{"mock.delay": "0", "mock.op.fail.disable": "true"},
+		Rates:    map[string]uint{"mock.ok": 600},
+		Duration: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op := rep.Operation("mock", "ok"); op == nil || op.Executions == 0 {
+		t.Fatal("expected executions once set up")
+	}
+	if want := []string{"ready", "setup ok", "teardown ok"}; !slices.Equal(mod.calls, want) {
+		t.Fatalf("expected hooks %v, got %v", want, mod.calls)
+	}
+}
+
+func TestExecute_NotReady(t *testing.T) {
+	delay := 0
+	mod := &lifecycleModule{Module: newExecuteMock(&delay), notReady: true}
+
+	_, err := Execute(context.Background(), &Config{
+		Modules:      module.Modules{mod},
+		Args:         map[string]string{"mock.delay": "0"},
+		Rates:        map[string]uint{"mock.ok": 600, "mock.fail": 600},
+		ReadyTimeout: 50 * time.Millisecond,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the ready timeout, got %v", err)
+	}
+	if !slices.Equal(mod.calls, []string{"ready"}) {
+		t.Fatalf("expected no operation to be set up, got %v", mod.calls)
+	}
+}
+
+// eventLog is a log of module events shared by modules, safe for concurrent
+// use by stops abandoned after a timeout.
+type eventLog struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) list() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return slices.Clone(l.events)
+}
+
+// orderModule records when it is started and stopped in a log shared with
+// other modules.
+type orderModule struct {
+	*modulemock.Module
+	log    *eventLog
+	runErr error
+	// stopBlock, if set, blocks Stop until it is closed.
+	stopBlock <-chan struct{}
+}
+
+func newOrderModule(name string, log *eventLog) *orderModule {
+	return &orderModule{
+		Module: &modulemock.Module{
+			SetName: name,
+			SetOps: module.Ops{
+				&module.Op{Name: "op", Do: func() (module.Result, error) { return module.Result{}, nil }},
+			},
+		},
+		log: log,
+	}
+}
+
+func (m *orderModule) Run() error {
+	if m.runErr != nil {
+		return m.runErr
+	}
+	m.log.add("run " + m.Name())
+	return nil
+}
+
+func (m *orderModule) Stop() error {
+	if m.stopBlock != nil {
+		<-m.stopBlock
+	}
+	m.log.add("stop " + m.Name())
+	return nil
+}
+
+// stopperModule is an orderModule stopped with a context.
+type stopperModule struct {
+	*orderModule
+}
+
+func (m *stopperModule) StopContext(ctx context.Context) error {
+	m.log.add("stop " + m.Name())
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestExecute_StopOrder(t *testing.T) {
+	log := &eventLog{}
+
+	_, err := Execute(context.Background(), &Config{
+		Modules:  module.Modules{newOrderModule("first", log), newOrderModule("second", log)},
+		Rates:    map[string]uint{"first.op": 600, "second.op": 600},
+		Duration: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"run first", "run second", "stop second", "stop first"}; !slices.Equal(log.list(), want) {
+		t.Fatalf("expected %v, got %v", want, log.list())
+	}
+}
+
+func TestExecute_StartFailure(t *testing.T) {
+	log := &eventLog{}
+	failing := newOrderModule("third", log)
+	failing.runErr = errors.New("no fixtures")
+
+	_, err := Execute(context.Background(), &Config{
+		Modules: module.Modules{newOrderModule("first", log), newOrderModule("second", log), failing},
+		Rates:   map[string]uint{"first.op": 600, "second.op": 600, "third.op": 600},
+	})
+	if !errors.Is(err, failing.runErr) {
+		t.Fatalf("expected the start error, got %v", err)
+	}
+	if want := []string{"run first", "run second", "stop second", "stop first"}; !slices.Equal(log.list(), want) {
+		t.Fatalf("expected the started modules to be stopped in reverse, got %v", log.list())
+	}
+}
+
+func TestExecute_StopTimeout(t *testing.T) {
+	log := &eventLog{}
+	slow := newOrderModule("slow", log)
+	// The stop of slow is abandoned, and only returns once the test is over.
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	slow.stopBlock = release
+	stopper := &stopperModule{orderModule: newOrderModule("stopper", log)}
+
+	start := time.Now()
+	rep, err := Execute(context.Background(), &Config{
+		Modules:     module.Modules{slow, stopper},
+		Rates:       map[string]uint{"slow.op": 600, "stopper.op": 600},
+		Duration:    50 * time.Millisecond,
+		StopTimeout: 50 * time.Millisecond,
+	})
+	if rep == nil || !errors.Is(err, ErrStopping) {
+		t.Fatalf("expected a report and a stopping error, got %v", err)
+	}
+	if !errors.Is(err, ErrStopTimeout) ||
+		!strings.Contains(err.Error(), "module slow stop") || !strings.Contains(err.Error(), "module stopper stop") {
+		t.Fatalf("expected both modules to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Fatalf("expected the slow stop to be abandoned, took %s", elapsed)
+	}
+}
+
+// endReporter records the errors reported to it and how it is finalised, and
+// fails to finalise with err.
+type endReporter struct {
+	ctx       context.Context //nolint:containedctx // recorded to check it is cancelled
+	errs      []error
+	finalised bool
+	cancelled bool
+	err       error
+}
+
+func (r *endReporter) Start(ctx context.Context)                      { r.ctx = ctx }
+func (r *endReporter) ReportError(err error)                          { r.errs = append(r.errs, err) }
+func (r *endReporter) ReportOp(string, string, *module.Result, error) {}
+
+func (r *endReporter) Finalise() error {
+	r.finalised = true
+	r.cancelled = r.ctx.Err() != nil
+	return r.err
+}
+
+func TestExecute_TrafficFailure(t *testing.T) {
+	delay := 0
+	reporter := &endReporter{err: errors.New("disk full")}
+
+	// Traffic fails to start without any operation to schedule.
+	_, err := Execute(context.Background(), &Config{
+		Modules:   module.Modules{newExecuteMock(&delay)},
+		Args:      map[string]string{"mock.delay": "0", "mock.op.ok.disable": "true", "mock.op.fail.disable": "true"},
+		Reporters: []report.Reporter{reporter},
+	})
+	if !errors.Is(err, traffic.ErrNoOpsToSchedule) || !errors.Is(err, reporter.err) {
+		t.Fatalf("expected the traffic and finalise errors, got %v", err)
+	}
+	if len(reporter.errs) != 1 || !errors.Is(reporter.errs[0], traffic.ErrNoOpsToSchedule) {
+		t.Fatalf("expected the traffic error to be reported, got %v", reporter.errs)
+	}
+	if !reporter.finalised || !reporter.cancelled {
+		t.Fatal("expected the reporter to be cancelled and finalised")
+	}
+}
+
+var tokenKey = module.NewKey[string]("token") //nolint:gochecknoglobals // shared like a module's key
+
+// authModule publishes a token when it starts.
+type authModule struct {
+	*orderModule
+}
+
+func (m *authModule) RunContext(ctx context.Context) error {
+	m.log.add("run " + m.Name())
+	module.Publish(module.RegistryFrom(ctx), tokenKey, "secret")
+	return nil
+}
+
+// ordersModule depends on the auth module for its token.
+type ordersModule struct {
+	*orderModule
+}
+
+func (m *ordersModule) DependsOn() []string {
+	return []string{"auth"}
+}
+
+func TestExecute_Dependencies(t *testing.T) {
+	log := &eventLog{}
+	auth := &authModule{orderModule: newOrderModule("auth", log)}
+	orders := &ordersModule{orderModule: newOrderModule("orders", log)}
+	orders.SetOps[0].DoCtx = func(ctx context.Context) (module.Result, error) {
+		token, err := module.Lookup(module.RegistryFrom(ctx), tokenKey)
+		if err == nil && token != "secret" {
+			err = errors.New("unexpected token")
+		}
+		return module.Result{}, err
+	}
+
+	rep, err := Execute(context.Background(), &Config{
+		Modules:  module.Modules{orders, auth},
+		Rates:    map[string]uint{"auth.op": 600, "orders.op": 600},
+		Duration: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"run auth", "run orders", "stop orders", "stop auth"}; !slices.Equal(log.list(), want) {
+		t.Fatalf("expected %v, got %v", want, log.list())
+	}
+	if op := rep.Operation("orders", "op"); op == nil || op.Executions == 0 || op.NOK != 0 {
+		t.Fatal("expected the orders operation to find the token")
+	}
+}
+
+func TestExecute_Feeder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "skus.jsonl")
+	if err := os.WriteFile(path, []byte("{\"sku\":\"a\"}\n{\"sku\":\"b\"}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	log := &eventLog{}
+	skus := &module.Feeder{Name: "skus", Strategy: module.FeedUnique, EndTest: true}
+	mod := newOrderModule("shop", log)
+	mod.SetArgs = module.Args{skus.Arg()}
+	mod.SetOps[0].Feeders = []*module.Feeder{skus}
+	mod.SetOps[0].DoCtx = func(ctx context.Context) (module.Result, error) {
+		if skus.Record(ctx)["sku"] == "" {
+			return module.Result{}, errors.New("missing sku")
+		}
+		return module.Result{}, nil
+	}
+
+	start := time.Now()
+	rep, err := Execute(context.Background(), &Config{
+		Modules:  module.Modules{mod},
+		Args:     map[string]string{"shop.skus-feed": path},
+		Rates:    map[string]uint{"shop.op": 60000},
+		Duration: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected execute to stop once the feeder is exhausted, took %s", elapsed)
+	}
+	if op := rep.Operation("shop", "op"); op == nil || op.Executions != 2 || op.NOK != 0 {
+		t.Fatal("expected an execution per sku")
+	}
+}
+
+func TestExecute_FeederLoadFailure(t *testing.T) {
+	log := &eventLog{}
+	skus := &module.Feeder{Name: "skus"}
+	mod := newOrderModule("shop", log)
+	mod.SetArgs = module.Args{skus.Arg()}
+	mod.SetOps[0].Feeders = []*module.Feeder{skus}
+
+	_, err := Execute(context.Background(), &Config{
+		Modules:  module.Modules{mod},
+		Args:     map[string]string{"shop.skus-feed": filepath.Join(t.TempDir(), "missing.csv")},
+		Duration: time.Minute,
+	})
+	if !errors.Is(err, module.ErrFeederLoad) {
+		t.Fatalf("expected error %v, but got %v", module.ErrFeederLoad, err)
+	}
+	if events := log.list(); len(events) != 0 {
+		t.Fatalf("expected no module to start, got %v", events)
+	}
+}
+
+func TestExecute_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(delay *int) *Config
+		want error
+	}{
+		{
+			name: "missing required arg",
+			cfg: func(delay *int) *Config {
+				return &Config{
+					Modules: module.Modules{newExecuteMock(delay)},
+					Rates:   map[string]uint{"mock.ok": 60, "mock.fail": 60},
+				}
+			},
+			want: module.ErrArgRequired,
+		},
+		{
+			name: "unknown arg",
+			cfg: func(delay *int) *Config {
+				return &Config{
+					Modules: module.Modules{newExecuteMock(delay)},
+					Args:    map[string]string{"mock.delay": "1", "mock.unknown": "1"},
+				}
+			},
+			want: ErrConfig,
+		},
+		{
+			name: "unknown op rate",
+			cfg: func(delay *int) *Config {
+				return &Config{
+					Modules: module.Modules{newExecuteMock(delay)},
+					Args:    map[string]string{"mock.delay": "1"},
+					Rates:   map[string]uint{"mock.unknown": 60},
+				}
+			},
+			want: ErrConfig,
+		},
+		{
+			name: "malformed rate key",
+			cfg: func(delay *int) *Config {
+				return &Config{
+					Modules: module.Modules{newExecuteMock(delay)},
+					Args:    map[string]string{"mock.delay": "1"},
+					Rates:   map[string]uint{"mock": 60},
+				}
+			},
+			want: ErrConfig,
+		},
+		{
+			name: "negative duration",
+			cfg: func(delay *int) *Config {
+				return &Config{
+					Modules:  module.Modules{newExecuteMock(delay)},
+					Args:     map[string]string{"mock.delay": "1"},
+					Duration: -time.Second,
+				}
+			},
+			want: ErrConfig,
+		},
+		{
+			name: "unknown abort action",
+			cfg: func(delay *int) *Config {
+				return &Config{
+					Modules: module.Modules{newExecuteMock(delay)},
+					Args:    map[string]string{"mock.delay": "1"},
+					Abort:   traffic.AbortConditions{ConsecutiveFailures: 1, Action: "explode"},
+				}
+			},
+			want: traffic.ErrAbortAction,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay := 0
+			rep, err := Execute(context.Background(), tt.cfg(&delay))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if rep != nil {
+				t.Fatal("expected no report")
+			}
+		})
+	}
+}
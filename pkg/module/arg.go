@@ -0,0 +1,142 @@
+package module
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArgValue is the formatted value of an argument.
+type ArgValue struct {
+	// Name of the argument.
+	Name string
+	// Value of the argument formatted by FormatValue, or Redacted if the argument is secret.
+	Value string
+	// Secret is set if the argument is secret.
+	Secret bool
+}
+
+// Redacted replaces the value of secret arguments.
+const Redacted = "******"
+
+// Values returns the current values of the arguments, in order. The values of
+// secret arguments are redacted.
+func (a Args) Values() []ArgValue {
+	values := make([]ArgValue, 0, len(a))
+	for _, argument := range a {
+		switch arg := argument.(type) {
+		case *Arg[int]:
+			values = append(values, arg.value())
+		case *Arg[uint]:
+			values = append(values, arg.value())
+		case *Arg[float64]:
+			values = append(values, arg.value())
+		case *Arg[string]:
+			values = append(values, arg.value())
+		case *Arg[bool]:
+			values = append(values, arg.value())
+		case *Arg[time.Duration]:
+			values = append(values, arg.value())
+		case *Arg[[]string]:
+			values = append(values, arg.value())
+		case *Arg[[]int]:
+			values = append(values, arg.value())
+		case *Arg[map[string]string]:
+			values = append(values, arg.value())
+		}
+	}
+
+	return values
+}
+
+// validate checks that the defaults of the arguments are among their choices.
+func (a Args) validate() error {
+	for _, argument := range a {
+		var err error
+		switch arg := argument.(type) {
+		case *Arg[int]:
+			err = arg.validate()
+		case *Arg[uint]:
+			err = arg.validate()
+		case *Arg[float64]:
+			err = arg.validate()
+		case *Arg[string]:
+			err = arg.validate()
+		case *Arg[bool]:
+			err = arg.validate()
+		case *Arg[time.Duration]:
+			err = arg.validate()
+		case *Arg[[]string]:
+			err = arg.validate()
+		case *Arg[[]int]:
+			err = arg.validate()
+		case *Arg[map[string]string]:
+			err = arg.validate()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FormatValue formats an argument value the way it is given on the command
+// line. Lists are comma-separated and maps are comma-separated key=value
+// pairs, sorted by key.
+func FormatValue(value any) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case []int:
+		parts := make([]string, len(v))
+		for i, n := range v {
+			parts[i] = strconv.Itoa(n)
+		}
+		return strings.Join(parts, ",")
+	case map[string]string:
+		parts := make([]string, 0, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			parts = append(parts, k+"="+v[k])
+		}
+		return strings.Join(parts, ",")
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+func (a *Arg[T]) value() ArgValue {
+	v := ArgValue{Name: a.Name, Secret: a.Secret}
+	switch {
+	case a.Secret:
+		v.Value = Redacted
+	case a.Value != nil:
+		v.Value = FormatValue(*a.Value)
+	}
+
+	return v
+}
+
+// validate checks that the argument is not a list or map with choices, and
+// that its default, unless it is the zero value, is one of its choices.
+func (a *Arg[T]) validate() error {
+	if len(a.Choices) == 0 {
+		return nil
+	}
+	if kind := reflect.TypeFor[T]().Kind(); kind == reflect.Slice || kind == reflect.Map {
+		return fmt.Errorf("%w: argument '%s'", ErrArgChoiceType, a.Name)
+	}
+	if a.Value == nil || reflect.ValueOf(*a.Value).IsZero() {
+		return nil
+	}
+
+	if !slices.ContainsFunc(a.Choices, func(c T) bool { return reflect.DeepEqual(c, *a.Value) }) {
+		return fmt.Errorf("%w: argument '%s' defaults to '%s'", ErrArgChoice, a.Name, FormatValue(*a.Value))
+	}
+
+	return nil
+}
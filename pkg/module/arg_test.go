@@ -0,0 +1,35 @@
+package module_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+)
+
+func TestArgValues(t *testing.T) {
+	count := 12
+	token := "secret"
+	delay := time.Second
+	headers := map[string]string{"b": "2", "a": "1"}
+
+	values := module.Args{
+		&module.Arg[int]{Name: "count", Value: &count},
+		&module.Arg[string]{Name: "token", Value: &token, Secret: true},
+		&module.Arg[time.Duration]{Name: "delay", Value: &delay},
+		&module.Arg[map[string]string]{Name: "headers", Value: &headers},
+		&module.Arg[[]int]{Name: "unset", Handler: func([]int) {}},
+	}.Values()
+
+	expected := []module.ArgValue{
+		{Name: "count", Value: "12"},
+		{Name: "token", Value: module.Redacted, Secret: true},
+		{Name: "delay", Value: "1s"},
+		{Name: "headers", Value: "a=1,b=2"},
+		{Name: "unset", Value: ""},
+	}
+	if !slices.Equal(values, expected) {
+		t.Fatalf("expected %v, got %v", expected, values)
+	}
+}
@@ -0,0 +1,102 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Dependent is an optional interface of a Module that depends on other
+// modules, such as on one obtaining the tokens its operations need. The
+// modules named by DependsOn, case-insensitively like their flags, are started
+// before it and stopped after it.
+type Dependent interface {
+	DependsOn() []string
+}
+
+var (
+	ErrMissingDependency = errors.New("dependency is missing")
+	ErrDependencyCycle   = errors.New("dependency cycle")
+)
+
+// Order returns the metadata ordered so that every module comes after the
+// modules it depends on, and otherwise in the given order. Modules are started
+// in this order and stopped in reverse.
+func Order(metadata Metadata) (Metadata, error) {
+	modules := make(Modules, len(metadata))
+	for i, m := range metadata {
+		modules[i] = m.Module
+	}
+
+	order, err := dependencyOrder(modules)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make(Metadata, len(order))
+	for i, j := range order {
+		ordered[i] = metadata[j]
+	}
+
+	return ordered, nil
+}
+
+// dependencyOrder returns the indices of the modules in the order of Order. An
+// error is returned if a module depends on one that is not among them, or if
+// modules depend on each other in a cycle.
+func dependencyOrder(modules Modules) ([]int, error) {
+	index := make(map[string]int, len(modules))
+	for i, mod := range modules {
+		index[strings.ToLower(mod.Name())] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(modules))
+	order := make([]int, 0, len(modules))
+	// path holds the names of the modules being visited, to describe a cycle.
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := path[slices.Index(path, modules[i].Name()):]
+			return fmt.Errorf("%w: %s -> %s", ErrDependencyCycle, strings.Join(cycle, " -> "), modules[i].Name())
+		}
+
+		state[i] = visiting
+		path = append(path, modules[i].Name())
+		if dependent, ok := modules[i].(Dependent); ok {
+			for _, dep := range dependent.DependsOn() {
+				j, ok := index[strings.ToLower(dep)]
+				if !ok {
+					return fmt.Errorf("%w: module '%s' depends on unknown module '%s'", ErrMissingDependency,
+						modules[i].Name(), dep)
+				}
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		order = append(order, i)
+
+		return nil
+	}
+
+	for i := range modules {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
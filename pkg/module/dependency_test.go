@@ -0,0 +1,96 @@
+package module_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+)
+
+// dependentModule is a module depending on the modules named by deps.
+type dependentModule struct {
+	*modulemock.Module
+	deps []string
+}
+
+func (m *dependentModule) DependsOn() []string {
+	return m.deps
+}
+
+func newDependent(name string, deps ...string) module.Module {
+	return &dependentModule{Module: &modulemock.Module{SetName: name}, deps: deps}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	t.Run("missing dependency", func(t *testing.T) {
+		err := module.Validate(module.Modules{newDependent("orders", "auth")})
+		if !errors.Is(err, module.ErrMissingDependency) {
+			t.Fatalf("expected error %v, but got %v", module.ErrMissingDependency, err)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		err := module.Validate(module.Modules{
+			newDependent("orders", "auth"),
+			newDependent("auth", "catalog"),
+			newDependent("catalog", "auth"),
+		})
+		if !errors.Is(err, module.ErrDependencyCycle) {
+			t.Fatalf("expected error %v, but got %v", module.ErrDependencyCycle, err)
+		}
+		if want := "dependency cycle: auth -> catalog -> auth"; err.Error() != want {
+			t.Fatalf("expected error %q, but got %q", want, err)
+		}
+	})
+
+	t.Run("dependency in another case", func(t *testing.T) {
+		err := module.Validate(module.Modules{newDependent("orders", "Auth"), newDependent("auth")})
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+	})
+
+	t.Run("valid dependencies", func(t *testing.T) {
+		err := module.Validate(module.Modules{newDependent("orders", "auth"), newDependent("auth")})
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+	})
+}
+
+func TestOrder(t *testing.T) {
+	metadata := module.Metadata{
+		{Module: newDependent("orders", "auth", "catalog")},
+		{Module: newDependent("reports")},
+		{Module: newDependent("catalog", "auth")},
+		{Module: newDependent("auth")},
+	}
+
+	ordered, err := module.Order(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, m := range ordered {
+		names = append(names, m.Name())
+	}
+	if want := []string{"auth", "catalog", "orders", "reports"}; !slices.Equal(names, want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+}
+
+func TestOrderCase(t *testing.T) {
+	ordered, err := module.Order(module.Metadata{
+		{Module: newDependent("orders", "DB")},
+		{Module: newDependent("db")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ordered[0].Name() != "db" || ordered[1].Name() != "orders" {
+		t.Fatalf("expected db before orders, got %s, %s", ordered[0].Name(), ordered[1].Name())
+	}
+}
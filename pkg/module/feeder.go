@@ -0,0 +1,244 @@
+package module
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type (
+	// Feeder feeds records of test data, such as user IDs or search terms, from
+	// a CSV or JSON lines file to the invocations of operations. An operation
+	// takes the next record of each of its Feeders before every invocation, and
+	// reads it from the invocation context with Record. It is safe for
+	// concurrent use.
+	Feeder struct {
+		// Name of the feeder, used to name its path argument.
+		Name string
+		// Path of the file to load records from. Set it with the argument returned
+		// by Arg to take it from the command line or the test model file.
+		Path string
+		// Format of the file. Defaults to the format of the file extension, csv
+		// for .csv and jsonl for .jsonl and .ndjson.
+		Format FeedFormat
+		// Strategy the records are fed in. Defaults to FeedCircular.
+		Strategy FeedStrategy
+		// EndTest, if set, ends the test when the records of a FeedSequential or
+		// FeedUnique feeder are exhausted. Otherwise, invocations fail once they
+		// are.
+		EndTest bool
+
+		lock    sync.Mutex
+		records []Record
+		next    int
+	}
+
+	// Record is a record of test data, keyed by field. The fields of a CSV file
+	// are named by its header row. JSON values that are not strings are kept as
+	// JSON text.
+	Record map[string]string
+
+	// FeedFormat is the format of a feeder file.
+	FeedFormat string
+
+	// FeedStrategy is the order records are fed in.
+	FeedStrategy string
+
+	// feederKey is the context key of the record of a feeder.
+	feederKey struct {
+		feeder *Feeder
+	}
+)
+
+const (
+	// FeedCSV files have a header row naming the fields of the records below
+	// it.
+	FeedCSV FeedFormat = "csv"
+	// FeedJSONLines files have a JSON object per line.
+	FeedJSONLines FeedFormat = "jsonl"
+
+	// FeedSequential feeds the records in file order, once.
+	FeedSequential FeedStrategy = "sequential"
+	// FeedRandom feeds a random record every time.
+	FeedRandom FeedStrategy = "random"
+	// FeedCircular feeds the records in file order, starting over after the last.
+	FeedCircular FeedStrategy = "circular"
+	// FeedUnique feeds every record once, in random order.
+	FeedUnique FeedStrategy = "unique"
+)
+
+var (
+	ErrFeederExhausted = errors.New("feeder is exhausted")
+	ErrFeederLoad      = errors.New("failed to load feeder")
+)
+
+// Arg returns an argument setting the path of the feeder, named
+// "<name>-feed". It is required unless the feeder has a default path.
+func (f *Feeder) Arg() *Arg[string] {
+	return &Arg[string]{
+		Name:     f.Name + "-feed",
+		Desc:     fmt.Sprintf("Path of the CSV or JSON lines file the %s feeder loads records from.", f.Name),
+		Required: f.Path == "",
+		Value:    &f.Path,
+	}
+}
+
+// Load reads the records of the feeder from its path, replacing any loaded
+// before. Arbiter loads the feeders of all operations before the modules are
+// started.
+func (f *Feeder) Load() error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrFeederLoad, f.Name, err)
+	}
+	defer file.Close()
+
+	format := f.Format
+	if format == "" {
+		format = formatOf(f.Path)
+	}
+
+	var records []Record
+	switch format {
+	case FeedCSV:
+		records, err = readCSV(file)
+	case FeedJSONLines:
+		records, err = readJSONLines(file)
+	default:
+		err = fmt.Errorf("unknown format of %s, use .csv, .jsonl or .ndjson", f.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrFeederLoad, f.Name, err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("%w %s: %s has no records", ErrFeederLoad, f.Name, f.Path)
+	}
+
+	switch f.Strategy {
+	case "", FeedSequential, FeedRandom, FeedCircular:
+	case FeedUnique:
+		rand.Shuffle(len(records), func(i, j int) { records[i], records[j] = records[j], records[i] })
+	default:
+		return fmt.Errorf("%w %s: unknown strategy %q", ErrFeederLoad, f.Name, f.Strategy)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.records = records
+	f.next = 0
+
+	return nil
+}
+
+// Next returns the next record according to the strategy of the feeder. An
+// error wrapping ErrFeederExhausted is returned once a FeedSequential or
+// FeedUnique feeder has fed all its records.
+func (f *Feeder) Next() (Record, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if len(f.records) == 0 {
+		return nil, fmt.Errorf("%w: %s has no records loaded", ErrFeederExhausted, f.Name)
+	}
+
+	switch f.Strategy {
+	case FeedRandom:
+		return f.records[rand.IntN(len(f.records))], nil
+	case FeedSequential, FeedUnique:
+		if f.next >= len(f.records) {
+			return nil, fmt.Errorf("%w: %s fed all %d records", ErrFeederExhausted, f.Name, len(f.records))
+		}
+	default:
+		f.next %= len(f.records)
+	}
+
+	record := f.records[f.next]
+	f.next++
+
+	return record, nil
+}
+
+// Record returns the record of the feeder taken for the invocation with ctx,
+// or nil if the operation is not fed by the feeder.
+func (f *Feeder) Record(ctx context.Context) Record {
+	record, _ := ctx.Value(feederKey{feeder: f}).(Record)
+	return record
+}
+
+// WithRecord returns a copy of ctx that carries a record of the feeder.
+// Arbiter feeds the invocations of operations with it.
+func WithRecord(ctx context.Context, f *Feeder, record Record) context.Context {
+	return context.WithValue(ctx, feederKey{feeder: f}, record)
+}
+
+// formatOf returns the feeder format of a path by its extension.
+func formatOf(path string) FeedFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FeedCSV
+	case ".jsonl", ".ndjson":
+		return FeedJSONLines
+	default:
+		return ""
+	}
+}
+
+// readCSV reads records from CSV with a header row.
+func readCSV(r io.Reader) ([]Record, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	header := rows[0]
+	records := make([]Record, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(Record, len(header))
+		for i, field := range header {
+			record[field] = row[i]
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// readJSONLines reads records from a JSON object per line. Empty lines are
+// skipped.
+func readJSONLines(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &object); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		record := make(Record, len(object))
+		for field, raw := range object {
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				record[field] = s
+			} else {
+				record[field] = string(raw)
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
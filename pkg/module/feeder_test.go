@@ -0,0 +1,215 @@
+package module_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/maansaake/arbiter/pkg/module"
+)
+
+func writeFeed(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// feed takes n records of the field from the feeder.
+func feed(t *testing.T, f *module.Feeder, field string, n int) []string {
+	t.Helper()
+
+	values := make([]string, 0, n)
+	for range n {
+		record, err := f.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, record[field])
+	}
+
+	return values
+}
+
+func TestFeederLoad(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+		want                module.Record
+	}{
+		{
+			name:    "csv",
+			file:    "users.csv",
+			content: "id,name\n1,\"Doe, Jane\"\n2,John\n",
+			want:    module.Record{"id": "1", "name": "Doe, Jane"},
+		},
+		{
+			name:    "jsonl",
+			file:    "users.jsonl",
+			content: "{\"id\":\"1\",\"age\":42,\"tags\":[\"a\"]}\n\n{\"id\":\"2\"}\n",
+			want:    module.Record{"id": "1", "age": "42", "tags": `["a"]`},
+		},
+		{
+			name:    "ndjson",
+			file:    "users.ndjson",
+			content: "{\"id\":\"1\"}\n",
+			want:    module.Record{"id": "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &module.Feeder{Name: "users", Path: writeFeed(t, tt.file, tt.content)}
+			if err := f.Load(); err != nil {
+				t.Fatal(err)
+			}
+
+			record, err := f.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(record) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, record)
+			}
+			for field, value := range tt.want {
+				if record[field] != value {
+					t.Fatalf("expected %v, got %v", tt.want, record)
+				}
+			}
+		})
+	}
+}
+
+func TestFeederLoadError(t *testing.T) {
+	tests := []struct {
+		name   string
+		feeder *module.Feeder
+	}{
+		{name: "missing file", feeder: &module.Feeder{Path: filepath.Join(t.TempDir(), "missing.csv")}},
+		{name: "unknown format", feeder: &module.Feeder{Path: writeFeed(t, "users.txt", "id\n1\n")}},
+		{name: "no records", feeder: &module.Feeder{Path: writeFeed(t, "users.csv", "id\n")}},
+		{name: "invalid json", feeder: &module.Feeder{Path: writeFeed(t, "users.jsonl", "{\"id\":\n")}},
+		{
+			name:   "unknown strategy",
+			feeder: &module.Feeder{Path: writeFeed(t, "users.csv", "id\n1\n"), Strategy: "backwards"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.feeder.Load(); !errors.Is(err, module.ErrFeederLoad) {
+				t.Fatalf("expected error %v, but got %v", module.ErrFeederLoad, err)
+			}
+		})
+	}
+}
+
+func TestFeederStrategies(t *testing.T) {
+	path := writeFeed(t, "users.csv", "id\n1\n2\n3\n")
+
+	tests := []struct {
+		strategy  module.FeedStrategy
+		want      []string
+		exhausted bool
+	}{
+		{strategy: "", want: []string{"1", "2", "3", "1", "2"}},
+		{strategy: module.FeedCircular, want: []string{"1", "2", "3", "1", "2"}},
+		{strategy: module.FeedSequential, want: []string{"1", "2", "3"}, exhausted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			f := &module.Feeder{Name: "users", Path: path, Strategy: tt.strategy}
+			if err := f.Load(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := feed(t, f, "id", len(tt.want)); !slices.Equal(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			if _, err := f.Next(); tt.exhausted != errors.Is(err, module.ErrFeederExhausted) {
+				t.Fatalf("expected exhausted %t, got %v", tt.exhausted, err)
+			}
+		})
+	}
+
+	t.Run("random", func(t *testing.T) {
+		f := &module.Feeder{Name: "users", Path: path, Strategy: module.FeedRandom}
+		if err := f.Load(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range feed(t, f, "id", 20) {
+			if !slices.Contains([]string{"1", "2", "3"}, id) {
+				t.Fatalf("unexpected record %s", id)
+			}
+		}
+	})
+}
+
+func TestFeederUnique(t *testing.T) {
+	f := &module.Feeder{Name: "users", Path: writeFeed(t, "users.csv", "id\n1\n2\n3\n4\n5\n"), Strategy: module.FeedUnique}
+	if err := f.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Workers take records concurrently, every record is fed once.
+	var lock sync.Mutex
+	var ids []string
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			record, err := f.Next()
+			if errors.Is(err, module.ErrFeederExhausted) {
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			lock.Lock()
+			ids = append(ids, record["id"])
+			lock.Unlock()
+		})
+	}
+	wg.Wait()
+
+	slices.Sort(ids)
+	if want := []string{"1", "2", "3", "4", "5"}; !slices.Equal(ids, want) {
+		t.Fatalf("expected %v, got %v", want, ids)
+	}
+}
+
+func TestFeederRecord(t *testing.T) {
+	users := &module.Feeder{Name: "users"}
+	skus := &module.Feeder{Name: "skus"}
+
+	ctx := module.WithRecord(context.Background(), users, module.Record{"id": "1"})
+	if record := users.Record(ctx); record["id"] != "1" {
+		t.Fatalf("expected the record of the feeder, got %v", record)
+	}
+	if record := skus.Record(ctx); record != nil {
+		t.Fatalf("expected no record of another feeder, got %v", record)
+	}
+}
+
+func TestFeederArg(t *testing.T) {
+	f := &module.Feeder{Name: "users"}
+	arg := f.Arg()
+	if arg.Name != "users-feed" || !arg.Required {
+		t.Fatalf("expected a required users-feed argument, got %+v", arg)
+	}
+
+	*arg.Value = "users.csv"
+	if f.Path != "users.csv" {
+		t.Fatal("expected the argument to set the path")
+	}
+}
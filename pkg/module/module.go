@@ -1,6 +1,7 @@
 package module
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -24,6 +25,42 @@ type (
 		// Stop is called when the arbiter stops. This can be used to perform any cleanup required by the module.
 		Stop() error
 	}
+	// Readier is an optional interface of a Module that waits for the system
+	// under test to become ready. Ready is called after Run and before traffic
+	// starts, with a context that is cancelled when the ready timeout runs out.
+	Readier interface {
+		Ready(ctx context.Context) error
+	}
+	// ContextRunner is an optional interface of a Module that is started with
+	// the context of the run. RunContext is called instead of Run, with a
+	// context that carries the Registry of the run and is not cancelled before
+	// the module is stopped.
+	ContextRunner interface {
+		RunContext(ctx context.Context) error
+	}
+	// ContextStopper is an optional interface of a Module that stops within a
+	// deadline. StopContext is called instead of Stop, with a context that is
+	// cancelled when the stop timeout runs out.
+	ContextStopper interface {
+		StopContext(ctx context.Context) error
+	}
+	// OpHooks is an optional interface of a Module that sets up and tears down
+	// its operations. Setup is called for each enabled operation once the module
+	// is ready and before traffic starts. Teardown is called for each operation
+	// that was set up once traffic has stopped, before Stop.
+	OpHooks interface {
+		Setup(op string) error
+		Teardown(op string) error
+	}
+	// WorkerHooks is an optional interface of a Module that keeps state per
+	// worker, such as a dedicated connection. WorkerStart is called by each
+	// worker of an operation before its first invocation, and the context it
+	// returns is passed to the invocations of the worker made with DoCtx.
+	// WorkerStop is called with that context when the worker stops.
+	WorkerHooks interface {
+		WorkerStart(ctx context.Context, op string) (context.Context, error)
+		WorkerStop(ctx context.Context, op string) error
+	}
 	// Modules is a list of Module.
 	Modules []Module
 	// Meta is a collection type to help coordination between packages without relying on
@@ -45,8 +82,18 @@ type (
 		Disabled bool
 		// Do is the function that will be executed for the operation.
 		Do
+		// DoCtx, if set, is executed for the operation instead of Do, with the
+		// context of the worker invoking it.
+		DoCtx func(ctx context.Context) (Result, error)
 		// Rate is the number of times the operation should be executed per second. If zero, the operation will be executed as fast as possible.
 		Rate uint
+		// MaxConcurrency is the maximum number of concurrent invocations of the operation. If zero, the worker limit of the traffic scheduler applies.
+		MaxConcurrency uint
+		// Iterations is the number of times the operation should be executed, after which it is no longer scheduled. If zero, the operation is executed until the test ends.
+		Iterations uint
+		// Feeders feed each invocation of the operation a record, read from the invocation context with Feeder.Record.
+		// Only invocations made with DoCtx can read the records.
+		Feeders []*Feeder
 	}
 	// Ops is a list of Op.
 	Ops []*Op
@@ -55,10 +102,13 @@ type (
 	// Result is the result of an operation.
 	Result struct {
 		Duration time.Duration
+		// Tags are optional key-value pairs attached to a single invocation. They are
+		// not aggregated, but are included by reporters that record every invocation.
+		Tags map[string]string
 	}
 	// TypeConstraint is a constraint that allows only certain types for the argument value.
 	TypeConstraint interface {
-		~int | ~uint | ~float64 | ~string | ~bool
+		~int | ~uint | ~float64 | ~string | ~bool | time.Duration | []string | []int | map[string]string
 	}
 	Arg[T TypeConstraint] struct {
 		// Name of the argument. This is used to name CLI and file options when
@@ -80,6 +130,21 @@ type (
 		Handler func(v T)
 		// Valid is a validator function for the argument value.
 		Valid Validator[T]
+		// Env is the name of an environment variable the argument can be set from.
+		// Defaults to ABTR_<MODULE>_<ARG>, upper-cased and with other characters
+		// than letters and digits replaced by underscores. A flag takes precedence
+		// over the environment variable, which takes precedence over a test model
+		// file.
+		Env string
+		// Secret marks the value as sensitive. Its default is never shown in the
+		// CLI help and it is redacted in logs, reports and the TUI. A secret can
+		// also be read from a file given by the <name>-file flag.
+		Secret bool
+		// Choices, if set, restricts the argument to one of the given values. The
+		// choices are listed in the CLI help and the generated file. A default
+		// other than the zero value must be one of them. Lists and maps cannot
+		// have choices.
+		Choices []T
 	}
 	// Args is a list of arguments that a module accepts.
 	Args []any
@@ -97,6 +162,8 @@ var (
 	ErrInvalidName    = errors.New("name is invalid")
 	ErrArgParse       = errors.New("failed to parse argument")
 	ErrArgRequired    = errors.New("argument is required")
+	ErrArgChoice      = errors.New("default is not one of the choices")
+	ErrArgChoiceType  = errors.New("choices are not supported for lists and maps")
 )
 
 const (
@@ -104,8 +171,20 @@ const (
 	opNamePattern     = moduleNamePattern
 )
 
+// Invoke executes the operation, with DoCtx if set and otherwise with Do.
+func (op *Op) Invoke(ctx context.Context) (Result, error) {
+	if op.DoCtx != nil {
+		return op.DoCtx(ctx)
+	}
+
+	return op.Do()
+}
+
 // Validate verifies input modules follow the rules, which are:
 // - The module is not named using any of the reserved prefixes.
+// - Module and operation names follow their patterns.
+// - Arguments with choices default to one of them, or to the zero value.
+// - Modules only depend on other input modules, and not in a cycle.
 func Validate(modules Modules) error {
 	for _, mod := range modules {
 		if slices.Contains(reservedPrefixes, strings.ToLower(mod.Name())) {
@@ -121,6 +200,10 @@ func Validate(modules Modules) error {
 			)
 		}
 
+		if err := mod.Args().validate(); err != nil {
+			return fmt.Errorf("module '%s': %w", mod.Name(), err)
+		}
+
 		for _, op := range mod.Ops() {
 			if !opNameRe.MatchString(op.Name) {
 				return fmt.Errorf(
@@ -132,5 +215,7 @@ func Validate(modules Modules) error {
 			}
 		}
 	}
-	return nil
+
+	_, err := dependencyOrder(modules)
+	return err
 }
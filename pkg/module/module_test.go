@@ -50,6 +50,44 @@ func TestValidateModules(t *testing.T) {
 		}
 	})
 
+	t.Run("default not a choice", func(t *testing.T) {
+		mode := "delete"
+		mod := modulemock.NewMock()
+		mod.SetName = "valid"
+		mod.SetArgs = module.Args{
+			&module.Arg[string]{Name: "mode", Value: &mode, Choices: []string{"read", "write"}},
+		}
+		err := module.Validate(module.Modules{mod})
+		if !errors.Is(err, module.ErrArgChoice) {
+			t.Fatalf("expected error %v, but got %v", module.ErrArgChoice, err)
+		}
+
+		for _, mode = range []string{"read", ""} {
+			if err = module.Validate(module.Modules{mod}); err != nil {
+				t.Fatalf("expected no error for default %q, but got %v", mode, err)
+			}
+		}
+	})
+
+	t.Run("choices of lists and maps", func(t *testing.T) {
+		for _, arg := range []any{
+			&module.Arg[[]int]{Name: "sizes", Value: &[]int{1, 2}, Choices: [][]int{{1, 2}, {2, 3}}},
+			&module.Arg[[]string]{Name: "modes", Value: new([]string), Choices: [][]string{{"read"}}},
+			&module.Arg[map[string]string]{
+				Name:    "headers",
+				Value:   new(map[string]string),
+				Choices: []map[string]string{{"Accept": "text/html"}},
+			},
+		} {
+			mod := modulemock.NewMock()
+			mod.SetName = "valid"
+			mod.SetArgs = module.Args{arg}
+			if err := module.Validate(module.Modules{mod}); !errors.Is(err, module.ErrArgChoiceType) {
+				t.Fatalf("expected error %v, but got %v", module.ErrArgChoiceType, err)
+			}
+		}
+	})
+
 	t.Run("invalid op name", func(t *testing.T) {
 		mod := modulemock.NewMock()
 		mod.SetName = "valid"
@@ -0,0 +1,91 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type (
+	// Registry holds resources that modules share during a run, such as clients
+	// or tokens. A module publishes a resource when it starts, and the modules
+	// depending on it look it up. It is safe for concurrent use.
+	Registry struct {
+		lock      sync.RWMutex
+		resources map[string]any
+	}
+
+	// Key identifies a resource of type T in a Registry. Modules sharing a
+	// resource use keys of the same name and type, typically a package-level
+	// variable of the publishing module.
+	Key[T any] struct {
+		name string
+	}
+
+	// registryKey is the context key of the Registry.
+	registryKey struct{}
+)
+
+var (
+	ErrNotPublished = errors.New("resource is not published")
+	ErrResourceType = errors.New("resource has another type")
+)
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{resources: make(map[string]any)}
+}
+
+// NewKey creates a key of a resource of type T.
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+// Name returns the name of the resource.
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// Publish stores a resource in the registry under key, replacing any earlier
+// resource of the same name.
+func Publish[T any](r *Registry, key Key[T], v T) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.resources[key.name] = v
+}
+
+// Lookup returns the resource stored under key. An error is returned if no
+// resource of the name is published, or if it is of another type.
+func Lookup[T any](r *Registry, key Key[T]) (T, error) {
+	r.lock.RLock()
+	resource, ok := r.resources[key.name]
+	r.lock.RUnlock()
+
+	var zero T
+	if !ok {
+		return zero, fmt.Errorf("%w: '%s'", ErrNotPublished, key.name)
+	}
+
+	v, ok := resource.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: '%s' is a %T, not a %s", ErrResourceType, key.name, resource, reflect.TypeFor[T]())
+	}
+
+	return v, nil
+}
+
+// WithRegistry returns a copy of ctx that carries the registry.
+func WithRegistry(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, r)
+}
+
+// RegistryFrom returns the registry carried by ctx, or nil if it carries none.
+// The contexts that Arbiter passes to modules during a run carry the registry
+// of the run.
+func RegistryFrom(ctx context.Context) *Registry {
+	r, _ := ctx.Value(registryKey{}).(*Registry)
+	return r
+}
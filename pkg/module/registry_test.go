@@ -0,0 +1,39 @@
+package module_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/maansaake/arbiter/pkg/module"
+)
+
+func TestRegistry(t *testing.T) {
+	tokenKey := module.NewKey[string]("token")
+	r := module.NewRegistry()
+
+	if _, err := module.Lookup(r, tokenKey); !errors.Is(err, module.ErrNotPublished) {
+		t.Fatalf("expected error %v, but got %v", module.ErrNotPublished, err)
+	}
+
+	module.Publish(r, tokenKey, "secret")
+	token, err := module.Lookup(r, tokenKey)
+	if err != nil || token != "secret" {
+		t.Fatalf("expected the published token, got %q, %v", token, err)
+	}
+
+	if _, err = module.Lookup(r, module.NewKey[int]("token")); !errors.Is(err, module.ErrResourceType) {
+		t.Fatalf("expected error %v, but got %v", module.ErrResourceType, err)
+	}
+}
+
+func TestRegistryContext(t *testing.T) {
+	if module.RegistryFrom(context.Background()) != nil {
+		t.Fatal("expected no registry")
+	}
+
+	r := module.NewRegistry()
+	if module.RegistryFrom(module.WithRegistry(context.Background(), r)) != r {
+		t.Fatal("expected the registry of the context")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/maansaake/arbiter/pkg/module"
 	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
 )
 
 // reporter dispatches every reporter interface call to each of its child
@@ -15,7 +16,12 @@ type reporter struct {
 	reporters []report.Reporter
 }
 
-var _ report.Reporter = &reporter{}
+var (
+	_ report.Reporter         = &reporter{}
+	_ report.RateReporter     = &reporter{}
+	_ report.AbortReporter    = &reporter{}
+	_ report.RunEventReporter = &reporter{}
+)
 
 // New returns a Reporter that delegates to each of the provided reporters.
 func New(reporters ...report.Reporter) report.Reporter {
@@ -43,6 +49,36 @@ func (r *reporter) ReportOp(mod, op string, res *module.Result, err error) {
 	}
 }
 
+// ReportRate implements report.RateReporter. Samples are passed on to the child
+// reporters that implement report.RateReporter.
+func (r *reporter) ReportRate(mod, op string, sample *stats.RateSample) {
+	for _, rep := range r.reporters {
+		if rr, ok := rep.(report.RateReporter); ok {
+			rr.ReportRate(mod, op, sample)
+		}
+	}
+}
+
+// ReportAbort implements report.AbortReporter. Aborts are passed on to the
+// child reporters that implement report.AbortReporter.
+func (r *reporter) ReportAbort(mod, op string, abort *stats.Abort) {
+	for _, rep := range r.reporters {
+		if ar, ok := rep.(report.AbortReporter); ok {
+			ar.ReportAbort(mod, op, abort)
+		}
+	}
+}
+
+// ReportRunEvent implements report.RunEventReporter. Events are passed on to
+// the child reporters that implement report.RunEventReporter.
+func (r *reporter) ReportRunEvent(event *stats.RunEvent) {
+	for _, rep := range r.reporters {
+		if er, ok := rep.(report.RunEventReporter); ok {
+			er.ReportRunEvent(event)
+		}
+	}
+}
+
 // Finalise implements report.Reporter. Reporters are finalised in registration
 // order; all errors are joined and returned.
 func (r *reporter) Finalise() error {
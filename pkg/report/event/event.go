@@ -0,0 +1,246 @@
+// Package eventreport provides a reporter that streams every operation
+// invocation as a raw record to a file, for offline analysis of outliers.
+package eventreport
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report"
+)
+
+type (
+	// Format is the encoding used for the event stream.
+	Format string
+
+	// Opts contains options for the event stream reporter.
+	Opts struct {
+		// Path of the event stream file. The file is created when the reporter is started.
+		Path string
+		// Format of the records, defaults to FormatNDJSON.
+		Format Format
+		// Gzip, if set, compresses the event stream with gzip.
+		Gzip bool
+		// SampleRate is the fraction of invocations to record, in the range (0, 1].
+		// Values outside of the range record every invocation.
+		SampleRate float64
+		// Buffer sets the number of records that can be queued for the background
+		// writer. When the queue is full, records are dropped rather than blocking
+		// the traffic go-routines. Values < 1 will be ignored.
+		Buffer int
+		// Logger is the logger used for info-level logging by the reporter.
+		Logger logr.Logger
+	}
+
+	// reporter implements the reporter interface.
+	reporter struct {
+		path       string
+		format     Format
+		gzip       bool
+		sampleRate float64
+		logger     logr.Logger
+
+		// records is the queue drained by the background writer.
+		records chan *record
+		// dropped counts records that did not fit in the queue.
+		dropped atomic.Uint64
+		// err holds the first error encountered by the background writer.
+		err     error
+		stopped chan struct{}
+	}
+)
+
+const (
+	// FormatNDJSON writes one JSON object per line.
+	FormatNDJSON Format = "ndjson"
+	// FormatCSV writes one CSV row per record, with a header row.
+	FormatCSV Format = "csv"
+
+	defaultBuffer     = 10000
+	flushInterval     = time.Second
+	writerBufferBytes = 64 * 1024
+)
+
+var (
+	_ report.Reporter = &reporter{}
+
+	// ErrFormat is returned for unknown event stream formats.
+	ErrFormat = errors.New("unsupported event format")
+)
+
+// ParseFormat returns the Format matching s, or an error if s is not a known format.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatNDJSON, FormatCSV:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("%w: '%s'", ErrFormat, s)
+}
+
+// New creates a new event stream reporter.
+func New(opts *Opts) report.Reporter {
+	buffer := defaultBuffer
+	if opts.Buffer > 0 {
+		buffer = opts.Buffer
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = FormatNDJSON
+	}
+
+	sampleRate := opts.SampleRate
+	if sampleRate <= 0 || sampleRate > 1 {
+		sampleRate = 1
+	}
+
+	return &reporter{
+		path:       opts.Path,
+		format:     format,
+		gzip:       opts.Gzip,
+		sampleRate: sampleRate,
+		logger:     opts.Logger,
+		records:    make(chan *record, buffer),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// Start opens the event stream file and runs the background writer until the
+// context is cancelled. Records still queued at that point are written before
+// the writer stops.
+func (r *reporter) Start(ctx context.Context) {
+	r.logger.Info("Starting event reporter", "path", r.path, "format", r.format, "gzip", r.gzip)
+
+	file, err := os.Create(r.path)
+	if err != nil {
+		r.err = err
+		close(r.stopped)
+		return
+	}
+
+	go func() {
+		defer close(r.stopped)
+		r.err = r.write(ctx, file)
+	}()
+}
+
+func (r *reporter) ReportError(_ error) {
+	// no-op
+}
+
+// ReportOp queues a record for the invocation, unless it is sampled out or the
+// queue is full.
+func (r *reporter) ReportOp(mod, op string, res *module.Result, err error) {
+	//nolint:gosec // sampling does not require a cryptographically secure source
+	if r.sampleRate < 1 && rand.Float64() >= r.sampleRate {
+		return
+	}
+
+	rec := &record{
+		Timestamp: time.Now(),
+		Module:    mod,
+		Op:        op,
+		Duration:  res.Duration,
+		OK:        err == nil,
+		Tags:      res.Tags,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	select {
+	case r.records <- rec:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Finalise waits for the background writer to drain the queue and close the file.
+func (r *reporter) Finalise() error {
+	<-r.stopped
+
+	if dropped := r.dropped.Load(); dropped > 0 {
+		r.logger.Info("Event records were dropped due to a full queue", "dropped", dropped)
+	}
+
+	return r.err
+}
+
+/*INTERNAL*/
+
+// write drains the record queue into file until ctx is done. The buffered
+// output is flushed periodically so that the stream can be followed while the
+// test is running.
+func (r *reporter) write(ctx context.Context, file *os.File) error {
+	var (
+		out     io.Writer
+		gzipOut *gzip.Writer
+	)
+
+	buffered := bufio.NewWriterSize(file, writerBufferBytes)
+	out = buffered
+	if r.gzip {
+		gzipOut = gzip.NewWriter(buffered)
+		out = gzipOut
+	}
+	enc := newEncoder(r.format, out)
+
+	flush := func() error {
+		if err := enc.flush(); err != nil {
+			return err
+		}
+		if gzipOut != nil {
+			if err := gzipOut.Flush(); err != nil {
+				return err
+			}
+		}
+		return buffered.Flush()
+	}
+
+	closeAll := func(err error) error {
+		err = errors.Join(err, enc.flush())
+		if gzipOut != nil {
+			err = errors.Join(err, gzipOut.Close())
+		}
+		return errors.Join(err, buffered.Flush(), file.Close())
+	}
+
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+
+	for {
+		select {
+		case rec := <-r.records:
+			if err := enc.encode(rec); err != nil {
+				return closeAll(err)
+			}
+		case <-flushTicker.C:
+			if err := flush(); err != nil {
+				return closeAll(err)
+			}
+		case <-ctx.Done():
+			r.logger.Info("Event reporter context closed, draining queue", "len", len(r.records))
+			for {
+				select {
+				case rec := <-r.records:
+					if err := enc.encode(rec); err != nil {
+						return closeAll(err)
+					}
+				default:
+					return closeAll(nil)
+				}
+			}
+		}
+	}
+}
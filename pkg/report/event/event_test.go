@@ -0,0 +1,123 @@
+package eventreport
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/maansaake/arbiter/pkg/module"
+)
+
+func TestNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	r := New(&Opts{Path: path, Logger: logr.Discard()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	r.ReportOp("mod", "op", &module.Result{Duration: time.Second, Tags: map[string]string{"k": "v"}}, nil)
+	r.ReportOp("mod", "op", &module.Result{Duration: time.Millisecond}, errors.New("operation error"))
+
+	cancel()
+	if err := r.Finalise(); err != nil {
+		t.Fatal("error on finalise:", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []*record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rec := &record{}
+		if err = json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			t.Fatal("failed to unmarshal record:", err)
+		}
+		records = append(records, rec)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if !records[0].OK || records[0].Duration != time.Second || records[0].Tags["k"] != "v" {
+		t.Fatal("unexpected first record", records[0])
+	}
+	if records[1].OK || records[1].Error != "operation error" {
+		t.Fatal("unexpected second record", records[1])
+	}
+}
+
+func TestCSVGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.csv.gz")
+	r := New(&Opts{Path: path, Format: FormatCSV, Gzip: true, Logger: logr.Discard()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	r.ReportOp("mod", "op", &module.Result{Duration: time.Second}, nil)
+	r.ReportOp("mod", "op", &module.Result{Duration: time.Second, Tags: map[string]string{"b": "2", "a": "1"}}, nil)
+
+	cancel()
+	if err := r.Finalise(); err != nil {
+		t.Fatal("error on finalise:", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(gz).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %d rows", len(rows))
+	}
+	if rows[0][0] != "timestamp" {
+		t.Fatal("expected header row")
+	}
+	if rows[2][6] != "a=1;b=2" {
+		t.Fatal("unexpected tags column:", rows[2][6])
+	}
+}
+
+func TestDropWhenFull(t *testing.T) {
+	r := New(&Opts{Path: filepath.Join(t.TempDir(), "events"), Buffer: 1, Logger: logr.Discard()})
+	rep := r.(*reporter)
+
+	// The writer is not started, so the second record does not fit.
+	rep.ReportOp("mod", "op", &module.Result{}, nil)
+	rep.ReportOp("mod", "op", &module.Result{}, nil)
+
+	if rep.dropped.Load() != 1 {
+		t.Fatal("expected 1 dropped record")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if _, err := ParseFormat("csv"); err != nil {
+		t.Fatal("csv should be a valid format")
+	}
+	if _, err := ParseFormat("xml"); !errors.Is(err, ErrFormat) {
+		t.Fatal("expected ErrFormat, got", err)
+	}
+}
@@ -0,0 +1,107 @@
+package eventreport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// record is a single operation invocation as written to the event stream.
+	record struct {
+		Timestamp time.Time         `json:"timestamp"`
+		Module    string            `json:"module"`
+		Op        string            `json:"op"`
+		Duration  time.Duration     `json:"duration_ns"`
+		OK        bool              `json:"ok"`
+		Error     string            `json:"error,omitempty"`
+		Tags      map[string]string `json:"tags,omitempty"`
+	}
+
+	// encoder writes records to an underlying writer in a specific format.
+	encoder interface {
+		encode(rec *record) error
+		flush() error
+	}
+
+	// ndjsonEncoder writes one JSON object per line.
+	ndjsonEncoder struct {
+		enc *json.Encoder
+	}
+
+	// csvEncoder writes one CSV row per record, preceded by a header row.
+	csvEncoder struct {
+		w             *csv.Writer
+		headerWritten bool
+	}
+)
+
+// csvHeader lists the CSV columns in the order they are written.
+//
+//nolint:gochecknoglobals // constant-like list of column names
+var csvHeader = []string{"timestamp", "module", "op", "duration_ns", "ok", "error", "tags"}
+
+func newEncoder(format Format, w io.Writer) encoder {
+	if format == FormatCSV {
+		return &csvEncoder{w: csv.NewWriter(w)}
+	}
+
+	return &ndjsonEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *ndjsonEncoder) encode(rec *record) error {
+	return e.enc.Encode(rec)
+}
+
+func (e *ndjsonEncoder) flush() error {
+	return nil
+}
+
+func (e *csvEncoder) encode(rec *record) error {
+	if !e.headerWritten {
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+		e.headerWritten = true
+	}
+
+	return e.w.Write([]string{
+		rec.Timestamp.Format(time.RFC3339Nano),
+		rec.Module,
+		rec.Op,
+		strconv.FormatInt(rec.Duration.Nanoseconds(), 10),
+		strconv.FormatBool(rec.OK),
+		rec.Error,
+		formatTags(rec.Tags),
+	})
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// formatTags renders tags as semicolon separated key=value pairs, sorted by key
+// so that the output is stable.
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	for i, k := range slices.Sorted(maps.Keys(tags)) {
+		if i > 0 {
+			sb.WriteString(";")
+		}
+		sb.WriteString(k)
+		sb.WriteString("=")
+		sb.WriteString(tags[k])
+	}
+
+	return sb.String()
+}
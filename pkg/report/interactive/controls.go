@@ -0,0 +1,304 @@
+package interactivereport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/maansaake/arbiter/pkg/module"
+)
+
+type (
+	// Controller changes running traffic from the TUI. It is implemented by
+	// traffic.Scheduler.
+	Controller interface {
+		SetRate(mod, op string, rate uint) error
+		SetEnabled(mod, op string, enabled bool) error
+		Pause() error
+		Resume() error
+	}
+
+	// opRef refers to an operation of a module.
+	opRef struct {
+		mod string
+		op  *module.Op
+	}
+)
+
+const (
+	// rateStep divides a rate into the step it is changed by with + and -, a
+	// tenth of it but at least 1.
+	rateStep = 10
+	// maxRateInput is the maximum number of digits of a typed rate.
+	maxRateInput = 9
+)
+
+// Help texts listing the keys of the TUI.
+const (
+	selectHelp  = "↑/↓ select · enter details · e errors · / filter · s sort (%s) · t table/boxes"
+	detailHelp  = "enter/esc back · pgup/pgdn scroll · e errors"
+	errorsHelp  = "↑/↓ pgup/pgdn scroll · e/esc back"
+	controlHelp = "+/- rate · r type rate · d disable/enable · p pause/resume"
+	summaryHelp = "pgup/pgdn scroll · e errors"
+	doneHelp    = "tab summary/operations"
+	exportHelp  = "w write report"
+	stopHelp    = "ctrl+c stop"
+	quitHelp    = "ctrl+c quit"
+)
+
+// handleKey handles a key press other than ctrl+c: selecting an operation,
+// showing its details or changing traffic.
+func (m *model) handleKey(msg tea.KeyMsg) {
+	if m.editing {
+		m.handleRateInput(msg)
+		return
+	}
+	if m.filtering {
+		m.handleFilterInput(msg)
+		return
+	}
+	if m.exporting {
+		m.handleExportInput(msg)
+		return
+	}
+	if m.done && m.handleSummaryKey(msg) {
+		return
+	}
+
+	if msg.String() == "e" {
+		m.showErrors = !m.showErrors
+		m.scroll = 0
+		m.scrollToSelected()
+		return
+	}
+	if m.showErrors {
+		m.handleErrorsKey(msg)
+		return
+	}
+
+	switch msg.String() {
+	case "pgup":
+		m.scrollBody(-m.bodyHeight(m.viewWidth()))
+		return
+	case "pgdown":
+		m.scrollBody(m.bodyHeight(m.viewWidth()))
+		return
+	}
+	if m.showSummary {
+		return
+	}
+
+	switch msg.String() {
+	case "enter":
+		m.detail = !m.detail
+		m.scroll = 0
+		m.scrollToSelected()
+		return
+	case "esc":
+		// Esc steps back out of the detail view first, then clears the filter.
+		if !m.detail {
+			m.filter = ""
+		}
+		m.detail = false
+		m.scroll = 0
+		m.scrollToSelected()
+		return
+	}
+	if m.detail {
+		m.handleControlKey(msg)
+		return
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		m.moveSelection(-1)
+	case "down", "j":
+		m.moveSelection(1)
+	case "/":
+		m.filtering = true
+	case "s":
+		m.sort = (m.sort + 1) % sortOrders
+		m.scrollToSelected()
+	case "t":
+		m.table = !m.table
+		m.scroll = 0
+		m.scrollToSelected()
+	default:
+		m.handleControlKey(msg)
+	}
+}
+
+// handleSummaryKey switches between the summary and the operations, or starts
+// typing the path to write the report to, once the test is done. It reports
+// whether the key was handled.
+func (m *model) handleSummaryKey(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "tab":
+		m.showSummary = !m.showSummary
+		m.showErrors = false
+		m.scroll = 0
+		m.scrollToSelected()
+	case "w":
+		if m.export == nil {
+			return false
+		}
+		m.exporting = true
+		m.exportMsg = ""
+	default:
+		return false
+	}
+
+	return true
+}
+
+// handleErrorsKey scrolls or closes the error pane.
+func (m *model) handleErrorsKey(msg tea.KeyMsg) {
+	switch msg.String() {
+	case "up", "k":
+		m.scrollErrors(-1)
+	case "down", "j":
+		m.scrollErrors(1)
+	case "pgup":
+		m.scrollErrors(-m.errorRows())
+	case "pgdown":
+		m.scrollErrors(m.errorRows())
+	case "home", "g":
+		m.errScroll = 0
+	case "esc":
+		m.showErrors = false
+	}
+}
+
+// handleControlKey changes traffic according to a key press. Keys are ignored
+// if the TUI has no controller or traffic is no longer running.
+func (m *model) handleControlKey(msg tea.KeyMsg) {
+	selected, ok := m.selectedOp()
+	if !ok || !m.controlling() {
+		return
+	}
+
+	switch msg.String() {
+	case "+", "=":
+		rate := m.rate(selected)
+		m.setRate(selected, rate+max(rate/rateStep, 1))
+	case "-":
+		rate := m.rate(selected)
+		m.setRate(selected, max(rate-min(max(rate/rateStep, 1), rate), 1))
+	case "r":
+		m.editing = true
+		m.input = ""
+	case "d":
+		disabled := !m.disabled[opKey(selected)]
+		m.control(func() error { return m.controller.SetEnabled(selected.mod, selected.op.Name, !disabled) }, func() {
+			m.disabled[opKey(selected)] = disabled
+		})
+	case "p":
+		pause := m.controller.Pause
+		if m.paused {
+			pause = m.controller.Resume
+		}
+		m.control(pause, func() { m.paused = !m.paused })
+	}
+}
+
+// handleRateInput edits the typed rate of the selected operation, which is
+// applied with enter and discarded with esc.
+func (m *model) handleRateInput(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.editing = false
+		rate, err := strconv.ParseUint(m.input, 10, 0)
+		if err != nil || rate == 0 {
+			m.controlErr = "rate must be a positive number"
+			return
+		}
+		if selected, ok := m.selectedOp(); ok && m.controlling() {
+			m.setRate(selected, uint(rate))
+		}
+	case tea.KeyEsc:
+		m.editing = false
+	case tea.KeyBackspace:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case tea.KeyRunes:
+		for _, r := range msg.Runes {
+			if r >= '0' && r <= '9' && len(m.input) < maxRateInput {
+				m.input += string(r)
+			}
+		}
+	default:
+	}
+}
+
+// setRate sets the rate of an operation.
+func (m *model) setRate(ref opRef, rate uint) {
+	m.control(func() error { return m.controller.SetRate(ref.mod, ref.op.Name, rate) }, func() {
+		m.rates[opKey(ref)] = rate
+	})
+}
+
+// control calls f to change traffic, and then apply to update the TUI if it
+// succeeded. An error is shown in the footer until the next control.
+func (m *model) control(f func() error, apply func()) {
+	if err := f(); err != nil {
+		m.controlErr = err.Error()
+		return
+	}
+
+	m.controlErr = ""
+	apply()
+}
+
+// help returns the keys that can be pressed.
+func (m *model) help() string {
+	stop := stopHelp
+	if m.done {
+		stop = quitHelp
+	}
+
+	keys := []string{fmt.Sprintf(selectHelp, m.sort)}
+	if m.filter != "" {
+		keys = append(keys, "filter: /"+m.filter)
+	}
+	switch {
+	case m.showErrors:
+		keys = []string{errorsHelp}
+	case m.showSummary:
+		keys = []string{summaryHelp}
+	case m.detail:
+		keys = []string{detailHelp}
+	}
+	if m.controlling() && !m.showErrors {
+		keys = append(keys, controlHelp)
+	}
+	if m.done {
+		keys = append(keys, doneHelp)
+	}
+	if m.done && m.export != nil {
+		keys = append(keys, exportHelp)
+	}
+
+	return strings.Join(append(keys, stop), " · ")
+}
+
+// controlling reports whether the TUI can change traffic.
+func (m *model) controlling() bool {
+	return m.controller != nil && !m.trafficDone
+}
+
+// rate returns the current rate of an operation, as set from the TUI or
+// configured.
+func (m *model) rate(ref opRef) uint {
+	if rate, ok := m.rates[opKey(ref)]; ok {
+		return rate
+	}
+
+	return ref.op.Rate
+}
+
+// opKey returns the key of an operation in the maps of the model.
+func opKey(ref opRef) string {
+	return ref.mod + "." + ref.op.Name
+}
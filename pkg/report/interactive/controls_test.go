@@ -0,0 +1,150 @@
+package interactivereport
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+// testController records the rates set from the TUI, and fails with err if
+// set.
+type testController struct {
+	rates map[string]uint
+	err   error
+}
+
+func (c *testController) SetRate(mod, op string, rate uint) error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.rates == nil {
+		c.rates = make(map[string]uint)
+	}
+	c.rates[mod+"."+op] = rate
+	return nil
+}
+
+func (c *testController) SetEnabled(string, string, bool) error { return c.err }
+func (c *testController) Pause() error                          { return c.err }
+func (c *testController) Resume() error                         { return c.err }
+
+// newTestModel creates a model of a module named mod with the ops.
+func newTestModel(controller Controller, ops ...*module.Op) *model {
+	metadata := module.Metadata{{Module: &modulemock.Module{SetName: "mod", SetOps: ops}}}
+	return newModel(metadata, stats.NewCollector(), newErrorLog(), time.Minute, func() {}, controller)
+}
+
+// key returns the message of pressing a key.
+func key(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestRateStep(t *testing.T) {
+	tests := []struct {
+		key        string
+		rate, want uint
+	}{
+		{key: "+", rate: 0, want: 1},
+		{key: "+", rate: 1, want: 2},
+		{key: "+", rate: 5, want: 6},
+		{key: "+", rate: 100, want: 110},
+		{key: "=", rate: 100, want: 110},
+		{key: "-", rate: 1, want: 1},
+		{key: "-", rate: 2, want: 1},
+		{key: "-", rate: 100, want: 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s at %d", tt.key, tt.rate), func(t *testing.T) {
+			controller := &testController{}
+			op := &module.Op{Name: "op", Rate: tt.rate}
+			m := newTestModel(controller, op)
+
+			m.handleKey(key(tt.key))
+			if controller.rates["mod.op"] != tt.want {
+				t.Fatalf("expected rate %d to be set, got %d", tt.want, controller.rates["mod.op"])
+			}
+			if rate := m.rate(opRef{mod: "mod", op: op}); rate != tt.want {
+				t.Fatalf("expected rate %d to be shown, got %d", tt.want, rate)
+			}
+		})
+	}
+}
+
+func TestRateStepRepeated(t *testing.T) {
+	controller := &testController{}
+	op := &module.Op{Name: "op", Rate: 10}
+	m := newTestModel(controller, op)
+
+	// Steps apply to the rate set from the TUI, not the configured one.
+	for _, want := range []uint{11, 12, 13} {
+		m.handleKey(key("+"))
+		if controller.rates["mod.op"] != want {
+			t.Fatalf("expected rate %d, got %d", want, controller.rates["mod.op"])
+		}
+	}
+}
+
+func TestRateInput(t *testing.T) {
+	controller := &testController{}
+	op := &module.Op{Name: "op", Rate: 10}
+	m := newTestModel(controller, op)
+
+	m.handleKey(key("r"))
+	for _, k := range []string{"2", "x", "5", "0"} {
+		m.handleKey(key(k))
+	}
+	m.handleKey(tea.KeyMsg{Type: tea.KeyBackspace})
+	m.handleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.editing || controller.rates["mod.op"] != 25 {
+		t.Fatalf("expected the typed rate 25, got %d", controller.rates["mod.op"])
+	}
+
+	m.handleKey(key("r"))
+	m.handleKey(key("0"))
+	m.handleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.controlErr == "" || controller.rates["mod.op"] != 25 {
+		t.Fatal("expected a zero rate to be rejected")
+	}
+}
+
+func TestControlFailure(t *testing.T) {
+	controller := &testController{err: errors.New("not running")}
+	op := &module.Op{Name: "op", Rate: 10}
+	m := newTestModel(controller, op)
+
+	m.handleKey(key("+"))
+	if m.controlErr != "not running" || m.rate(opRef{mod: "mod", op: op}) != 10 {
+		t.Fatalf("expected the error and the rate unchanged, got %q", m.controlErr)
+	}
+
+	m.handleKey(key("p"))
+	m.handleKey(key("d"))
+	if m.paused || m.disabled["mod.op"] {
+		t.Fatal("expected failed controls not to be applied")
+	}
+
+	// A control that succeeds clears the error.
+	controller.err = nil
+	m.handleKey(key("p"))
+	if m.controlErr != "" || !m.paused {
+		t.Fatal("expected traffic to be paused")
+	}
+}
+
+func TestControlTrafficDone(t *testing.T) {
+	controller := &testController{}
+	m := newTestModel(controller, &module.Op{Name: "op", Rate: 10})
+	m.trafficDone = true
+
+	m.handleKey(key("+"))
+	if len(controller.rates) != 0 {
+		t.Fatal("expected no control once traffic is done")
+	}
+}
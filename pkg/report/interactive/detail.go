@@ -0,0 +1,162 @@
+package interactivereport
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+const (
+	// maxDistributionRows is the largest number of rows of the latency
+	// distribution in the detail view.
+	maxDistributionRows = 20
+	// distributionLabelW fits a bucket label, e.g. "1.25s – 1.50s".
+	distributionLabelW = 17
+	// distributionCountW fits the count of a bucket.
+	distributionCountW = 9
+)
+
+// renderDetail renders the detail view of the selected operation: its
+// percentiles, throughput and p99 latency over time and the distribution of
+// its latencies. contentW is the inner content width of the view.
+func (m *model) renderDetail(contentW int) string {
+	ref, ok := m.selectedOp()
+	if !ok {
+		return ""
+	}
+
+	var run *stats.HistogramSnapshot
+	if opStats := m.snapshot.Op(ref.mod, ref.op.Name); opStats != nil {
+		run = opStats.Latency
+	}
+	h := m.history[opKey(ref)]
+	window := h.window(percentileWindow)
+	textW := contentW - 2 // padding(2) is included in the width of modBoxStyle
+
+	var sb strings.Builder
+	sb.WriteString(modHeaderStyle.Render("Operation: " + opKey(ref)))
+	sb.WriteString("\n\n")
+
+	// Percentiles over the rolling window and the whole run, side by side.
+	sb.WriteString(colHeaderStyle.Render(fmt.Sprintf("%-8s %10s %10s", "", "last "+formatWindow(), "run")))
+	sb.WriteString("\n")
+	for _, q := range []struct {
+		label string
+		q     float64
+	}{{"p50", p50}, {"p90", p90}, {"p95", p95}, {"p99", p99}, {"p99.9", p999}, {"max", 1}} {
+		sb.WriteString(fmt.Sprintf(
+			"%-8s %10s %10s\n", q.label, formatOpDuration(window.Quantile(q.q)), formatOpDuration(quantile(run, q.q)),
+		))
+	}
+	sb.WriteString("\n")
+
+	sb.WriteString(renderSparklines(h, textW))
+	sb.WriteString("\n\n")
+
+	sb.WriteString(colHeaderStyle.Render("Latency distribution") + doneStyle.Render(" (successful calls, whole run)"))
+	sb.WriteString("\n")
+	sb.WriteString(renderDistribution(run, textW))
+
+	return modBoxStyle.Width(contentW).Render(sb.String())
+}
+
+// renderDistribution renders the latencies of a histogram as horizontal bars,
+// with rows spaced logarithmically between the shortest and longest latency.
+func renderDistribution(latency *stats.HistogramSnapshot, w int) string {
+	if latency == nil || latency.Count() == 0 {
+		return doneStyle.Render("no successful calls yet")
+	}
+
+	var lowest, highest time.Duration = -1, 0
+	latency.Buckets(func(lower, upper time.Duration, _ uint64) {
+		if lowest < 0 {
+			lowest = lower
+		}
+		highest = upper
+	})
+	lowest = max(lowest, 1)
+
+	// Each row covers the same ratio of latencies, so that the tail is visible
+	// next to the bulk of the calls.
+	rows := maxDistributionRows
+	ratio := math.Pow(float64(highest)/float64(lowest), 1/float64(rows))
+	counts := make([]uint64, rows)
+	latency.Buckets(func(lower, _ time.Duration, count uint64) {
+		row := 0
+		if ratio > 1 {
+			row = int(math.Log(float64(max(lower, lowest))/float64(lowest)) / math.Log(ratio))
+		}
+		counts[min(row, rows-1)] += count
+	})
+
+	var top uint64
+	for _, c := range counts {
+		top = max(top, c)
+	}
+
+	barW := max(w-distributionLabelW-distributionCountW-1, 1)
+	var sb strings.Builder
+	for i, c := range counts {
+		lower := time.Duration(float64(lowest) * math.Pow(ratio, float64(i)))
+		upper := time.Duration(float64(lowest) * math.Pow(ratio, float64(i+1)))
+		filled := int(math.Round(float64(c) / float64(top) * float64(barW)))
+
+		sb.WriteString(fmt.Sprintf("%*s ", distributionLabelW,
+			formatOpDuration(lower)+" – "+formatOpDuration(upper)))
+		sb.WriteString(barFilledStyle.Render(strings.Repeat("█", filled)))
+		sb.WriteString(strings.Repeat(" ", barW-filled))
+		sb.WriteString(fmt.Sprintf(" %*d", distributionCountW-1, c))
+		if i < len(counts)-1 {
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// renderSparklines renders the throughput and p99 latency sparklines of an
+// operation over width w, each labelled and followed by its latest value. The
+// sparklines grow from the right until the history fills them.
+func renderSparklines(h *opHistory, w int) string {
+	sparkW := w - sparkLabelW - sparkValueW - 2
+	points := h.points(sparkW)
+	if len(points) == 0 {
+		return doneStyle.Render("no history yet")
+	}
+	pad := strings.Repeat(" ", max(sparkW-len(points), 0))
+
+	last := points[len(points)-1]
+	p99Value := "—"
+	if last.calls {
+		p99Value = formatOpDuration(last.p99)
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		fmt.Sprintf("%-*s %s %*s", sparkLabelW, "calls/min", pad+barFilledStyle.Render(rpmSparkline(points)),
+			sparkValueW, fmt.Sprintf("%.0f", last.rpm)),
+		fmt.Sprintf("%-*s %s %*s", sparkLabelW, "p99", pad+warningStyle.Render(p99Sparkline(points)),
+			sparkValueW, p99Value),
+	)
+}
+
+// quantile returns the quantile q of a histogram, or zero if it is nil.
+func quantile(latency *stats.HistogramSnapshot, q float64) time.Duration {
+	if latency == nil {
+		return 0
+	}
+
+	return latency.Quantile(q)
+}
+
+// formatWindow formats the percentile window, e.g. "1m".
+func formatWindow() string {
+	if percentileWindow%time.Minute == 0 {
+		return fmt.Sprintf("%dm", percentileWindow/time.Minute)
+	}
+
+	return percentileWindow.String()
+}
@@ -0,0 +1,189 @@
+package interactivereport
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// errorLog groups the errors reported during a test by operation and
+	// message. It is safe for concurrent use.
+	errorLog struct {
+		lock sync.Mutex
+		// groups indexes the elements of recent, which holds the groups ordered
+		// by when they were last seen, the most recent first, so that recording
+		// an error and dropping the group seen least recently take constant
+		// time.
+		groups map[errorKey]*list.Element
+		recent *list.List
+	}
+
+	// errorKey identifies a group of errors.
+	errorKey struct {
+		mod, op, msg string
+	}
+
+	// errorGroup counts the errors with the same message of an operation, or of
+	// the test itself if mod and op are empty.
+	errorGroup struct {
+		mod, op, msg string
+		count        uint64
+		// last is the time the latest error of the group was seen.
+		last time.Time
+	}
+)
+
+const (
+	// maxErrorGroups bounds the number of groups kept, as error messages may
+	// contain unique details such as request IDs. The group seen least recently
+	// is dropped first.
+	maxErrorGroups = 500
+	// minErrorRows is the least number of rows of the error pane, and
+	// defaultErrorRows the number shown before the terminal size is known.
+	minErrorRows     = 5
+	defaultErrorRows = 20
+	// errorPaneChrome is the number of lines around the error rows: the header
+	// and separator of the TUI, the borders, title, column headers and scroll
+	// hints of the pane, and the footer.
+	errorPaneChrome = 14
+)
+
+// newErrorLog creates an empty errorLog.
+func newErrorLog() *errorLog {
+	return &errorLog{groups: make(map[errorKey]*list.Element), recent: list.New()}
+}
+
+// record adds an error of an operation seen at now.
+func (l *errorLog) record(mod, op string, err error, now time.Time) {
+	key := errorKey{mod: mod, op: op, msg: err.Error()}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if e, ok := l.groups[key]; ok {
+		g := group(e)
+		g.count++
+		g.last = now
+		l.recent.MoveToFront(e)
+		return
+	}
+
+	if l.recent.Len() >= maxErrorGroups {
+		back := l.recent.Back()
+		oldest := group(back)
+		l.recent.Remove(back)
+		delete(l.groups, errorKey{mod: oldest.mod, op: oldest.op, msg: oldest.msg})
+	}
+	l.groups[key] = l.recent.PushFront(&errorGroup{mod: mod, op: op, msg: key.msg, count: 1, last: now})
+}
+
+// snapshot returns a copy of the groups, the most recently seen first.
+func (l *errorLog) snapshot() []errorGroup {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	groups := make([]errorGroup, 0, l.recent.Len())
+	for e := l.recent.Front(); e != nil; e = e.Next() {
+		groups = append(groups, *group(e))
+	}
+
+	return groups
+}
+
+// group returns the group of an element of errorLog.recent.
+func group(e *list.Element) *errorGroup {
+	return e.Value.(*errorGroup) //nolint:errcheck // only groups are stored
+}
+
+// renderErrors renders the pane of grouped errors, scrolled to m.errScroll.
+// contentW is the inner content width of the pane.
+func (m *model) renderErrors(contentW int) string {
+	textW := contentW - 2 // padding(2) is included in the width of modBoxStyle
+
+	var total uint64
+	for _, g := range m.errors {
+		total += g.count
+	}
+
+	var sb strings.Builder
+	sb.WriteString(modHeaderStyle.Render(fmt.Sprintf("Errors: %d in %d groups", total, len(m.errors))))
+	sb.WriteString("\n\n")
+	if len(m.errors) == 0 {
+		sb.WriteString(doneStyle.Render("no errors yet"))
+		return modBoxStyle.Width(contentW).Render(sb.String())
+	}
+
+	opW := len("operation")
+	for _, g := range m.errors {
+		opW = max(opW, len(g.source()))
+	}
+	opW = min(opW, textW/3) //nolint:mnd // at most a third of the width
+
+	sb.WriteString(colHeaderStyle.Render(
+		fmt.Sprintf("%8s  %-8s  %-*s  %s", "count", "last", opW, "operation", "error"),
+	))
+	sb.WriteString("\n")
+
+	rows := m.errorRows()
+	start := min(m.errScroll, max(len(m.errors)-rows, 0))
+	end := min(start+rows, len(m.errors))
+	sb.WriteString(doneStyle.Render(scrollHint("↑", start)))
+	sb.WriteString("\n")
+	msgW := max(textW-8-2-8-2-opW-2, 1)
+	for _, g := range m.errors[start:end] {
+		sb.WriteString(fmt.Sprintf("%8d  %s  %-*s  %s\n", g.count, g.last.Format(time.TimeOnly),
+			opW, truncate(g.source(), opW), abortStyle.Render(truncate(g.msg, msgW))))
+	}
+	sb.WriteString(doneStyle.Render(scrollHint("↓", len(m.errors)-end)))
+
+	return modBoxStyle.Width(contentW).Render(sb.String())
+}
+
+// errorRows returns the number of error rows that fit on the screen.
+func (m *model) errorRows() int {
+	if m.height == 0 {
+		return defaultErrorRows
+	}
+
+	return max(m.height-errorPaneChrome, minErrorRows)
+}
+
+// scrollErrors scrolls the error pane by n rows, within the rows there are.
+func (m *model) scrollErrors(n int) {
+	m.errScroll = max(min(m.errScroll+n, len(m.errors)-m.errorRows()), 0)
+}
+
+// source returns the operation an error group belongs to, or "arbiter" for
+// errors of the test itself.
+func (g *errorGroup) source() string {
+	if g.mod == "" && g.op == "" {
+		return "arbiter"
+	}
+
+	return g.mod + "." + g.op
+}
+
+// scrollHint tells how many rows are hidden in the direction of arrow, or
+// returns an empty string if none are.
+func scrollHint(arrow string, hidden int) string {
+	if hidden <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s %d more", arrow, hidden)
+}
+
+// truncate shortens s to at most w runes, marking that it was cut with "…".
+// Newlines are replaced, so that an error takes a single row.
+func truncate(s string, w int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	r := []rune(s)
+	if len(r) <= w {
+		return s
+	}
+
+	return string(r[:max(w-1, 0)]) + "…"
+}
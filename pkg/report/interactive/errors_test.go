@@ -0,0 +1,74 @@
+package interactivereport
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestErrorLog(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newErrorLog()
+	l.record("mod", "op", errors.New("timeout"), start)
+	l.record("mod", "op", errors.New("refused"), start.Add(time.Second))
+	l.record("mod", "other", errors.New("timeout"), start.Add(2*time.Second))
+	l.record("", "", errors.New("stop failed"), start.Add(3*time.Second))
+	l.record("mod", "op", errors.New("timeout"), start.Add(4*time.Second))
+
+	groups := l.snapshot()
+	want := []struct {
+		source, msg string
+		count       uint64
+		last        time.Duration
+	}{
+		{source: "mod.op", msg: "timeout", count: 2, last: 4 * time.Second},
+		{source: "arbiter", msg: "stop failed", count: 1, last: 3 * time.Second},
+		{source: "mod.other", msg: "timeout", count: 1, last: 2 * time.Second},
+		{source: "mod.op", msg: "refused", count: 1, last: time.Second},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("expected %d groups, got %+v", len(want), groups)
+	}
+	for i, w := range want {
+		g := groups[i]
+		if g.source() != w.source || g.msg != w.msg || g.count != w.count || !g.last.Equal(start.Add(w.last)) {
+			t.Errorf("group %d: expected %+v, got %+v", i, w, g)
+		}
+	}
+}
+
+func TestErrorLogEviction(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newErrorLog()
+	for i := range maxErrorGroups {
+		l.record("mod", "op", fmt.Errorf("request %d failed", i), start.Add(time.Duration(i)*time.Second))
+	}
+
+	// Seeing the first group again keeps it, the second is then seen least
+	// recently and is dropped for a new group.
+	l.record("mod", "op", errors.New("request 0 failed"), start.Add(time.Hour))
+	l.record("mod", "op", errors.New("new failure"), start.Add(2*time.Hour))
+
+	groups := l.snapshot()
+	if len(groups) != maxErrorGroups {
+		t.Fatalf("expected %d groups, got %d", maxErrorGroups, len(groups))
+	}
+	if groups[0].msg != "new failure" || groups[1].msg != "request 0 failed" || groups[1].count != 2 {
+		t.Fatalf("expected the new and the seen group first, got %+v, %+v", groups[0], groups[1])
+	}
+	for _, g := range groups {
+		if g.msg == "request 1 failed" {
+			t.Fatal("expected the group seen least recently to be dropped")
+		}
+	}
+	if last := groups[len(groups)-1]; last.msg != "request 2 failed" {
+		t.Fatalf("expected the oldest remaining group last, got %+v", last)
+	}
+
+	// The groups removed from the list are removed from the index too.
+	l.record("mod", "op", errors.New("request 1 failed"), start.Add(3*time.Hour))
+	if groups = l.snapshot(); groups[0].msg != "request 1 failed" || groups[0].count != 1 {
+		t.Fatalf("expected a new group for the dropped error, got %+v", groups[0])
+	}
+}
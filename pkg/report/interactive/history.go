@@ -0,0 +1,196 @@
+package interactivereport
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+type (
+	// opHistory holds the results of an operation per refresh interval, the
+	// latest last, covering at most historyLength.
+	opHistory struct {
+		intervals []interval
+	}
+
+	// interval holds the results of an operation within one refresh interval.
+	interval struct {
+		// d is the length of the interval.
+		d time.Duration
+		// delta holds the results recorded in the interval.
+		delta *stats.OpSnapshot
+	}
+
+	// point is a value of a sparkline, for one or more intervals.
+	point struct {
+		rpm float64
+		p99 time.Duration
+		// calls is set if the point has successful calls, so p99 is known.
+		calls bool
+	}
+)
+
+const (
+	// historyLength is the time covered by the sparklines.
+	historyLength = 5 * time.Minute
+	// percentileWindow is the rolling window percentiles are computed over.
+	percentileWindow = time.Minute
+)
+
+// sparks are the levels of a sparkline, from low to high.
+var sparks = []rune("▁▂▃▄▅▆▇█") //nolint:gochecknoglobals // constant runes
+
+// record adds the results of an interval of length d to the history of each
+// operation, from the change between the previous snapshot and the next.
+func (m *model) record(prev, next *stats.Snapshot) {
+	d := next.Time.Sub(prev.Time)
+	if d <= 0 {
+		return
+	}
+
+	for _, op := range next.Ops {
+		key := op.Module + "." + op.Op
+		h, ok := m.history[key]
+		if !ok {
+			h = &opHistory{}
+			m.history[key] = h
+		}
+		h.add(interval{d: d, delta: op.Sub(prev.Op(op.Module, op.Op))})
+	}
+}
+
+// add appends an interval, dropping those older than historyLength.
+func (h *opHistory) add(i interval) {
+	h.intervals = append(h.intervals, i)
+
+	var covered time.Duration
+	for j := len(h.intervals) - 1; j >= 0; j-- {
+		covered += h.intervals[j].d
+		if covered > historyLength {
+			h.intervals = append(h.intervals[:0], h.intervals[j+1:]...)
+			return
+		}
+	}
+}
+
+// window returns the latencies of successful calls within the latest d. A nil
+// history has no latencies.
+func (h *opHistory) window(d time.Duration) *stats.HistogramSnapshot {
+	latency := &stats.HistogramSnapshot{}
+	if h == nil {
+		return latency
+	}
+
+	var covered time.Duration
+	for j := len(h.intervals) - 1; j >= 0 && covered < d; j-- {
+		latency = latency.Add(h.intervals[j].delta.Latency)
+		covered += h.intervals[j].d
+	}
+
+	return latency
+}
+
+// throughput returns the rate per minute of the calls within the latest d. A
+// nil history has no calls.
+func (h *opHistory) throughput(d time.Duration) float64 {
+	if h == nil {
+		return 0
+	}
+
+	var (
+		covered time.Duration
+		calls   uint64
+	)
+	for j := len(h.intervals) - 1; j >= 0 && covered < d; j-- {
+		calls += h.intervals[j].delta.Executions
+		covered += h.intervals[j].d
+	}
+	if covered == 0 {
+		return 0
+	}
+
+	return float64(calls) / covered.Minutes()
+}
+
+// points returns at most n sparkline points, the latest last. If there are
+// more than n intervals, consecutive intervals are merged into one point.
+func (h *opHistory) points(n int) []point {
+	if h == nil || n <= 0 || len(h.intervals) == 0 {
+		return nil
+	}
+
+	per := (len(h.intervals) + n - 1) / n
+	points := make([]point, 0, n)
+	// Merge from the end, so that the latest point is always a full one.
+	for end := len(h.intervals); end > 0; end -= per {
+		var (
+			d       time.Duration
+			calls   uint64
+			latency = &stats.HistogramSnapshot{}
+		)
+		for _, i := range h.intervals[max(end-per, 0):end] {
+			d += i.d
+			calls += i.delta.Executions
+			latency = latency.Add(i.delta.Latency)
+		}
+
+		points = append(points, point{
+			rpm:   float64(calls) / d.Minutes(),
+			p99:   latency.Quantile(p99),
+			calls: latency.Count() > 0,
+		})
+	}
+
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+
+	return points
+}
+
+// sparkline renders values as a line of bars scaled from zero to the largest
+// value. Values marked as unknown are rendered as blanks.
+func sparkline(values []float64, known func(i int) bool) string {
+	var top float64
+	for _, v := range values {
+		top = max(top, v)
+	}
+
+	var sb strings.Builder
+	for i, v := range values {
+		if !known(i) {
+			sb.WriteRune(' ')
+			continue
+		}
+
+		level := 0
+		if top > 0 {
+			level = int(math.Round(v / top * float64(len(sparks)-1)))
+		}
+		sb.WriteRune(sparks[level])
+	}
+
+	return sb.String()
+}
+
+// rpmSparkline renders the throughput of the points.
+func rpmSparkline(points []point) string {
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.rpm
+	}
+
+	return sparkline(values, func(int) bool { return true })
+}
+
+// p99Sparkline renders the p99 latency of the points.
+func p99Sparkline(points []point) string {
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = float64(p.p99)
+	}
+
+	return sparkline(values, func(i int) bool { return points[i].calls })
+}
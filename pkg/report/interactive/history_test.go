@@ -0,0 +1,241 @@
+package interactivereport
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+// testInterval returns an interval of length d with a successful call of each
+// latency.
+func testInterval(d time.Duration, latencies ...time.Duration) interval {
+	var h stats.Histogram
+	for _, l := range latencies {
+		h.Record(l)
+	}
+
+	return interval{d: d, delta: &stats.OpSnapshot{Executions: uint64(len(latencies)), Latency: h.Snapshot()}}
+}
+
+// testHistory returns a history of n intervals of length d, each with a
+// successful call of each latency.
+func testHistory(n int, d time.Duration, latencies ...time.Duration) *opHistory {
+	h := &opHistory{}
+	for range n {
+		h.add(testInterval(d, latencies...))
+	}
+
+	return h
+}
+
+// near reports if got is within the relative error of the histogram of want.
+func near(got, want float64) bool {
+	return math.Abs(got-want) <= want*0.02
+}
+
+func TestHistoryAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		d    time.Duration
+		want int
+	}{
+		{name: "within the history", n: 300, d: time.Second, want: 300},
+		{name: "beyond the history", n: 301, d: time.Second, want: 300},
+		{name: "long intervals", n: 4, d: 2 * time.Minute, want: 2},
+		{name: "interval longer than the history", n: 2, d: 6 * time.Minute, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if h := testHistory(tt.n, tt.d); len(h.intervals) != tt.want {
+				t.Fatalf("expected %d intervals, got %d", tt.want, len(h.intervals))
+			}
+		})
+	}
+}
+
+func TestHistoryWindow(t *testing.T) {
+	// A minute of slow calls followed by a minute of fast ones.
+	h := testHistory(60, time.Second, time.Second)
+	for range 60 {
+		h.add(testInterval(time.Second, time.Millisecond))
+	}
+
+	tests := []struct {
+		name  string
+		h     *opHistory
+		d     time.Duration
+		count uint64
+		p99   time.Duration
+	}{
+		{name: "percentile window", h: h, d: percentileWindow, count: 60, p99: time.Millisecond},
+		{name: "full history", h: h, d: historyLength, count: 120, p99: time.Second},
+		{name: "partial interval", h: h, d: time.Second / 2, count: 1, p99: time.Millisecond},
+		{name: "empty history", h: &opHistory{}, d: percentileWindow},
+		{name: "nil history", d: percentileWindow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latency := tt.h.window(tt.d)
+			if latency.Count() != tt.count {
+				t.Fatalf("expected %d calls, got %d", tt.count, latency.Count())
+			}
+			if p99 := latency.Quantile(p99); !near(float64(p99), float64(tt.p99)) {
+				t.Fatalf("expected p99 %s, got %s", tt.p99, p99)
+			}
+		})
+	}
+}
+
+func TestHistoryThroughput(t *testing.T) {
+	// A minute without calls followed by a minute of 2 calls per second.
+	h := testHistory(60, time.Second)
+	for range 60 {
+		h.add(testInterval(time.Second, time.Millisecond, time.Millisecond))
+	}
+
+	tests := []struct {
+		name string
+		h    *opHistory
+		d    time.Duration
+		want float64
+	}{
+		{name: "latest minute", h: h, d: time.Minute, want: 120},
+		{name: "full history", h: h, d: historyLength, want: 60},
+		{name: "empty history", h: &opHistory{}, d: time.Minute},
+		{name: "nil history", d: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.h.throughput(tt.d); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("expected %f calls per minute, got %f", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHistoryPoints(t *testing.T) {
+	// Intervals of 1 to 5 calls per second.
+	h := &opHistory{}
+	for i := 1; i <= 5; i++ {
+		latencies := make([]time.Duration, i)
+		for j := range latencies {
+			latencies[j] = time.Duration(i) * time.Millisecond
+		}
+		h.add(testInterval(time.Second, latencies...))
+	}
+
+	failed := &opHistory{}
+	failed.add(testInterval(time.Second, time.Millisecond))
+	failed.add(interval{
+		d:     time.Second,
+		delta: &stats.OpSnapshot{Executions: 1, NOK: 1, Latency: &stats.HistogramSnapshot{}},
+	})
+
+	tests := []struct {
+		name string
+		h    *opHistory
+		n    int
+		want []point
+	}{
+		{
+			name: "a point per interval",
+			h:    h,
+			n:    5,
+			want: []point{
+				{rpm: 60, p99: time.Millisecond, calls: true},
+				{rpm: 120, p99: 2 * time.Millisecond, calls: true},
+				{rpm: 180, p99: 3 * time.Millisecond, calls: true},
+				{rpm: 240, p99: 4 * time.Millisecond, calls: true},
+				{rpm: 300, p99: 5 * time.Millisecond, calls: true},
+			},
+		},
+		{
+			// The latest point merges 3 full intervals, the first the 2 left.
+			name: "merged intervals",
+			h:    h,
+			n:    2,
+			want: []point{
+				{rpm: 90, p99: 2 * time.Millisecond, calls: true},
+				{rpm: 240, p99: 5 * time.Millisecond, calls: true},
+			},
+		},
+		{
+			name: "no successful calls",
+			h:    failed,
+			n:    2,
+			want: []point{
+				{rpm: 60, p99: time.Millisecond, calls: true},
+				{rpm: 60},
+			},
+		},
+		{name: "no points", h: h, n: 0},
+		{name: "empty history", h: &opHistory{}, n: 5},
+		{name: "nil history", n: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := tt.h.points(tt.n)
+			if len(points) != len(tt.want) {
+				t.Fatalf("expected %d points, got %+v", len(tt.want), points)
+			}
+			for i, want := range tt.want {
+				got := points[i]
+				if got.calls != want.calls || math.Abs(got.rpm-want.rpm) > 1e-9 ||
+					!near(float64(got.p99), float64(want.p99)) {
+					t.Errorf("point %d: expected %+v, got %+v", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []point
+		rpm    string
+		p99    string
+	}{
+		{
+			name: "scaled to the largest value",
+			points: []point{
+				{rpm: 0, p99: 0, calls: true},
+				{rpm: 10, p99: time.Millisecond, calls: true},
+				{rpm: 20, p99: 2 * time.Millisecond, calls: true},
+				{rpm: 40, p99: 4 * time.Millisecond, calls: true},
+			},
+			rpm: "▁▃▅█",
+			p99: "▁▃▅█",
+		},
+		{
+			name:   "no calls",
+			points: []point{{rpm: 0}, {rpm: 0}},
+			rpm:    "▁▁",
+			p99:    "  ",
+		},
+		{
+			name:   "unknown latency",
+			points: []point{{rpm: 60, p99: time.Millisecond, calls: true}, {rpm: 60}},
+			rpm:    "██",
+			p99:    "█ ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rpmSparkline(tt.points); got != tt.rpm {
+				t.Errorf("expected rate sparkline %q, got %q", tt.rpm, got)
+			}
+			if got := p99Sparkline(tt.points); got != tt.p99 {
+				t.Errorf("expected p99 sparkline %q, got %q", tt.p99, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package interactivereport
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/maansaake/arbiter/pkg/module"
+)
+
+// sortOrder is the order operations are listed in.
+type sortOrder int
+
+const (
+	// sortNone lists operations in the order their modules define them.
+	sortNone sortOrder = iota
+	// sortErrors lists operations with the highest error rate first.
+	sortErrors
+	// sortLatency lists operations with the highest recent p99 latency first.
+	sortLatency
+	// sortThroughput lists operations with the highest recent rate first.
+	sortThroughput
+	sortOrders
+)
+
+const (
+	// tableOpMinW is the least width of the operation column of the table.
+	tableOpMinW = 20
+	// tableColumnsW is the width of the table columns after the operation,
+	// with room for a short status.
+	tableColumnsW = 90
+)
+
+// String returns the name of the order shown in the help.
+func (s sortOrder) String() string {
+	switch s {
+	case sortErrors:
+		return "errors"
+	case sortLatency:
+		return "p99"
+	case sortThroughput:
+		return "rate"
+	default:
+		return "none"
+	}
+}
+
+// rows returns the operations matching the filter, in the order they are
+// displayed. Operations are sorted within their module, or across modules in
+// the table layout.
+func (m *model) rows() []opRef {
+	var metric map[string]float64
+	if m.sort != sortNone {
+		metric = m.sortMetrics()
+	}
+	sortOps := func(ops []opRef) {
+		if m.sort == sortNone {
+			return
+		}
+		slices.SortStableFunc(ops, func(a, b opRef) int {
+			return cmp.Compare(metric[opKey(b)], metric[opKey(a)])
+		})
+	}
+
+	var rows []opRef
+	for _, mod := range m.metadata {
+		start := len(rows)
+		for _, op := range mod.Ops() {
+			if ref := (opRef{mod: mod.Name(), op: op}); m.matches(ref) {
+				rows = append(rows, ref)
+			}
+		}
+		if !m.table {
+			sortOps(rows[start:])
+		}
+	}
+	if m.table {
+		sortOps(rows)
+	}
+
+	return rows
+}
+
+// sortMetrics returns the value each operation is sorted by, keyed by opKey.
+// Operations disabled at the start of the test have no value, and are listed
+// last.
+func (m *model) sortMetrics() map[string]float64 {
+	metric := make(map[string]float64)
+	for _, mod := range m.metadata {
+		for _, op := range mod.Ops() {
+			ref := opRef{mod: mod.Name(), op: op}
+			h := m.history[opKey(ref)]
+
+			switch m.sort {
+			case sortErrors:
+				if opStats := m.snapshot.Op(ref.mod, op.Name); opStats != nil && opStats.Executions > 0 {
+					metric[opKey(ref)] = float64(opStats.NOK) / float64(opStats.Executions)
+				}
+			case sortLatency:
+				metric[opKey(ref)] = float64(h.window(percentileWindow).Quantile(p99))
+			case sortThroughput:
+				metric[opKey(ref)] = h.throughput(percentileWindow)
+			default:
+			}
+		}
+	}
+
+	return metric
+}
+
+// matches reports whether an operation matches the filter, which is a case
+// insensitive part of "<module>.<op>".
+func (m *model) matches(ref opRef) bool {
+	return strings.Contains(strings.ToLower(opKey(ref)), strings.ToLower(m.filter))
+}
+
+// selectable returns the operations that can be selected, in the order they
+// are displayed. Operations disabled at the start of the test are not running
+// and cannot be selected.
+func (m *model) selectable() []opRef {
+	var ops []opRef
+	for _, ref := range m.rows() {
+		if !ref.op.Disabled {
+			ops = append(ops, ref)
+		}
+	}
+
+	return ops
+}
+
+// selectedOp returns the selected operation. The first operation is selected
+// if none is, or the selected one is filtered out.
+func (m *model) selectedOp() (opRef, bool) {
+	ops := m.selectable()
+	if len(ops) == 0 {
+		return opRef{}, false
+	}
+
+	if i := slices.IndexFunc(ops, func(ref opRef) bool { return opKey(ref) == m.selected }); i >= 0 {
+		return ops[i], true
+	}
+
+	return ops[0], true
+}
+
+// isSelected reports whether an operation is selected.
+func (m *model) isSelected(mod string, op *module.Op) bool {
+	selected, ok := m.selectedOp()
+	return ok && selected.mod == mod && selected.op == op
+}
+
+// moveSelection selects the operation n places after the selected one, or
+// before it if n is negative, and scrolls it into view.
+func (m *model) moveSelection(n int) {
+	ops := m.selectable()
+	if len(ops) == 0 {
+		return
+	}
+
+	i := slices.IndexFunc(ops, func(ref opRef) bool { return opKey(ref) == m.selected })
+	if i >= 0 {
+		i = max(min(i+n, len(ops)-1), 0)
+	} else {
+		i = 0
+	}
+	m.selected = opKey(ops[i])
+	m.scrollToSelected()
+}
+
+// handleFilterInput edits the filter, which applies while it is typed. Enter
+// keeps the filter and esc clears it.
+func (m *model) handleFilterInput(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.filtering = false
+	case tea.KeyEsc:
+		m.filtering = false
+		m.filter = ""
+	case tea.KeyBackspace:
+		if r := []rune(m.filter); len(r) > 0 {
+			m.filter = string(r[:len(r)-1])
+		}
+	case tea.KeyRunes:
+		m.filter += string(msg.Runes)
+	default:
+	}
+
+	m.scroll = 0
+	m.scrollToSelected()
+}
+
+// renderBody renders the content between the header and the footer, and
+// returns it with the first and last line of the selected operation within
+// it, or -1 if the selected operation is not shown.
+func (m *model) renderBody(w int) (string, int, int) {
+	contentW := w - 4 // border(2) + padding(2) consumed by modBoxStyle
+
+	switch {
+	case m.showErrors:
+		return m.renderErrors(contentW), -1, -1
+	case m.showSummary:
+		return m.renderSummary(contentW), -1, -1
+	case m.detail:
+		return m.renderDetail(contentW), -1, -1
+	case m.table:
+		return m.renderTable(contentW)
+	}
+
+	rows := m.rows()
+	if len(rows) == 0 {
+		return doneStyle.Render("No operations match /" + m.filter), -1, -1
+	}
+
+	var sb strings.Builder
+	top, bottom := -1, -1
+	for _, mod := range m.metadata {
+		var ops []opRef
+		for _, ref := range rows {
+			if ref.mod == mod.Name() {
+				ops = append(ops, ref)
+			}
+		}
+		if len(ops) == 0 {
+			continue
+		}
+
+		box, boxTop, boxBottom := m.renderModule(mod, ops, contentW)
+		if boxTop >= 0 {
+			offset := strings.Count(sb.String(), "\n")
+			top, bottom = offset+boxTop, offset+boxBottom
+		}
+		sb.WriteString(box)
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n"), top, bottom
+}
+
+// renderTable renders the operations as a table, one row per operation.
+// contentW is the inner content width of the table box.
+func (m *model) renderTable(contentW int) (string, int, int) {
+	rows := m.rows()
+	if len(rows) == 0 {
+		return doneStyle.Render("No operations match /" + m.filter), -1, -1
+	}
+
+	opW := max(contentW-2-2-tableColumnsW, tableOpMinW) // padding(2) and the selection marker(2)
+	format := "%-*s %8s %8s %9s %8s %7s %8s %8s %8s  %s"
+
+	var sb strings.Builder
+	sb.WriteString(colHeaderStyle.Render(fmt.Sprintf("  "+format,
+		opW, "operation", "rate", "rpm 1m", "calls", "failed", "err%", "p50", "p95", "p99", "status")))
+
+	top, bottom := -1, -1
+	for i, ref := range rows {
+		sb.WriteString("\n")
+
+		if ref.op.Disabled {
+			sb.WriteString(opDisabledTextStyle.Render(fmt.Sprintf("  %-*s  [DISABLED]", opW, truncate(opKey(ref), opW))))
+			continue
+		}
+
+		var executions, nok uint64
+		errPerc := "—"
+		if opStats := m.snapshot.Op(ref.mod, ref.op.Name); opStats != nil {
+			executions, nok = opStats.Executions, opStats.NOK
+			if executions > 0 {
+				errPerc = fmt.Sprintf("%.1f%%", float64(nok)/float64(executions)*100) //nolint:mnd // percentage
+			}
+		}
+		h := m.history[opKey(ref)]
+		window := h.window(percentileWindow)
+
+		row := fmt.Sprintf(format, opW, truncate(opKey(ref), opW),
+			fmt.Sprint(m.rate(ref)), fmt.Sprintf("%.0f", h.throughput(percentileWindow)),
+			fmt.Sprint(executions), fmt.Sprint(nok), errPerc,
+			formatOpDuration(window.Quantile(p50)), formatOpDuration(window.Quantile(p95)),
+			formatOpDuration(window.Quantile(p99)), m.opStatus(ref))
+
+		if m.isSelected(ref.mod, ref.op) {
+			// The box border(1) and the header row(1) come before the rows.
+			top, bottom = i+2, i+2
+			sb.WriteString(selectedRowStyle.Render("▶ " + row))
+		} else {
+			sb.WriteString("  " + row)
+		}
+	}
+
+	return modBoxStyle.Width(contentW).Render(sb.String()), top, bottom
+}
+
+// opStatus returns a short status of an operation for the table: whether it
+// is disabled from the TUI, or how an abort condition affected it.
+func (m *model) opStatus(ref opRef) string {
+	var status []string
+	if m.disabled[opKey(ref)] {
+		status = append(status, "disabled")
+	}
+
+	if opStats := m.snapshot.Op(ref.mod, ref.op.Name); opStats != nil && len(opStats.Aborts) > 0 {
+		last := opStats.Aborts[len(opStats.Aborts)-1]
+		status = append(status, fmt.Sprintf("abort: %s", last.Action))
+	}
+
+	return strings.Join(status, ", ")
+}
+
+// viewport fits body into h lines. A body that is too long is scrolled to
+// m.scroll, with a line telling how much is hidden in its place of the last.
+// A shorter one is padded so that the footer stays at the bottom.
+func (m *model) viewport(body string, h int) string {
+	lines := strings.Split(body, "\n")
+	if len(lines) <= h {
+		return body + strings.Repeat("\n", h-len(lines))
+	}
+
+	visible := max(h-1, 1)
+	offset := max(min(m.scroll, len(lines)-visible), 0)
+	hint := fmt.Sprintf("↑ %d · ↓ %d more lines, pgup/pgdn to scroll", offset, len(lines)-offset-visible)
+
+	return strings.Join(lines[offset:offset+visible], "\n") + "\n" + doneStyle.Render(hint)
+}
+
+// bodyHeight returns the number of lines between the header and footer. The
+// top ends with a newline, so its height includes the blank line below it.
+func (m *model) bodyHeight(w int) int {
+	return m.height - lipgloss.Height(m.renderTop(w)) - lipgloss.Height(m.renderFooter())
+}
+
+// scrollBody scrolls the body by n lines, within the lines there are.
+func (m *model) scrollBody(n int) {
+	if m.height == 0 {
+		return
+	}
+
+	w := m.viewWidth()
+	body, _, _ := m.renderBody(w)
+	visible := max(m.bodyHeight(w)-1, 1)
+	m.scroll = max(min(m.scroll+n, lipgloss.Height(body)-visible), 0)
+}
+
+// scrollToSelected scrolls the body so that the selected operation is in view.
+func (m *model) scrollToSelected() {
+	if m.height == 0 {
+		return
+	}
+
+	w := m.viewWidth()
+	_, top, bottom := m.renderBody(w)
+	if top < 0 {
+		return
+	}
+
+	visible := max(m.bodyHeight(w)-1, 1)
+	if top < m.scroll {
+		m.scroll = top
+	}
+	if bottom >= m.scroll+visible {
+		m.scroll = min(bottom-visible+1, top)
+	}
+}
@@ -0,0 +1,121 @@
+package interactivereport
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+// newSortModel creates a model of two modules, whose operations differ in
+// error rate, latency and throughput:
+//
+//	a.x: no errors, p99 10ms, 60 calls per minute
+//	a.y: 1 in 2 calls fail, p99 1ms, 180 calls per minute
+//	b.z: 1 in 4 calls fail, p99 100ms, 120 calls per minute
+//	b.off: disabled at the start
+func newSortModel() *model {
+	metadata := module.Metadata{
+		{Module: &modulemock.Module{SetName: "a", SetOps: module.Ops{{Name: "x"}, {Name: "y"}}}},
+		{Module: &modulemock.Module{SetName: "b", SetOps: module.Ops{{Name: "z"}, {Name: "off", Disabled: true}}}},
+	}
+
+	collector := stats.NewCollector()
+	ok := &module.Result{Duration: time.Millisecond}
+	collector.Record("a", "x", ok, nil)
+	collector.Record("a", "y", ok, nil)
+	collector.Record("a", "y", nil, errors.New("failed"))
+	for range 3 {
+		collector.Record("b", "z", ok, nil)
+	}
+	collector.Record("b", "z", nil, errors.New("failed"))
+
+	m := newModel(metadata, collector, newErrorLog(), time.Minute, func() {}, &testController{})
+	m.history["a.x"] = testHistory(60, time.Second, 10*time.Millisecond)
+	m.history["a.y"] = testHistory(60, time.Second, time.Millisecond, time.Millisecond, time.Millisecond)
+	m.history["b.z"] = testHistory(60, time.Second, 100*time.Millisecond, 100*time.Millisecond)
+
+	return m
+}
+
+func TestRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   sortOrder
+		table  bool
+		filter string
+		want   []string
+	}{
+		{name: "module order", want: []string{"a.x", "a.y", "b.z", "b.off"}},
+		{name: "errors within modules", sort: sortErrors, want: []string{"a.y", "a.x", "b.z", "b.off"}},
+		{name: "p99 within modules", sort: sortLatency, want: []string{"a.x", "a.y", "b.z", "b.off"}},
+		{name: "rate within modules", sort: sortThroughput, want: []string{"a.y", "a.x", "b.z", "b.off"}},
+		{name: "table module order", table: true, want: []string{"a.x", "a.y", "b.z", "b.off"}},
+		{name: "table errors", sort: sortErrors, table: true, want: []string{"a.y", "b.z", "a.x", "b.off"}},
+		{name: "table p99", sort: sortLatency, table: true, want: []string{"b.z", "a.x", "a.y", "b.off"}},
+		{name: "table rate", sort: sortThroughput, table: true, want: []string{"a.y", "b.z", "a.x", "b.off"}},
+		{name: "filter by module", filter: "b.", want: []string{"b.z", "b.off"}},
+		{name: "filter by operation", filter: "Y", want: []string{"a.y"}},
+		{name: "filter sorted", sort: sortErrors, table: true, filter: "z", want: []string{"b.z"}},
+		{name: "filter without match", filter: "c.", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newSortModel()
+			m.sort, m.table, m.filter = tt.sort, tt.table, tt.filter
+
+			got := []string{}
+			for _, ref := range m.rows() {
+				got = append(got, opKey(ref))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	m := newTestModel(&testController{})
+	ref := opRef{mod: "Orders", op: &module.Op{Name: "placeOrder"}}
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{filter: "", want: true},
+		{filter: "orders", want: true},
+		{filter: "PLACE", want: true},
+		{filter: "s.p", want: true},
+		{filter: "orders.placeorder", want: true},
+		{filter: "cancel", want: false},
+		{filter: "placeorder.orders", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			m.filter = tt.filter
+			if got := m.matches(ref); got != tt.want {
+				t.Fatalf("expected match %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSelectable(t *testing.T) {
+	m := newSortModel()
+	m.sort, m.table = sortLatency, true
+
+	var got []string
+	for _, ref := range m.selectable() {
+		got = append(got, opKey(ref))
+	}
+	if want := []string{"b.z", "a.x", "a.y"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
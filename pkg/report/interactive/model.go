@@ -10,19 +10,13 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
 )
 
 type (
 	// Message types exchanged with the bubbletea program.
 
-	// opMsg is sent when an operation is executed, containing the module and operation
-	// name and whether the call was successful.
-	opMsg struct {
-		mod      string
-		op       string
-		ok       bool
-		duration time.Duration
-	}
 	// errMsg is sent when an error is reported via ReportError.
 	errMsg struct {
 		err error
@@ -37,7 +31,19 @@ type (
 	// model is the bubbletea model for the interactive TUI.
 	model struct {
 		metadata module.Metadata
-		stats    map[string]map[string]*opStats
+		// collector aggregates the operation results, it is read on every tick.
+		collector *stats.Collector
+		// snapshot is the latest snapshot of the collector.
+		snapshot *stats.Snapshot
+		// history holds the recent results of each operation, keyed by opKey.
+		history map[string]*opHistory
+		// errLog groups the reported errors, it is read on every tick into
+		// errors. showErrors is set while the error pane is shown, scrolled down
+		// by errScroll rows.
+		errLog     *errorLog
+		errors     []errorGroup
+		showErrors bool
+		errScroll  int
 
 		errMsg      string
 		trafficDone bool
@@ -54,16 +60,44 @@ type (
 		// delivery (bubbletea runs in raw terminal mode and consumes the key
 		// event before the OS raises the signal).
 		trafficCancel func()
-	}
 
-	// opStats holds the running totals for a single operation.
-	opStats struct {
-		executions    uint
-		ok            uint
-		nok           uint
-		totalDuration time.Duration
-		minDuration   time.Duration
-		maxDuration   time.Duration
+		// controller changes running traffic, nil if the TUI only displays it.
+		controller Controller
+		// selected is the opKey of the selected operation, and detail set while
+		// its detail view is shown.
+		selected string
+		detail   bool
+		// table is set for the compact layout, with a row per operation rather
+		// than a box. Operations are listed in sort order, matching filter,
+		// which is being typed while filtering is set.
+		table     bool
+		sort      sortOrder
+		filter    string
+		filtering bool
+		// scroll is the first line of the body shown, if it does not fit.
+		scroll int
+		// rates are the rates set from the TUI, and disabled the operations
+		// disabled from it, keyed by opKey.
+		rates    map[string]uint
+		disabled map[string]bool
+		paused   bool
+		// editing is set while a rate is typed into input.
+		editing bool
+		input   string
+		// controlErr is the error of the last control, if it failed.
+		controlErr string
+
+		// thresholds are checked in the summary, which is shown while
+		// showSummary is set.
+		thresholds  report.Thresholds
+		showSummary bool
+		// export writes the report to a path, nil if it cannot. exporting is set
+		// while the path is typed into exportPath, and exportMsg holds the result
+		// of the last export.
+		export     func(path string) error
+		exporting  bool
+		exportPath string
+		exportMsg  string
 	}
 )
 
@@ -75,6 +109,17 @@ const (
 	callsLabelW     = 8 // len("success:")
 	timingLabelW    = 4 // len("avg:")
 	headerMinGap    = 2
+	sparkLabelW     = 9 // len("calls/min")
+	sparkValueW     = 7
+)
+
+// Quantiles shown in the TUI.
+const (
+	p50  = 0.5
+	p90  = 0.9
+	p95  = 0.95
+	p99  = 0.99
+	p999 = 0.999
 )
 
 // Styles used throughout the TUI.
@@ -109,6 +154,16 @@ var (
 			PaddingLeft(1).
 			PaddingRight(1)
 
+	opSelectedBoxStyle = lipgloss.NewStyle().
+				Border(lipgloss.RoundedBorder()).
+				BorderForeground(lipgloss.Color("205")).
+				PaddingLeft(1).
+				PaddingRight(1)
+
+	selectedRowStyle = lipgloss.NewStyle().
+				Bold(true).
+				Foreground(lipgloss.Color("205"))
+
 	opDisabledBoxStyle = lipgloss.NewStyle().
 				Border(lipgloss.RoundedBorder()).
 				BorderForeground(lipgloss.Color("237")).
@@ -131,6 +186,12 @@ var (
 	rateConfigStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("255"))
 
+	warningStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214"))
+
+	abortStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("196"))
+
 	modBoxStyle = lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
 			BorderForeground(lipgloss.Color("39")).
@@ -150,11 +211,24 @@ func statusBoxStyle(color lipgloss.Color) lipgloss.Style {
 }
 
 // newModel creates a model pre-populated with module and operation metadata.
-func newModel(metadata module.Metadata, d time.Duration, stopFn func()) *model {
+func newModel(
+	metadata module.Metadata,
+	collector *stats.Collector,
+	errLog *errorLog,
+	d time.Duration,
+	stopFn func(),
+	controller Controller,
+) *model {
 	return &model{
 		metadata:      metadata,
-		stats:         make(map[string]map[string]*opStats),
+		collector:     collector,
+		snapshot:      collector.Snapshot(),
+		history:       make(map[string]*opHistory),
+		errLog:        errLog,
 		trafficCancel: stopFn,
+		controller:    controller,
+		rates:         make(map[string]uint),
+		disabled:      make(map[string]bool),
 		startTime:     time.Now(),
 		totalDuration: d,
 	}
@@ -180,101 +254,109 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.trafficCancel()
 			return m, tea.Quit
 		}
+		m.handleKey(msg)
 
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+		m.scrollToSelected()
 
 	case tickMsg:
+		// Once traffic is done, nothing new is recorded, so the history is kept
+		// as it was at the end.
+		if !m.trafficDone {
+			next := m.collector.Snapshot()
+			m.record(m.snapshot, next)
+			m.snapshot = next
+		}
+		m.errors = m.errLog.snapshot()
 		return m, tickCmd()
 
 	case errMsg:
 		m.errMsg = msg.err.Error()
 
-	case opMsg:
-		m.handleOp(msg)
-
 	case trafficDoneMsg:
 		m.trafficDone = true
 		m.trafficEndTime = time.Now()
 
 	case doneMsg:
 		m.done = true
+		m.showSummary = true
+		m.scroll = 0
+		// Traffic has stopped, so this snapshot holds the final results.
+		next := m.collector.Snapshot()
+		m.record(m.snapshot, next)
+		m.snapshot = next
+		m.errors = m.errLog.snapshot()
 	}
 
 	return m, nil
 }
 
-func (m *model) handleOp(msg opMsg) {
-	if _, ok := m.stats[msg.mod]; !ok {
-		m.stats[msg.mod] = make(map[string]*opStats)
-	}
-
-	stats, ok := m.stats[msg.mod][msg.op]
-	if !ok {
-		stats = &opStats{}
-		m.stats[msg.mod][msg.op] = stats
-	}
+// View implements tea.Model. The body is scrolled if it does not fit between
+// the header and the footer.
+func (m *model) View() string {
+	w := m.viewWidth()
 
-	stats.executions++
-	if msg.ok {
-		stats.ok++
-	} else {
-		stats.nok++
+	body, _, _ := m.renderBody(w)
+	footer := m.renderFooter()
+	if m.height > 0 {
+		body = m.viewport(body, m.bodyHeight(w))
 	}
 
-	if msg.duration > 0 {
-		stats.totalDuration += msg.duration
-		if stats.minDuration == 0 || msg.duration < stats.minDuration {
-			stats.minDuration = msg.duration
-		}
-		if msg.duration > stats.maxDuration {
-			stats.maxDuration = msg.duration
-		}
-	}
+	return m.renderTop(w) + "\n" + body + "\n" + footer + "\n"
 }
 
-// View implements tea.Model.
-func (m *model) View() string {
-	w := m.width
-	if w == 0 {
-		w = defaultWidth
+// viewWidth returns the width of the terminal, or a default until it is known.
+func (m *model) viewWidth() int {
+	if m.width == 0 {
+		return defaultWidth
 	}
 
-	var sb strings.Builder
+	return m.width
+}
 
-	sb.WriteString(m.renderHeader(w))
-	sb.WriteString("\n")
-	sb.WriteString(separatorStyle.Render(strings.Repeat("─", w)))
-	sb.WriteString("\n\n")
+// renderTop renders the header and the separator below it.
+func (m *model) renderTop(w int) string {
+	return m.renderHeader(w) + "\n" + separatorStyle.Render(strings.Repeat("─", w)) + "\n"
+}
 
-	for _, mod := range m.metadata {
-		modInnerW := w - 4 // border(2) + padding(2) consumed by modBoxStyle
-		sb.WriteString(m.renderModule(mod, modInnerW))
-		sb.WriteString("\n")
-	}
+// renderFooter returns the status message shown at the bottom of the screen.
+func (m *model) renderFooter() string {
+	status := m.renderStatus()
 
-	footer := m.renderFooter()
-	if footer != "" {
-		if m.height > 0 {
-			contentLines := strings.Count(sb.String(), "\n") + 1
-			footerLines := strings.Count(footer, "\n") + 1
-			if padding := m.height - contentLines - footerLines; padding > 0 {
-				sb.WriteString(strings.Repeat("\n", padding))
-			}
-		}
-		sb.WriteString(footer)
-		sb.WriteString("\n")
+	controls := doneStyle.Width(m.viewWidth()).Render(m.help())
+	switch ref, ok := m.selectedOp(); {
+	case m.filtering:
+		controls = rateConfigStyle.Render("/"+m.filter+"▏") +
+			doneStyle.Render("  enter to apply, esc to clear")
+	case m.exporting:
+		controls = rateConfigStyle.Render("write report to: "+m.exportPath+"▏") +
+			doneStyle.Render("  .yaml or .xml for JUnit, enter to write, esc to cancel")
+	case ok && m.editing:
+		controls = rateConfigStyle.Render("rate of "+opKey(ref)+": "+m.input+"▏") +
+			doneStyle.Render("  /min, enter to apply, esc to cancel")
+	}
+	if m.controlErr != "" {
+		controls = abortStyle.Render("Control failed: "+m.controlErr) + "\n" + controls
+	}
+	if m.exportMsg != "" {
+		controls = m.exportMsg + "\n" + controls
+	}
+	if status != "" {
+		controls = status + "\n" + controls
 	}
 
-	return sb.String()
+	return controls
 }
 
-// renderFooter returns the status message shown at the bottom of the screen.
-func (m *model) renderFooter() string {
+// renderStatus returns the message describing the state of the test.
+func (m *model) renderStatus() string {
 	switch {
 	case m.errMsg != "":
 		return doneStyle.Render("Error: " + m.errMsg)
+	case m.abortReason() != "" && m.done:
+		return doneStyle.Render("Aborted, " + m.abortReason() + ". Press CTRL-C to exit.")
 	case m.done:
 		return doneStyle.Render("Test complete! Press CTRL-C to exit.")
 	case m.trafficDone:
@@ -297,9 +379,15 @@ func (m *model) renderHeader(w int) string {
 	case m.errMsg != "":
 		statusColor = lipgloss.Color("196")
 		statusText = "ERROR"
+	case m.abortReason() != "":
+		statusColor = lipgloss.Color("196")
+		statusText = "ABORTED"
 	case m.done:
 		statusColor = lipgloss.Color("214")
 		statusText = "DONE"
+	case m.paused && !m.trafficDone:
+		statusColor = lipgloss.Color("214")
+		statusText = "PAUSED"
 	default:
 		statusColor = lipgloss.Color("42")
 		statusText = "RUNNING"
@@ -381,13 +469,24 @@ func (m *model) timeRemaining() time.Duration {
 	return rem
 }
 
-// renderModule renders a full module section — header line plus all operation
-// boxes — wrapped in a rounded border box. contentW is the inner content width
-// (the box border and padding are added on top).
-func (m *model) renderModule(mod *module.Meta, contentW int) string {
+// renderModule renders a full module section — header line plus the boxes of
+// ops — wrapped in a rounded border box. contentW is the inner content width
+// (the box border and padding are added on top). The first and last line of
+// the selected operation within the section are returned, or -1 if it is not
+// one of ops.
+func (m *model) renderModule(mod *module.Meta, ops []opRef, contentW int) (string, int, int) {
 	var sb strings.Builder
 	sb.WriteString(modHeaderStyle.Render("Module: " + mod.Name()))
-	sb.WriteString("\n\n")
+	sb.WriteString("\n")
+	if values := mod.Args().Values(); len(values) > 0 {
+		args := make([]string, len(values))
+		for i, v := range values {
+			args[i] = v.Name + "=" + v.Value // secret values are already redacted
+		}
+		sb.WriteString(doneStyle.Width(contentW).Render("Args: " + strings.Join(args, " ")))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
 
 	opInnerW := contentW - 4 // border(2) + padding(2) consumed by opBoxStyle
 	twoCol := false
@@ -396,21 +495,26 @@ func (m *model) renderModule(mod *module.Meta, contentW int) string {
 		twoCol = true
 	}
 
-	ops := mod.Ops()
+	top, bottom := -1, -1
 	for i := 0; i < len(ops); {
-		box1 := m.renderOp(mod.Name(), ops[i], opInnerW)
+		selected := m.isSelected(ops[i].mod, ops[i].op)
+		row := m.renderOp(mod.Name(), ops[i].op, opInnerW)
 		i++
 		if twoCol && i < len(ops) {
-			box2 := m.renderOp(mod.Name(), ops[i], opInnerW)
+			selected = selected || m.isSelected(ops[i].mod, ops[i].op)
+			row = lipgloss.JoinHorizontal(lipgloss.Top, row, "  ", m.renderOp(mod.Name(), ops[i].op, opInnerW))
 			i++
-			sb.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, box1, "  ", box2))
-		} else {
-			sb.WriteString(box1)
 		}
+		if selected {
+			// The border(1) of the module box comes before its content.
+			top = strings.Count(sb.String(), "\n") + 1
+			bottom = top + lipgloss.Height(row) - 1
+		}
+		sb.WriteString(row)
 		sb.WriteString("\n")
 	}
 
-	return modBoxStyle.Width(contentW).Render(strings.TrimSuffix(sb.String(), "\n"))
+	return modBoxStyle.Width(contentW).Render(strings.TrimSuffix(sb.String(), "\n")), top, bottom
 }
 
 // renderOp renders a single operation's statistics box. Disabled operations
@@ -425,8 +529,14 @@ func (m *model) renderOp(modName string, op *module.Op, innerW int) string {
 	}
 
 	var (
-		executions, nok, okCount, rpm uint
+		executions, nok, okCount, rpm uint64
 		avgDur, minDur, maxDur        time.Duration
+		p50Dur, p95Dur, p99Dur        time.Duration
+		missedPerc                    float64
+		peakWorkers, maxInFlight      int
+		limited                       bool
+		throttled                     uint64
+		aborts                        []stats.Abort
 	)
 
 	elapsed := time.Since(m.startTime)
@@ -434,19 +544,25 @@ func (m *model) renderOp(modName string, op *module.Op, innerW int) string {
 		elapsed = m.trafficEndTime.Sub(m.startTime)
 	}
 
-	if modStats, ok := m.stats[modName]; ok {
-		if stats, opOK := modStats[op.Name]; opOK {
-			executions = stats.executions
-			nok = stats.nok
-			okCount = stats.ok
-			rpm = stats.observedRPM(elapsed)
-			if executions > 0 && stats.totalDuration > 0 {
-				//nolint:gosec // no risk of overflow since the total duration is the sum
-				avgDur = stats.totalDuration / time.Duration(executions)
-				minDur = stats.minDuration
-				maxDur = stats.maxDuration
-			}
-		}
+	ref := opRef{mod: modName, op: op}
+	h := m.history[opKey(ref)]
+	window := h.window(percentileWindow)
+	p50Dur, p95Dur, p99Dur = window.Quantile(p50), window.Quantile(p95), window.Quantile(p99)
+
+	if opStats := m.snapshot.Op(modName, op.Name); opStats != nil {
+		executions = opStats.Executions
+		nok = opStats.NOK
+		okCount = opStats.OK
+		rpm = observedRPM(executions, elapsed)
+		avgDur = opStats.Average()
+		minDur = opStats.Shortest
+		maxDur = opStats.Longest
+		missedPerc = opStats.MissedPerc()
+		peakWorkers = opStats.PeakWorkers
+		limited = opStats.LimitedSamples > 0
+		maxInFlight = opStats.MaxInFlight
+		throttled = opStats.Throttled
+		aborts = opStats.Aborts
 	}
 
 	// Three side-by-side columns: Rate | Calls | Timing
@@ -456,9 +572,12 @@ func (m *model) renderOp(modName string, op *module.Op, innerW int) string {
 	}
 	colStyle := lipgloss.NewStyle().Width(colW)
 
-	// Rate: configured rate in the header; "Rate" is bold-blue, the value is plain white.
-	rateCol := colHeaderStyle.Render("Rate") + rateConfigStyle.Render(fmt.Sprintf(" (%d/min)", op.Rate)) + "\n" +
-		fmt.Sprintf("actual: %d/min", rpm)
+	// Rate: current rate in the header; "Rate" is bold-blue, the value is plain white.
+	rateCol := colHeaderStyle.Render("Rate") + rateConfigStyle.Render(fmt.Sprintf(" (%d/min)", m.rate(ref))) + "\n" +
+		fmt.Sprintf("actual: %d/min", rpm) + "\n" +
+		fmt.Sprintf("missed: %.0f%%", missedPerc) + "\n" +
+		fmt.Sprintf("peak workers: %d", peakWorkers) + "\n" +
+		fmt.Sprintf("max in-flight: %d", maxInFlight)
 
 	// Calls: labels padded to callsLabelW so values align.
 	callsCol := colHeaderStyle.Render("Calls") + "\n" +
@@ -467,24 +586,83 @@ func (m *model) renderOp(modName string, op *module.Op, innerW int) string {
 		fmt.Sprintf("%-*s %s", callsLabelW, "success:", successStr(executions, okCount))
 
 	// Timing: labels padded to timingLabelW so values align; colon on each label.
+	// Percentiles are over the rolling window, the rest over the whole run.
 	timingCol := colHeaderStyle.Render("Timing") + "\n" +
 		fmt.Sprintf("%-*s %s", timingLabelW, "avg:", formatOpDuration(avgDur)) + "\n" +
 		fmt.Sprintf("%-*s %s", timingLabelW, "min:", formatOpDuration(minDur)) + "\n" +
-		fmt.Sprintf("%-*s %s", timingLabelW, "max:", formatOpDuration(maxDur))
+		fmt.Sprintf("%-*s %s", timingLabelW, "max:", formatOpDuration(maxDur)) + "\n" +
+		fmt.Sprintf("%-*s %s", timingLabelW, "p50:", formatOpDuration(p50Dur)) + "\n" +
+		fmt.Sprintf("%-*s %s", timingLabelW, "p95:", formatOpDuration(p95Dur)) + "\n" +
+		fmt.Sprintf("%-*s %s", timingLabelW, "p99:", formatOpDuration(p99Dur))
 
 	columns := lipgloss.JoinHorizontal(lipgloss.Top,
 		colStyle.Render(rateCol), " ",
 		colStyle.Render(callsCol), " ",
 		colStyle.Render(timingCol))
 
-	return opBoxStyle.Width(innerW).Render(
-		opNameStyle.Render("Operation: "+op.Name) + "\n\n" + columns,
-	)
+	content := opNameStyle.Render("Operation: " + op.Name)
+	if m.disabled[opKey(ref)] {
+		content += warningStyle.Render("  [DISABLED]")
+	}
+	content += "\n\n" + columns + "\n\n" + renderSparklines(h, innerW-2)
+	if limited {
+		content += "\n" + warningStyle.Width(innerW).Render("⚠ concurrency limit reached, target rate not met")
+	}
+	if throttled > 0 {
+		content += "\n" + warningStyle.Width(innerW).Render(
+			fmt.Sprintf("⚠ %d calls waited for the in-flight limit", throttled),
+		)
+	}
+	if len(aborts) > 0 {
+		// Only the latest abort is shown, an operation may back off many times.
+		last := aborts[len(aborts)-1]
+		style := abortStyle
+		text := fmt.Sprintf("⛔ %s: %s", abortActionText(last.Action), last.Reason)
+		if last.Action == stats.AbortActionBackoff {
+			style = warningStyle
+			text = fmt.Sprintf(
+				"⚠ backed off %d times, last at %s: %s", len(aborts), last.Time.Format(time.TimeOnly), last.Reason,
+			)
+		}
+		content += "\n" + style.Width(innerW).Render(text)
+	}
+
+	if m.isSelected(modName, op) {
+		return opSelectedBoxStyle.Width(innerW).Render(content)
+	}
+
+	return opBoxStyle.Width(innerW).Render(content)
+}
+
+// abortReason returns the operation and reason of the abort condition that
+// stopped the test, or an empty string if none did.
+func (m *model) abortReason() string {
+	for _, op := range m.snapshot.Ops {
+		for _, abort := range op.Aborts {
+			if abort.Action == stats.AbortActionStop {
+				return fmt.Sprintf("%s.%s: %s", op.Module, op.Op, abort.Reason)
+			}
+		}
+	}
+
+	return ""
+}
+
+// abortActionText describes an abort action for the operation box.
+func abortActionText(action string) string {
+	switch action {
+	case stats.AbortActionStop:
+		return "stopped the test"
+	case stats.AbortActionDisable:
+		return "disabled"
+	default:
+		return action
+	}
 }
 
 // successStr returns a formatted success percentage, or "—" when no calls
 // have been made yet.
-func successStr(executions, ok uint) string {
+func successStr(executions, ok uint64) string {
 	if executions == 0 {
 		return "—"
 	}
@@ -495,8 +673,8 @@ func successStr(executions, ok uint) string {
 // observedRPM returns the actual observed rate per minute. elapsed is the
 // duration since the test started and may be frozen when traffic has stopped,
 // preventing the rate from declining after the test ends.
-func (s *opStats) observedRPM(elapsed time.Duration) uint {
-	if s.executions == 0 {
+func observedRPM(executions uint64, elapsed time.Duration) uint64 {
+	if executions == 0 {
 		return 0
 	}
 
@@ -505,7 +683,7 @@ func (s *opStats) observedRPM(elapsed time.Duration) uint {
 		return 0
 	}
 
-	return uint(math.Round(float64(s.executions) / minutes))
+	return uint64(math.Round(float64(executions) / minutes))
 }
 
 // formatOpDuration formats an operation duration in a human-readable short form.
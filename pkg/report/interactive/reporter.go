@@ -4,41 +4,93 @@ package interactivereport
 
 import (
 	"context"
+	"io"
+	"os"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/maansaake/arbiter/pkg/module"
 	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
 )
 
-// reporter implements report.reporter and drives a bubbletea TUI program.
-type reporter struct {
-	program *tea.Program
+type (
+	// Opts contains options for the interactive reporter.
+	Opts struct {
+		// Metadata lists the modules and operations to display.
+		Metadata module.Metadata
+		// Duration is the total test duration, used for the progress bar.
+		Duration time.Duration
+		// Stats is a collector shared with other reporters, which must receive
+		// the operation results. It is required, the TUI displays the stats read
+		// from it.
+		Stats *stats.Collector
+		// TrafficCtx is used to monitor the traffic progression, to display
+		// helpful messages in the TUI.
+		TrafficCtx context.Context
+		// TrafficCancel is called when the user presses Ctrl-C inside the TUI,
+		// allowing the caller to cancel the test context without relying on OS
+		// signal delivery (bubbletea runs the terminal in raw mode and intercepts
+		// the key event before the OS can raise SIGINT).
+		TrafficCancel func()
+		// Controller changes running traffic from the TUI, to change the rates
+		// of operations, disable them or pause all traffic. If nil, the TUI only
+		// displays traffic.
+		Controller Controller
+		// Thresholds are checked for each operation in the summary shown when
+		// the test is done.
+		Thresholds report.Thresholds
+		// Export writes the report of the test to a path, from the summary. If
+		// nil, the report cannot be exported from the TUI.
+		Export func(path string) error
+		// Output the summary is printed to when the TUI exits. Defaults to
+		// stdout.
+		Output io.Writer
+	}
 
-	// trafficCtx is used to monitor the traffic progression, to display helpful
-	// messages in the TUI.
-	trafficCtx context.Context
-}
+	// reporter implements report.reporter and drives a bubbletea TUI program.
+	reporter struct {
+		program *tea.Program
+		// model is the state of the TUI, read once the program has exited.
+		model *model
+		// out is where the summary is printed when the TUI exits.
+		out io.Writer
+
+		// stats aggregates the operation results displayed by the TUI.
+		stats *stats.Collector
+		// errors groups the reported errors for the error pane.
+		errors *errorLog
+
+		// trafficCtx is used to monitor the traffic progression, to display helpful
+		// messages in the TUI.
+		trafficCtx context.Context
+	}
+)
 
 var _ report.Reporter = &reporter{}
 
 // New creates a new Reporter initialised with module metadata and the total
 // test duration so the TUI can display accurate progress and operation
-// information from the start. Call Start to begin rendering.
-// stopFn is called when the user presses Ctrl-C inside the TUI, allowing the
-// caller to cancel the test context without relying on OS signal delivery
-// (bubbletea runs the terminal in raw mode and intercepts the key event before
-// the OS can raise SIGINT).
-func New(
-	metadata module.Metadata,
-	totalDuration time.Duration,
-	//nolint:revive // the traffic context is special and not releated to the function really
-	trafficCtx context.Context, trafficCancel func(),
-) report.Reporter {
-	return &reporter{
-		program:    tea.NewProgram(newModel(metadata, totalDuration, trafficCancel), tea.WithAltScreen()),
-		trafficCtx: trafficCtx,
+// information from the start. Call Start to begin rendering. The TUI reads
+// operation stats from the collector once per refresh, so reporting an
+// operation never blocks on the TUI.
+func New(opts *Opts) report.Reporter {
+	r := &reporter{
+		stats:      opts.Stats,
+		errors:     newErrorLog(),
+		out:        opts.Output,
+		trafficCtx: opts.TrafficCtx,
 	}
+	if r.out == nil {
+		r.out = os.Stdout
+	}
+
+	r.model = newModel(opts.Metadata, r.stats, r.errors, opts.Duration, opts.TrafficCancel, opts.Controller)
+	r.model.thresholds = opts.Thresholds
+	r.model.export = opts.Export
+	r.program = tea.NewProgram(r.model, tea.WithAltScreen())
+
+	return r
 }
 
 // Start implements report.Reporter. It launches the bubbletea program in a
@@ -51,36 +103,45 @@ func (r *reporter) Start(reporterCtx context.Context) {
 
 	// Reporter context monitor, once the context is cancelled the test is shutting down.
 	go func() {
+		trafficDone := r.trafficCtx.Done()
 		for {
 			select {
 			case <-reporterCtx.Done():
 				r.program.Send(doneMsg{})
 				return
-			case <-r.trafficCtx.Done():
+			case <-trafficDone:
 				r.program.Send(trafficDoneMsg{})
+				// A closed channel is always ready, only notify once.
+				trafficDone = nil
 			}
 		}
 	}()
 }
 
+// ReportError implements report.Reporter. The latest error is shown in the
+// footer, and all are listed in the error pane.
 func (r *reporter) ReportError(err error) {
+	r.errors.record("", "", err, time.Now())
 	r.program.Send(errMsg{err: err})
 }
 
-// ReportOp implements report.Reporter.
-func (r *reporter) ReportOp(mod, op string, result *module.Result, err error) {
-	r.program.Send(opMsg{
-		mod:      mod,
-		op:       op,
-		ok:       err == nil,
-		duration: result.Duration,
-	})
+// ReportOp implements report.Reporter. Errors of operations are listed in the
+// error pane, the results are read from the shared collector.
+func (r *reporter) ReportOp(mod, op string, _ *module.Result, err error) {
+	if err != nil {
+		r.errors.record(mod, op, err, time.Now())
+	}
 }
 
 // Finalise implements report.Reporter. For a normally completed test it shows
-// the completion footer and blocks until the user presses CTRL-C; for an
-// early exit the TUI has already quit so this returns immediately.
+// the summary and blocks until the user presses CTRL-C; for an early exit the
+// TUI has already quit so this returns immediately. The summary is then
+// printed, as the alt screen is cleared when the TUI exits.
 func (r *reporter) Finalise() error {
 	r.program.Wait()
-	return nil
+
+	// The TUI may have quit before the final results were read.
+	r.model.snapshot = r.stats.Snapshot()
+	r.model.errors = r.errors.snapshot()
+	return r.model.summary().write(r.out)
 }
@@ -0,0 +1,215 @@
+package interactivereport
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+type (
+	// summary is the outcome of a test, shown when it is done and printed when
+	// the TUI exits.
+	summary struct {
+		elapsed     time.Duration
+		abortReason string
+		calls, nok  uint64
+		latency     *stats.HistogramSnapshot
+		ops         []opSummary
+		// errors are the largest groups of errors.
+		errors []errorGroup
+	}
+
+	// opSummary is the outcome of an operation.
+	opSummary struct {
+		name       string
+		calls, nok uint64
+		p99        time.Duration
+		// violations are the thresholds breached by the operation, it passed if
+		// there are none.
+		violations []string
+	}
+)
+
+const (
+	// summaryErrors is the number of error groups in a summary.
+	summaryErrors = 5
+	// summaryPadding is the padding between the columns of a printed summary.
+	summaryPadding = 2
+	// summaryErrorW is the most runes of an error message printed in a
+	// summary.
+	summaryErrorW = 120
+)
+
+// summary returns the outcome of the test so far.
+func (m *model) summary() *summary {
+	s := &summary{
+		elapsed:     time.Since(m.startTime),
+		abortReason: m.abortReason(),
+		latency:     &stats.HistogramSnapshot{},
+	}
+	if m.trafficDone {
+		s.elapsed = m.trafficEndTime.Sub(m.startTime)
+	}
+
+	for _, mod := range m.metadata {
+		for _, op := range mod.Ops() {
+			opStats := m.snapshot.Op(mod.Name(), op.Name)
+			if op.Disabled || opStats == nil {
+				continue
+			}
+
+			s.calls += opStats.Executions
+			s.nok += opStats.NOK
+			s.latency = s.latency.Add(opStats.Latency)
+			s.ops = append(s.ops, opSummary{
+				name:       mod.Name() + "." + op.Name,
+				calls:      opStats.Executions,
+				nok:        opStats.NOK,
+				p99:        opStats.Latency.Quantile(p99),
+				violations: m.thresholds.Check(opStats.Executions, opStats.NOK, opStats.Average(), opStats.Longest),
+			})
+		}
+	}
+
+	s.errors = topErrors(m.errors, summaryErrors)
+	return s
+}
+
+// failed returns the number of operations that breached a threshold.
+func (s *summary) failed() int {
+	failed := 0
+	for _, op := range s.ops {
+		if len(op.violations) > 0 {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// errorRate returns the percentage of calls that failed.
+func (s *summary) errorRate() float64 {
+	if s.calls == 0 {
+		return 0
+	}
+
+	return float64(s.nok) / float64(s.calls) * 100 //nolint:mnd // percentage
+}
+
+// outcome describes how the test ended.
+func (s *summary) outcome() string {
+	if s.abortReason != "" {
+		return fmt.Sprintf("Aborted after %s, %s", formatDuration(s.elapsed), s.abortReason)
+	}
+
+	return "Completed in " + formatDuration(s.elapsed)
+}
+
+// renderSummary renders the summary screen shown once the test is done.
+// contentW is the inner content width of the screen.
+func (m *model) renderSummary(contentW int) string {
+	s := m.summary()
+
+	var sb strings.Builder
+	sb.WriteString(modHeaderStyle.Render("Summary: " + s.outcome()))
+	sb.WriteString("\n\n")
+
+	sb.WriteString(colHeaderStyle.Render("Calls") + "\n")
+	sb.WriteString(fmt.Sprintf("calls: %d, failed: %d (%.2f%%), rate: %d/min\n",
+		s.calls, s.nok, s.errorRate(), observedRPM(s.calls, s.elapsed)))
+	sb.WriteString(fmt.Sprintf("latency p50: %s, p95: %s, p99: %s, max: %s\n\n",
+		formatOpDuration(s.latency.Quantile(p50)), formatOpDuration(s.latency.Quantile(p95)),
+		formatOpDuration(s.latency.Quantile(p99)), formatOpDuration(s.latency.Quantile(1))))
+
+	title := fmt.Sprintf("Thresholds: %d passed, %d failed", len(s.ops)-s.failed(), s.failed())
+	if m.thresholds.IsZero() {
+		title += doneStyle.Render(" (none set, operations pass if no call failed)")
+	}
+	sb.WriteString(colHeaderStyle.Render(title) + "\n")
+	for _, op := range s.ops {
+		if len(op.violations) == 0 {
+			sb.WriteString(barFilledStyle.Render("✔ ") + op.name + "\n")
+			continue
+		}
+		sb.WriteString(abortStyle.Render("✘ "+op.name+": ") + strings.Join(op.violations, ", ") + "\n")
+	}
+
+	if len(s.errors) > 0 {
+		sb.WriteString("\n" + colHeaderStyle.Render("Top errors") + "\n")
+		for _, g := range s.errors {
+			line := fmt.Sprintf("%8d  %s: %s", g.count, g.source(), g.msg)
+			sb.WriteString(abortStyle.Render(truncate(line, contentW-2)) + "\n") // padding(2) of modBoxStyle
+		}
+	}
+
+	return modBoxStyle.Width(contentW).Render(strings.TrimSuffix(sb.String(), "\n"))
+}
+
+// write prints the summary as plain text, for after the TUI has exited and
+// the alt screen with it.
+func (s *summary) write(out io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("arbiter: %s\n", s.outcome()))
+	sb.WriteString(fmt.Sprintf("calls: %d, failed: %d (%.2f%%), p99: %s\n",
+		s.calls, s.nok, s.errorRate(), formatOpDuration(s.latency.Quantile(p99))))
+
+	tw := tabwriter.NewWriter(&sb, 0, 0, summaryPadding, ' ', 0)
+	for _, op := range s.ops {
+		result := "PASS"
+		if len(op.violations) > 0 {
+			result = "FAIL: " + strings.Join(op.violations, ", ")
+		}
+		_, _ = fmt.Fprintf(tw, "  %s\t%d calls\t%d failed\tp99 %s\t%s\n",
+			op.name, op.calls, op.nok, formatOpDuration(op.p99), result)
+	}
+	_ = tw.Flush()
+
+	if len(s.errors) > 0 {
+		sb.WriteString("top errors:\n")
+		for _, g := range s.errors {
+			sb.WriteString(fmt.Sprintf("  %d× %s: %s\n", g.count, g.source(), truncate(g.msg, summaryErrorW)))
+		}
+	}
+
+	_, err := io.WriteString(out, sb.String())
+	return err
+}
+
+// handleExportInput edits the path the report is exported to, which is
+// written with enter and discarded with esc.
+func (m *model) handleExportInput(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.exporting = false
+		if err := m.export(m.exportPath); err != nil {
+			m.exportMsg = abortStyle.Render("Export failed: " + err.Error())
+			return
+		}
+		m.exportMsg = barFilledStyle.Render("Report written to " + m.exportPath)
+	case tea.KeyEsc:
+		m.exporting = false
+	case tea.KeyBackspace:
+		if r := []rune(m.exportPath); len(r) > 0 {
+			m.exportPath = string(r[:len(r)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.exportPath += string(msg.Runes)
+	default:
+	}
+}
+
+// topErrors returns the n largest groups of errors.
+func topErrors(groups []errorGroup, n int) []errorGroup {
+	top := make([]errorGroup, len(groups))
+	copy(top, groups)
+	slices.SortStableFunc(top, func(a, b errorGroup) int { return cmp.Compare(b.count, a.count) })
+
+	return top[:min(n, len(top))]
+}
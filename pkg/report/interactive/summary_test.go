@@ -0,0 +1,189 @@
+package interactivereport
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+// newSummaryModel creates a model of operations with results:
+//
+//	a.x: 4 calls of 10ms, 1 of them failed
+//	a.y: 2 calls of 100ms
+//	a.off: disabled at the start, with a call recorded anyway
+//	a.idle: no calls
+func newSummaryModel(collector *stats.Collector) *model {
+	metadata := module.Metadata{{Module: &modulemock.Module{SetName: "a", SetOps: module.Ops{
+		{Name: "x"}, {Name: "y"}, {Name: "off", Disabled: true}, {Name: "idle"},
+	}}}}
+
+	for range 3 {
+		collector.Record("a", "x", &module.Result{Duration: 10 * time.Millisecond}, nil)
+	}
+	collector.Record("a", "x", nil, errors.New("failed"))
+	for range 2 {
+		collector.Record("a", "y", &module.Result{Duration: 100 * time.Millisecond}, nil)
+	}
+	collector.Record("a", "off", &module.Result{Duration: time.Millisecond}, nil)
+
+	return newModel(metadata, collector, newErrorLog(), time.Minute, func() {}, &testController{})
+}
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		thresholds report.Thresholds
+		// violations are the number of thresholds breached by a.x and a.y.
+		violations []int
+	}{
+		{name: "no thresholds", violations: []int{1, 0}},
+		{name: "error rate within", thresholds: report.Thresholds{MaxErrorRate: 0.5}, violations: []int{0, 0}},
+		{name: "error rate exceeded", thresholds: report.Thresholds{MaxErrorRate: 0.1}, violations: []int{1, 0}},
+		{name: "latency exceeded", thresholds: report.Thresholds{MaxLatency: 50 * time.Millisecond}, violations: []int{0, 1}},
+		{
+			name:       "average latency exceeded",
+			thresholds: report.Thresholds{MaxAverageLatency: 5 * time.Millisecond, MaxErrorRate: 0.5},
+			violations: []int{1, 1},
+		},
+		{
+			name: "all exceeded",
+			thresholds: report.Thresholds{
+				MaxErrorRate:      0.1,
+				MaxAverageLatency: 5 * time.Millisecond,
+				MaxLatency:        5 * time.Millisecond,
+			},
+			violations: []int{3, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newSummaryModel(stats.NewCollector())
+			m.thresholds = tt.thresholds
+
+			s := m.summary()
+			// Disabled operations and those without calls are left out.
+			if s.calls != 6 || s.nok != 1 || s.latency.Count() != 5 {
+				t.Fatalf("expected 6 calls, 1 failed and 5 latencies, got %d, %d and %d",
+					s.calls, s.nok, s.latency.Count())
+			}
+			if rate := s.errorRate(); math.Abs(rate-100.0/6) > 1e-9 {
+				t.Fatalf("expected an error rate of %f%%, got %f%%", 100.0/6, rate)
+			}
+
+			var names []string
+			failed := 0
+			for i, op := range s.ops {
+				names = append(names, op.name)
+				if len(op.violations) != tt.violations[i] {
+					t.Errorf("%s: expected %d violations, got %v", op.name, tt.violations[i], op.violations)
+				}
+				if len(op.violations) > 0 {
+					failed++
+				}
+			}
+			if want := []string{"a.x", "a.y"}; !slices.Equal(names, want) {
+				t.Fatalf("expected operations %v, got %v", want, names)
+			}
+			if s.failed() != failed {
+				t.Fatalf("expected %d failed operations, got %d", failed, s.failed())
+			}
+		})
+	}
+}
+
+func TestSummaryEnd(t *testing.T) {
+	collector := stats.NewCollector()
+	m := newSummaryModel(collector)
+	m.trafficDone = true
+	m.trafficEndTime = m.startTime.Add(90 * time.Second)
+
+	if s := m.summary(); s.elapsed != 90*time.Second || s.abortReason != "" {
+		t.Fatalf("expected the test to complete after the traffic, got %+v", s)
+	}
+
+	collector.RecordAbort("a", "x", &stats.Abort{Action: stats.AbortActionDisable, Reason: "slow"})
+	m.snapshot = collector.Snapshot()
+	if s := m.summary(); s.abortReason != "" {
+		t.Fatalf("expected a disabled operation not to abort the test, got %q", s.abortReason)
+	}
+
+	collector.RecordAbort("a", "y", &stats.Abort{Action: stats.AbortActionStop, Reason: "too many errors"})
+	m.snapshot = collector.Snapshot()
+	if s := m.summary(); s.abortReason != "a.y: too many errors" {
+		t.Fatalf("expected the test to be aborted by a.y, got %q", s.abortReason)
+	}
+}
+
+func TestSummaryOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary *summary
+		want    string
+	}{
+		{name: "completed", summary: &summary{elapsed: 65 * time.Second}, want: "Completed in 01:05"},
+		{
+			name:    "aborted",
+			summary: &summary{elapsed: 30 * time.Second, abortReason: "a.x: too many errors"},
+			want:    "Aborted after 00:30, a.x: too many errors",
+		},
+		{name: "long test", summary: &summary{elapsed: 2*time.Hour + 3*time.Second}, want: "Completed in 2:00:03"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.summary.outcome(); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSummaryErrorRate(t *testing.T) {
+	if rate := (&summary{}).errorRate(); rate != 0 {
+		t.Fatalf("expected no error rate without calls, got %f", rate)
+	}
+	if rate := (&summary{calls: 4, nok: 1}).errorRate(); rate != 25 {
+		t.Fatalf("expected an error rate of 25%%, got %f", rate)
+	}
+}
+
+func TestTopErrors(t *testing.T) {
+	groups := []errorGroup{
+		{msg: "a", count: 1},
+		{msg: "b", count: 5},
+		{msg: "c", count: 3},
+		{msg: "d", count: 5},
+	}
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		// Groups of the same count keep their order, the latest seen first.
+		{n: 3, want: []string{"b", "d", "c"}},
+		{n: 10, want: []string{"b", "d", "c", "a"}},
+		{n: 0, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		got := []string{}
+		for _, g := range topErrors(groups, tt.n) {
+			got = append(got, g.msg)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("top %d: expected %v, got %v", tt.n, tt.want, got)
+		}
+	}
+
+	if groups[0].msg != "a" {
+		t.Fatal("expected the groups not to be reordered")
+	}
+}
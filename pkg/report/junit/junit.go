@@ -0,0 +1,310 @@
+// Package junitreport provides a reporter that writes a JUnit XML report, with
+// one test suite per module and one test case per operation.
+package junitreport
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+type (
+	// Opts contains options for the JUnit reporter.
+	Opts struct {
+		// Start time to set in the report. If left empty a start time is set
+		// when calling `New()`.
+		Start time.Time
+		// The final path of the JUnit XML report.
+		Path string
+		// Metadata lists the modules and operations of the test. Operations that
+		// were never executed are reported as skipped test cases.
+		Metadata module.Metadata
+		// Thresholds decide if an operation test case has failed.
+		Thresholds report.Thresholds
+		// RunMetadata is written as properties of each test suite, if set.
+		RunMetadata *report.RunMetadata
+		// Stats is a collector shared with other reporters, which must receive
+		// the operation results. It is required, the report is built from it.
+		Stats *stats.Collector
+		// Logger is the logger used for info-level logging by the reporter.
+		Logger logr.Logger
+		// ErrorLogger is a logger for the reporter to log errors to.
+		ErrorLogger logr.Logger
+	}
+
+	// reporter implements the reporter interface.
+	reporter struct {
+		path       string
+		start      time.Time
+		metadata   module.Metadata
+		thresholds report.Thresholds
+		// runMetadata is written as test suite properties.
+		runMetadata *report.RunMetadata
+		logger      logr.Logger
+		// errorLogger is used to log errors from failed operations.
+		errorLogger logr.Logger
+
+		// stats aggregates the operation results.
+		stats *stats.Collector
+	}
+)
+
+var _ report.Reporter = &reporter{}
+
+const (
+	suitesName       = "arbiter"
+	failureType      = "threshold"
+	abortFailureType = "abort"
+	xmlIndent        = "  "
+	quantile50       = 0.50
+	quantile95       = 0.95
+	quantile99       = 0.99
+)
+
+// New creates a new JUnit reporter.
+func New(opts *Opts) report.Reporter {
+	start := opts.Start
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	r := &reporter{
+		path:        opts.Path,
+		start:       start,
+		metadata:    opts.Metadata,
+		thresholds:  opts.Thresholds,
+		runMetadata: opts.RunMetadata,
+		logger:      opts.Logger,
+		errorLogger: opts.ErrorLogger,
+		stats:       opts.Stats,
+	}
+
+	return r
+}
+
+func (r *reporter) Start(_ context.Context) {
+	r.logger.Info("Starting JUnit reporter")
+}
+
+func (r *reporter) ReportError(_ error) {
+	// no-op
+}
+
+func (r *reporter) ReportOp(mod, op string, _ *module.Result, err error) {
+	if err != nil {
+		r.errorLogger.Error(err, "Error in operation", "mod", mod, "op", op)
+	}
+}
+
+// Finalise writes the JUnit XML report from a final snapshot of the operation
+// stats. It must be called after traffic has stopped for the report to be complete.
+func (r *reporter) Finalise() error {
+	r.logger.Info("Writing JUnit report", "path", r.path)
+
+	suites := r.build(r.stats.Snapshot())
+
+	file, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.WriteString(xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(file)
+	encoder.Indent("", xmlIndent)
+	if err = encoder.Encode(suites); err != nil {
+		return err
+	}
+
+	_, err = file.WriteString("\n")
+	return err
+}
+
+/*INTERNAL*/
+
+// build creates the JUnit XML document from a stats snapshot.
+func (r *reporter) build(snapshot *stats.Snapshot) *testSuites {
+	elapsed := snapshot.Time.Sub(r.start).Seconds()
+	suites := &testSuites{
+		Name: suitesName,
+		Time: elapsed,
+	}
+
+	for _, meta := range r.metadata {
+		suite := &testSuite{
+			Name:       meta.Name(),
+			Time:       elapsed,
+			Timestamp:  r.start.Format(time.RFC3339),
+			Properties: r.properties(meta.Name()),
+		}
+
+		for _, op := range meta.Ops() {
+			suite.Cases = append(suite.Cases, r.testCase(meta.Name(), op, snapshot.Op(meta.Name(), op.Name)))
+		}
+
+		for _, c := range suite.Cases {
+			suite.Tests++
+			if c.Failure != nil {
+				suite.Failures++
+			}
+			if c.Skipped != nil {
+				suite.Skipped++
+			}
+		}
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	return suites
+}
+
+// properties returns the run metadata properties of a module's test suite, or
+// nil if there is no run metadata.
+func (r *reporter) properties(mod string) *properties {
+	m := r.runMetadata
+	if m == nil {
+		return nil
+	}
+
+	props := &properties{}
+	add := func(name, value string) {
+		props.Properties = append(props.Properties, &property{Name: name, Value: value})
+	}
+
+	if m.Label != "" {
+		add("label", m.Label)
+	}
+	for _, k := range slices.Sorted(maps.Keys(m.Tags)) {
+		add("tag."+k, m.Tags[k])
+	}
+	add("duration", m.Duration.String())
+	add("worker_limit", strconv.Itoa(m.WorkerLimit))
+	if m.MaxInFlight > 0 {
+		add("max_in_flight", strconv.Itoa(m.MaxInFlight))
+	}
+	if m.Iterations > 0 {
+		add("iterations", strconv.FormatUint(uint64(m.Iterations), 10))
+	}
+	if a := m.Abort; a != nil {
+		add("abort.action", a.Action)
+		if a.MaxErrorRate > 0 {
+			add("abort.error_rate", strconv.FormatFloat(a.MaxErrorRate, 'f', -1, 64))
+			add("abort.window", a.Window.String())
+			add("abort.min_calls", strconv.FormatUint(uint64(a.MinCalls), 10))
+		}
+		if a.ConsecutiveFailures > 0 {
+			add("abort.consecutive_failures", strconv.FormatUint(uint64(a.ConsecutiveFailures), 10))
+		}
+	}
+	if m.IterationsPerOp > 0 {
+		add("iterations_per_op", strconv.FormatUint(uint64(m.IterationsPerOp), 10))
+	}
+	if m.Hostname != "" {
+		add("hostname", m.Hostname)
+	}
+	add("go_version", m.GoVersion)
+	if b := m.Build; b != nil {
+		add("build.path", b.Path)
+		add("build.version", b.Version)
+		if b.VCSRevision != "" {
+			add("build.vcs_revision", b.VCSRevision)
+			add("build.vcs_modified", strconv.FormatBool(b.VCSModified))
+		}
+	}
+
+	if cfg, ok := m.Modules[strings.ToLower(mod)]; ok {
+		for _, k := range slices.Sorted(maps.Keys(cfg.Args)) {
+			add("arg."+k, cfg.Args[k])
+		}
+		for _, k := range slices.Sorted(maps.Keys(cfg.Operations)) {
+			add("op."+k+".rate", strconv.FormatUint(uint64(cfg.Operations[k].Rate), 10))
+			add("op."+k+".disabled", strconv.FormatBool(cfg.Operations[k].Disabled))
+			if c := cfg.Operations[k].MaxConcurrency; c > 0 {
+				add("op."+k+".max_concurrency", strconv.FormatUint(uint64(c), 10))
+			}
+			if i := cfg.Operations[k].Iterations; i > 0 {
+				add("op."+k+".iterations", strconv.FormatUint(uint64(i), 10))
+			}
+		}
+	}
+
+	return props
+}
+
+// testCase creates the test case of a single operation from its stats, which
+// are nil if the operation was never executed.
+func (r *reporter) testCase(mod string, op *module.Op, opStats *stats.OpSnapshot) *testCase {
+	tc := &testCase{
+		Name:      op.Name,
+		ClassName: mod,
+	}
+
+	if opStats == nil {
+		msg := "operation was not executed"
+		if op.Disabled {
+			msg = "operation is disabled"
+		}
+		tc.Skipped = &skipped{Message: msg}
+		return tc
+	}
+
+	tc.Time = opStats.Total.Seconds()
+	tc.SystemOut = fmt.Sprintf(
+		"executions: %d\nok: %d\nnok: %d\nshortest: %s\nlongest: %s\naverage: %s\np50: %s\np95: %s\np99: %s\n"+
+			"missed_intervals: %.1f%%\npeak_workers: %d\nmax_in_flight: %d\nthrottled: %d\n",
+		opStats.Executions, opStats.OK, opStats.NOK, opStats.Shortest, opStats.Longest, opStats.Average(),
+		opStats.Latency.Quantile(quantile50), opStats.Latency.Quantile(quantile95), opStats.Latency.Quantile(quantile99),
+		opStats.MissedPerc(), opStats.PeakWorkers, opStats.MaxInFlight, opStats.Throttled,
+	)
+	if opStats.LimitedSamples > 0 {
+		tc.SystemOut += fmt.Sprintf(
+			"warning: the concurrency limit kept the target rate from being reached in %d of %d intervals\n",
+			opStats.LimitedSamples, opStats.Samples,
+		)
+	}
+
+	for _, abort := range opStats.Aborts {
+		tc.SystemOut += fmt.Sprintf("abort: %s, %s\n", abort.Action, abort.Reason)
+	}
+
+	violations := r.thresholds.Check(opStats.Executions, opStats.NOK, opStats.Average(), opStats.Longest)
+	if len(violations) > 0 {
+		tc.Failure = &failure{
+			Message: violations[0],
+			Type:    failureType,
+			Text:    strings.Join(violations, "\n"),
+		}
+		return tc
+	}
+
+	// An operation that was stopped or disabled by an abort condition fails,
+	// one that was only backed off is judged by the thresholds.
+	for _, abort := range opStats.Aborts {
+		if abort.Action != stats.AbortActionBackoff {
+			tc.Failure = &failure{
+				Message: "aborted: " + abort.Reason,
+				Type:    abortFailureType,
+				Text:    fmt.Sprintf("abort condition triggered (%s): %s", abort.Action, abort.Reason),
+			}
+			break
+		}
+	}
+
+	return tc
+}
@@ -0,0 +1,181 @@
+package junitreport
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+func newMetadata() module.Metadata {
+	mod := modulemock.NewMock()
+	mod.SetName = "mod"
+	mod.SetOps = module.Ops{
+		{Name: "fast"},
+		{Name: "slow"},
+		{Name: "off", Disabled: true},
+	}
+
+	return module.Metadata{{Module: mod}}
+}
+
+func runReport(t *testing.T, thresholds report.Thresholds) *testSuites {
+	t.Helper()
+
+	return runReportWithAborts(t, thresholds, nil)
+}
+
+// runReportWithAborts runs a report like runReport, additionally reporting the
+// aborts keyed by operation name.
+func runReportWithAborts(t *testing.T, thresholds report.Thresholds, aborts map[string]*stats.Abort) *testSuites {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "report.xml")
+	collector := stats.NewCollector()
+	r := New(&Opts{
+		Path:        path,
+		Metadata:    newMetadata(),
+		Thresholds:  thresholds,
+		Stats:       collector,
+		Logger:      logr.Discard(),
+		ErrorLogger: logr.Discard(),
+	})
+
+	r.Start(context.Background())
+	collector.Record("mod", "fast", &module.Result{Duration: time.Millisecond}, nil)
+	collector.Record("mod", "fast", &module.Result{Duration: time.Millisecond}, errors.New("operation error"))
+	collector.Record("mod", "slow", &module.Result{Duration: time.Second}, nil)
+	for op, abort := range aborts {
+		collector.RecordAbort("mod", op, abort)
+	}
+
+	if err := r.Finalise(); err != nil {
+		t.Fatal("error on finalise:", err)
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal("failed to read file:", path)
+	}
+
+	suites := &testSuites{}
+	if err = xml.Unmarshal(bs, suites); err != nil {
+		t.Fatal("failed to unmarshal report:", err)
+	}
+
+	return suites
+}
+
+func TestNoThresholds(t *testing.T) {
+	suites := runReport(t, report.Thresholds{})
+
+	if len(suites.Suites) != 1 || len(suites.Suites[0].Cases) != 3 {
+		t.Fatal("expected 1 suite with 3 test cases")
+	}
+
+	cases := suites.Suites[0].Cases
+	if cases[0].Failure == nil {
+		t.Fatal("fast should have failed since it had errors")
+	}
+	if cases[1].Failure != nil {
+		t.Fatal("slow should have passed without thresholds")
+	}
+	if cases[2].Skipped == nil {
+		t.Fatal("off should have been skipped")
+	}
+	if suites.Failures != 1 {
+		t.Fatalf("expected 1 failure, got %d", suites.Failures)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	suites := runReport(t, report.Thresholds{
+		MaxErrorRate: 0.6,
+		MaxLatency:   100 * time.Millisecond,
+	})
+
+	cases := suites.Suites[0].Cases
+	if cases[0].Failure != nil {
+		t.Fatal("fast should have passed, error rate is below the threshold")
+	}
+	if cases[1].Failure == nil {
+		t.Fatal("slow should have failed the latency threshold")
+	}
+	if cases[1].SystemOut == "" {
+		t.Fatal("expected summary stats in system-out")
+	}
+}
+
+func TestAborts(t *testing.T) {
+	suites := runReportWithAborts(t, report.Thresholds{MaxErrorRate: 0.6}, map[string]*stats.Abort{
+		"fast": {Action: "stop", Reason: "2 consecutive failures"},
+		"slow": {Action: "backoff", Reason: "2 consecutive failures"},
+	})
+
+	cases := suites.Suites[0].Cases
+	if cases[0].Failure == nil || cases[0].Failure.Type != abortFailureType {
+		t.Fatal("fast should have failed since it was aborted")
+	}
+	if !strings.Contains(cases[0].SystemOut, "abort: stop, 2 consecutive failures") {
+		t.Fatal("expected the abort in system-out, got", cases[0].SystemOut)
+	}
+	if cases[1].Failure != nil {
+		t.Fatal("slow should have passed, backing off does not fail an operation")
+	}
+}
+
+func TestProperties(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.xml")
+	metadata := newMetadata()
+	runMetadata := report.NewRunMetadata(metadata, time.Minute, 10)
+	runMetadata.Label = "nightly"
+	runMetadata.Tags = map[string]string{"env": "staging"}
+
+	r := New(&Opts{
+		Path:        path,
+		Metadata:    metadata,
+		RunMetadata: runMetadata,
+		Stats:       stats.NewCollector(),
+		Logger:      logr.Discard(),
+		ErrorLogger: logr.Discard(),
+	})
+	if err := r.Finalise(); err != nil {
+		t.Fatal("error on finalise:", err)
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal("failed to read file:", path)
+	}
+	suites := &testSuites{}
+	if err = xml.Unmarshal(bs, suites); err != nil {
+		t.Fatal("failed to unmarshal report:", err)
+	}
+
+	props := map[string]string{}
+	for _, p := range suites.Suites[0].Properties.Properties {
+		props[p.Name] = p.Value
+	}
+
+	for name, want := range map[string]string{
+		"label":           "nightly",
+		"tag.env":         "staging",
+		"duration":        "1m0s",
+		"worker_limit":    "10",
+		"op.off.disabled": "true",
+	} {
+		if props[name] != want {
+			t.Fatalf("expected property %s to be %q, got %q", name, want, props[name])
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package junitreport
+
+import "encoding/xml"
+
+type (
+	// testSuites is the root element of a JUnit XML report.
+	testSuites struct {
+		XMLName  xml.Name     `xml:"testsuites"`
+		Name     string       `xml:"name,attr"`
+		Tests    int          `xml:"tests,attr"`
+		Failures int          `xml:"failures,attr"`
+		Time     float64      `xml:"time,attr"`
+		Suites   []*testSuite `xml:"testsuite"`
+	}
+	// testSuite contains the test cases of a single module.
+	testSuite struct {
+		Name       string      `xml:"name,attr"`
+		Tests      int         `xml:"tests,attr"`
+		Failures   int         `xml:"failures,attr"`
+		Skipped    int         `xml:"skipped,attr"`
+		Time       float64     `xml:"time,attr"`
+		Timestamp  string      `xml:"timestamp,attr"`
+		Properties *properties `xml:"properties,omitempty"`
+		Cases      []*testCase `xml:"testcase"`
+	}
+	// properties of a test suite, describing the run configuration.
+	properties struct {
+		Properties []*property `xml:"property"`
+	}
+	// property is a single name-value pair.
+	property struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	}
+	// testCase is the outcome of a single operation.
+	testCase struct {
+		Name      string   `xml:"name,attr"`
+		ClassName string   `xml:"classname,attr"`
+		Time      float64  `xml:"time,attr"`
+		Failure   *failure `xml:"failure,omitempty"`
+		Skipped   *skipped `xml:"skipped,omitempty"`
+		SystemOut string   `xml:"system-out,omitempty"`
+	}
+	// failure marks a test case as failed.
+	failure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+	// skipped marks a test case as skipped.
+	skipped struct {
+		Message string `xml:"message,attr"`
+	}
+)
@@ -0,0 +1,148 @@
+package report
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+)
+
+type (
+	// RunMetadata records the resolved configuration and environment of a test
+	// run, so that a report can be traced back to what produced it.
+	RunMetadata struct {
+		// Label is a user-supplied name of the run.
+		Label string `json:"label,omitempty" yaml:"label,omitempty"`
+		// Tags are user-supplied key-value pairs describing the run.
+		Tags map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+		// Duration is the configured duration of the run.
+		Duration time.Duration `json:"duration" yaml:"duration"`
+		// WorkerLimit is the maximum number of concurrent workers per workload.
+		WorkerLimit int `json:"worker_limit" yaml:"worker_limit"`
+		// MaxInFlight is the maximum number of concurrent invocations across all
+		// operations, 0 if unlimited.
+		MaxInFlight int `json:"max_in_flight,omitempty" yaml:"max_in_flight,omitempty"`
+		// Iterations is the total number of invocations, 0 if unlimited.
+		Iterations uint `json:"iterations,omitempty" yaml:"iterations,omitempty"`
+		// IterationsPerOp is the default number of invocations per operation, 0
+		// if unlimited.
+		IterationsPerOp uint `json:"iterations_per_op,omitempty" yaml:"iterations_per_op,omitempty"`
+		// Abort are the abort conditions of the run, nil if none.
+		Abort *AbortConfig `json:"abort,omitempty" yaml:"abort,omitempty"`
+		// Hostname of the machine that ran the test.
+		Hostname string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+		// GoVersion is the Go version the binary was built with.
+		GoVersion string `json:"go_version" yaml:"go_version"`
+		// Build describes the binary that ran the test, if available.
+		Build *BuildInfo `json:"build,omitempty" yaml:"build,omitempty"`
+		// Modules maps module names to their configuration.
+		Modules map[string]*ModuleConfig `json:"modules" yaml:"modules"`
+	}
+	// AbortConfig is the configuration of the abort conditions of a run.
+	AbortConfig struct {
+		MaxErrorRate        float64       `json:"max_error_rate,omitempty"       yaml:"max_error_rate,omitempty"`
+		Window              time.Duration `json:"window"                         yaml:"window"`
+		MinCalls            uint          `json:"min_calls"                      yaml:"min_calls"`
+		ConsecutiveFailures uint          `json:"consecutive_failures,omitempty" yaml:"consecutive_failures,omitempty"`
+		Action              string        `json:"action"                         yaml:"action"`
+	}
+	// BuildInfo describes the main module of the binary and its version control state.
+	BuildInfo struct {
+		Path        string `json:"path"                   yaml:"path"`
+		Version     string `json:"version"                yaml:"version"`
+		VCS         string `json:"vcs,omitempty"          yaml:"vcs,omitempty"`
+		VCSRevision string `json:"vcs_revision,omitempty" yaml:"vcs_revision,omitempty"`
+		VCSTime     string `json:"vcs_time,omitempty"     yaml:"vcs_time,omitempty"`
+		VCSModified bool   `json:"vcs_modified,omitempty" yaml:"vcs_modified,omitempty"`
+	}
+	// ModuleConfig is the resolved configuration of a module. Secret args are
+	// left out.
+	ModuleConfig struct {
+		Args       map[string]string           `json:"args,omitempty" yaml:"args,omitempty"`
+		Operations map[string]*OperationConfig `json:"operation"      yaml:"operation"`
+	}
+	// OperationConfig is the resolved configuration of an operation.
+	OperationConfig struct {
+		// Rate is the configured rate per minute.
+		Rate     uint `json:"rate"     yaml:"rate"`
+		Disabled bool `json:"disabled" yaml:"disabled"`
+		// MaxConcurrency is the configured concurrency limit, 0 if the worker
+		// limit applies.
+		MaxConcurrency uint `json:"max_concurrency,omitempty" yaml:"max_concurrency,omitempty"`
+		// Iterations is the configured number of invocations, 0 if unlimited or
+		// given by the default of the run.
+		Iterations uint `json:"iterations,omitempty" yaml:"iterations,omitempty"`
+	}
+)
+
+// NewRunMetadata records the configuration of the modules, the duration and
+// worker limit of a run, and the environment it runs in.
+func NewRunMetadata(metadata module.Metadata, duration time.Duration, workerLimit int) *RunMetadata {
+	m := &RunMetadata{
+		Duration:    duration,
+		WorkerLimit: workerLimit,
+		GoVersion:   runtime.Version(),
+		Build:       newBuildInfo(),
+		Modules:     make(map[string]*ModuleConfig, len(metadata)),
+	}
+	// An unknown hostname is left out.
+	m.Hostname, _ = os.Hostname()
+
+	for _, meta := range metadata {
+		mod := &ModuleConfig{
+			Operations: make(map[string]*OperationConfig, len(meta.Ops())),
+		}
+
+		for _, v := range meta.Args().Values() {
+			if v.Secret {
+				continue
+			}
+			if mod.Args == nil {
+				mod.Args = make(map[string]string)
+			}
+			mod.Args[v.Name] = v.Value
+		}
+
+		for _, op := range meta.Ops() {
+			mod.Operations[op.Name] = &OperationConfig{
+				Rate:           op.Rate,
+				Disabled:       op.Disabled,
+				MaxConcurrency: op.MaxConcurrency,
+				Iterations:     op.Iterations,
+			}
+		}
+
+		m.Modules[strings.ToLower(meta.Name())] = mod
+	}
+
+	return m
+}
+
+func newBuildInfo() *BuildInfo {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+
+	b := &BuildInfo{
+		Path:    bi.Main.Path,
+		Version: bi.Main.Version,
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs":
+			b.VCS = s.Value
+		case "vcs.revision":
+			b.VCSRevision = s.Value
+		case "vcs.time":
+			b.VCSTime = s.Value
+		case "vcs.modified":
+			b.VCSModified = s.Value == "true"
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,52 @@
+package report
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+)
+
+func TestNewRunMetadata(t *testing.T) {
+	count := 12
+	token := "secret"
+	mod := &modulemock.Module{
+		SetName: "mod",
+		SetArgs: module.Args{
+			&module.Arg[int]{Name: "count", Value: &count},
+			&module.Arg[string]{Name: "token", Value: &token, Secret: true},
+		},
+		SetOps: module.Ops{
+			{Name: "on", Rate: 60},
+			{Name: "off", Rate: 30, Disabled: true},
+		},
+	}
+
+	m := NewRunMetadata(module.Metadata{{Module: mod}}, time.Minute, 5)
+
+	if m.Duration != time.Minute || m.WorkerLimit != 5 {
+		t.Fatal("unexpected duration or worker limit")
+	}
+	if m.GoVersion != runtime.Version() {
+		t.Fatalf("unexpected Go version %s", m.GoVersion)
+	}
+
+	cfg, ok := m.Modules["mod"]
+	if !ok {
+		t.Fatal("expected module config")
+	}
+	if cfg.Args["count"] != "12" {
+		t.Fatalf("unexpected count %q", cfg.Args["count"])
+	}
+	if _, ok = cfg.Args["token"]; ok {
+		t.Fatal("secret arg should not be recorded")
+	}
+	if op := cfg.Operations["on"]; op.Rate != 60 || op.Disabled {
+		t.Fatal("unexpected config of op 'on'")
+	}
+	if op := cfg.Operations["off"]; op.Rate != 30 || !op.Disabled {
+		t.Fatal("unexpected config of op 'off'")
+	}
+}
@@ -0,0 +1,284 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+type (
+	// Report is the final report of a test. It contains all the information about the execution of the modules and
+	// their operations.
+	Report struct {
+		Start    time.Time     `json:"start"    yaml:"start"`
+		End      time.Time     `json:"end"      yaml:"end"`
+		Duration time.Duration `json:"duration" yaml:"duration"`
+		// Metadata records the configuration and environment of the run, if known.
+		Metadata *RunMetadata             `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+		Modules  map[string]*ModuleReport `json:"modules"            yaml:"modules"`
+		// Warnings about the run, e.g. operations that could not reach their
+		// target rate because of the worker limit.
+		Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+		// Aborted is the reason the test was stopped by an abort condition, if it
+		// was.
+		Aborted string `json:"aborted,omitempty" yaml:"aborted,omitempty"`
+		// Timeline lists the changes made to running traffic, such as rate
+		// changes made from the TUI, and the abort conditions that triggered, in
+		// order.
+		Timeline []*TimelineEntry `json:"timeline,omitempty" yaml:"timeline,omitempty"`
+	}
+	// TimelineEntry is a change made to running traffic during a test.
+	TimelineEntry struct {
+		Time time.Time `json:"time"             yaml:"time"`
+		// Module and Op the change applies to, empty if it applies to all
+		// traffic.
+		Module string `json:"module,omitempty" yaml:"module,omitempty"`
+		Op     string `json:"op,omitempty"     yaml:"op,omitempty"`
+		// Event is the kind of change, e.g. rate, pause or abort.
+		Event string `json:"event"            yaml:"event"`
+		// Detail describes the change, e.g. the new rate.
+		Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+	}
+	// ModuleReport contains the report information for a module. It contains the operations and their respective reports.
+	ModuleReport struct {
+		Operations map[string]*OperationDetails `json:"operation" yaml:"operation"`
+	}
+	// OperationDetails contains the report information for an operation.
+	OperationDetails struct {
+		Executions  uint                  `json:"executions"  yaml:"executions"`
+		OK          uint                  `json:"ok"          yaml:"ok"`
+		NOK         uint                  `json:"nok"         yaml:"nok"`
+		Timing      *OperationTiming      `json:"timing"      yaml:"timing"`
+		Rate        *OperationRate        `json:"rate"        yaml:"rate"`
+		Concurrency *OperationConcurrency `json:"concurrency" yaml:"concurrency"`
+		// Aborts are the abort conditions that triggered for the operation.
+		Aborts []*OperationAbort `json:"aborts,omitempty" yaml:"aborts,omitempty"`
+	}
+	// OperationAbort is an abort condition that triggered for an operation.
+	OperationAbort struct {
+		Time time.Time `json:"time"   yaml:"time"`
+		// Action taken, stop, disable or backoff.
+		Action string `json:"action" yaml:"action"`
+		// Reason describes the condition that triggered.
+		Reason string `json:"reason" yaml:"reason"`
+	}
+	// OperationRate compares the rate an operation was called at to its target
+	// rate, and describes how the traffic scheduler kept up.
+	OperationRate struct {
+		// Target is the configured rate per minute, if known.
+		Target uint `json:"target"           yaml:"target"`
+		// Achieved is the mean rate per minute over the duration of the test.
+		Achieved float64 `json:"achieved"         yaml:"achieved"`
+		// Intervals is the number of sampling intervals of the scheduler.
+		Intervals uint `json:"intervals"        yaml:"intervals"`
+		// MissedIntervals is the percentage of the sampling intervals in which the
+		// target rate was missed by more than the scheduler's tolerance.
+		MissedIntervals float64 `json:"missed_intervals" yaml:"missed_intervals"`
+		// PeakWorkers is the largest number of workers the operation ran with.
+		PeakWorkers int `json:"peak_workers"     yaml:"peak_workers"`
+		// WorkerLimited is set if the concurrency limit of the operation kept the
+		// scheduler from reaching the target rate in any sampling interval.
+		WorkerLimited bool `json:"worker_limited"   yaml:"worker_limited"`
+	}
+	// OperationConcurrency describes the concurrent invocations of an
+	// operation and how often the concurrency limits were hit.
+	OperationConcurrency struct {
+		// Limit is the concurrency limit of the operation, if known.
+		Limit uint `json:"limit"             yaml:"limit"`
+		// MaxInFlight is the largest number of concurrent invocations.
+		MaxInFlight int `json:"max_in_flight"     yaml:"max_in_flight"`
+		// LimitedIntervals is the number of sampling intervals in which the limit
+		// of the operation kept the target rate from being reached.
+		LimitedIntervals uint `json:"limited_intervals" yaml:"limited_intervals"`
+		// Throttled is the number of invocations that waited for the global
+		// in-flight limit.
+		Throttled uint `json:"throttled"         yaml:"throttled"`
+	}
+	// OperationTiming contains the timing information for an operation. Only
+	// successful invocations count towards timing stats.
+	OperationTiming struct {
+		Longest  time.Duration `json:"longest"  yaml:"longest"`
+		Shortest time.Duration `json:"shortest" yaml:"shortest"`
+		Average  time.Duration `json:"average"  yaml:"average"`
+		P50      time.Duration `json:"p50"      yaml:"p50"`
+		P95      time.Duration `json:"p95"      yaml:"p95"`
+		P99      time.Duration `json:"p99"      yaml:"p99"`
+	}
+)
+
+const (
+	// timelineAbort is the timeline event of an abort condition that triggered.
+	timelineAbort = "abort"
+
+	quantile50 = 0.50
+	quantile95 = 0.95
+	quantile99 = 0.99
+)
+
+// NewReport creates a report of a test that started at start, from a stats
+// snapshot taken when the test ended. The run metadata, which may be nil, is
+// included in the report and provides the target rates of the operations.
+func NewReport(start time.Time, snapshot *stats.Snapshot, metadata *RunMetadata) *Report {
+	r := &Report{
+		Start:    start,
+		End:      snapshot.Time,
+		Duration: snapshot.Time.Sub(start),
+		Metadata: metadata,
+		Modules:  make(map[string]*ModuleReport),
+	}
+
+	for _, op := range snapshot.Ops {
+		details := newOperationDetails(op, r.Duration, metadata.operation(op.Module, op.Op))
+		r.module(op.Module).Operations[op.Op] = details
+
+		if details.Rate.WorkerLimited {
+			r.Warnings = append(r.Warnings, fmt.Sprintf(
+				"%s.%s: the concurrency limit of %d kept the target rate of %d/min from being reached in %d of %d intervals",
+				op.Module, op.Op, details.Concurrency.Limit, details.Rate.Target, op.LimitedSamples, op.Samples,
+			))
+		}
+		if op.Throttled > 0 {
+			r.Warnings = append(r.Warnings, fmt.Sprintf(
+				"%s.%s: %d invocations waited for the in-flight limit of %d",
+				op.Module, op.Op, op.Throttled, metadata.maxInFlight(),
+			))
+		}
+		for _, abort := range op.Aborts {
+			r.Timeline = append(r.Timeline, &TimelineEntry{
+				Time:   abort.Time,
+				Module: op.Module,
+				Op:     op.Op,
+				Event:  timelineAbort,
+				Detail: abort.Action + ": " + abort.Reason,
+			})
+			r.Warnings = append(r.Warnings, fmt.Sprintf(
+				"%s.%s: abort condition triggered (%s): %s", op.Module, op.Op, abort.Action, abort.Reason,
+			))
+			if abort.Action == stats.AbortActionStop && r.Aborted == "" {
+				r.Aborted = fmt.Sprintf("%s.%s: %s", op.Module, op.Op, abort.Reason)
+			}
+		}
+	}
+	sort.Strings(r.Warnings)
+
+	for _, event := range snapshot.Events {
+		r.Timeline = append(r.Timeline, &TimelineEntry{
+			Time:   event.Time,
+			Module: event.Module,
+			Op:     event.Op,
+			Event:  event.Kind,
+			Detail: event.Detail,
+		})
+	}
+	sort.SliceStable(r.Timeline, func(i, j int) bool { return r.Timeline[i].Time.Before(r.Timeline[j].Time) })
+
+	return r
+}
+
+// Operation returns the details of an operation, or nil if it was never executed.
+func (r *Report) Operation(mod, op string) *OperationDetails {
+	m, ok := r.Modules[mod]
+	if !ok {
+		return nil
+	}
+
+	return m.Operations[op]
+}
+
+func newModuleReport() *ModuleReport {
+	return &ModuleReport{
+		Operations: make(map[string]*OperationDetails),
+	}
+}
+
+// newOperationDetails creates the details of an operation from its stats. The
+// configuration of the operation provides its target rate and concurrency
+// limit.
+func newOperationDetails(op *stats.OpSnapshot, duration time.Duration, config operationConfig) *OperationDetails {
+	rate := &OperationRate{
+		Target:          config.Rate,
+		Intervals:       uint(op.Samples),
+		MissedIntervals: op.MissedPerc(),
+		PeakWorkers:     op.PeakWorkers,
+		WorkerLimited:   op.LimitedSamples > 0,
+	}
+	if duration > 0 {
+		rate.Achieved = float64(op.Executions) / duration.Minutes()
+	}
+
+	var aborts []*OperationAbort
+	for _, abort := range op.Aborts {
+		aborts = append(aborts, &OperationAbort{Time: abort.Time, Action: abort.Action, Reason: abort.Reason})
+	}
+
+	return &OperationDetails{
+		Aborts: aborts,
+		Rate:   rate,
+		Concurrency: &OperationConcurrency{
+			Limit:            config.limit,
+			MaxInFlight:      op.MaxInFlight,
+			LimitedIntervals: uint(op.LimitedSamples),
+			Throttled:        uint(op.Throttled),
+		},
+		Executions: uint(op.Executions),
+		OK:         uint(op.OK),
+		NOK:        uint(op.NOK),
+		Timing: &OperationTiming{
+			Longest:  op.Longest,
+			Shortest: op.Shortest,
+			Average:  op.Average(),
+			P50:      op.Latency.Quantile(quantile50),
+			P95:      op.Latency.Quantile(quantile95),
+			P99:      op.Latency.Quantile(quantile99),
+		},
+	}
+}
+
+func (r *Report) module(mod string) *ModuleReport {
+	m, ok := r.Modules[mod]
+	if !ok {
+		m = newModuleReport()
+		r.Modules[mod] = m
+	}
+
+	return m
+}
+
+// operationConfig is the configuration of an operation, with its effective
+// concurrency limit.
+type operationConfig struct {
+	OperationConfig
+
+	limit uint
+}
+
+// operation returns the configuration of an operation, zero if unknown.
+func (m *RunMetadata) operation(mod, op string) operationConfig {
+	if m == nil {
+		return operationConfig{}
+	}
+
+	config := operationConfig{limit: uint(max(m.WorkerLimit, 0))}
+	if modConfig, ok := m.Modules[strings.ToLower(mod)]; ok {
+		if opConfig, ok := modConfig.Operations[op]; ok { //nolint:govet // shad
+			config.OperationConfig = *opConfig
+		}
+	}
+	if config.MaxConcurrency > 0 {
+		config.limit = config.MaxConcurrency
+	}
+
+	return config
+}
+
+// maxInFlight returns the global in-flight limit, 0 if unknown or unlimited.
+func (m *RunMetadata) maxInFlight() int {
+	if m == nil {
+		return 0
+	}
+
+	return m.MaxInFlight
+}
@@ -0,0 +1,143 @@
+package report
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+func TestNewReport(t *testing.T) {
+	collector := stats.NewCollector()
+	collector.Record("mod", "op", &module.Result{Duration: time.Second}, nil)
+	collector.Record("mod", "op", &module.Result{Duration: time.Second}, nil)
+	collector.Record("mod", "op", &module.Result{Duration: time.Second}, errors.New("error"))
+	collector.Record("mod", "op", &module.Result{Duration: 4 * time.Second}, nil)
+
+	start := time.Now()
+	r := NewReport(start, collector.Snapshot(), nil)
+	if !r.Start.Equal(start) || r.End.Before(start) {
+		t.Fatal("unexpected start or end")
+	}
+
+	v := r.Operation("mod", "op")
+	if v == nil {
+		t.Fatal("'op' expected in report")
+	}
+	if v.Executions != 4 {
+		t.Fatal("expected 4 execs")
+	}
+	if v.OK != 3 {
+		t.Fatal("expected 3 OK")
+	}
+	if v.NOK != 1 {
+		t.Fatal("expected 1 NOK")
+	}
+	if v.Timing.Longest != 4*time.Second {
+		t.Fatal("expected longest 4 seconds")
+	}
+	if v.Timing.Average != 2*time.Second {
+		t.Fatal("expected average 2 seconds")
+	}
+	if v.Timing.Shortest != time.Second {
+		t.Fatal("expected shortest 1 second")
+	}
+	if v.Timing.P50 < time.Second || v.Timing.P50 > 1100*time.Millisecond {
+		t.Fatal("expected p50 close to 1 second, got", v.Timing.P50)
+	}
+}
+
+func TestNewReportRate(t *testing.T) {
+	collector := stats.NewCollector()
+	for range 30 {
+		collector.Record("Mod", "op", &module.Result{Duration: time.Millisecond}, nil)
+	}
+	collector.RecordRate("Mod", "op", &stats.RateSample{Workers: 1})
+	collector.RecordRate("Mod", "op", &stats.RateSample{
+		Workers: 2, MaxInFlight: 2, Throttled: 3, Missed: true, WorkerLimited: true,
+	})
+
+	metadata := &RunMetadata{
+		WorkerLimit: 10,
+		MaxInFlight: 4,
+		Modules: map[string]*ModuleConfig{
+			"mod": {Operations: map[string]*OperationConfig{"op": {Rate: 60, MaxConcurrency: 2}}},
+		},
+	}
+	snapshot := collector.Snapshot()
+	r := NewReport(snapshot.Time.Add(-time.Minute), snapshot, metadata)
+	if r.Metadata != metadata {
+		t.Fatal("expected metadata in report")
+	}
+
+	rate := r.Operation("Mod", "op").Rate
+	if rate.Target != 60 {
+		t.Fatal("expected target 60, got", rate.Target)
+	}
+	if rate.Achieved != 30 {
+		t.Fatal("expected achieved 30, got", rate.Achieved)
+	}
+	if rate.Intervals != 2 || rate.MissedIntervals != 50 || rate.PeakWorkers != 2 || !rate.WorkerLimited {
+		t.Fatalf("unexpected rate %+v", rate)
+	}
+
+	concurrency := r.Operation("Mod", "op").Concurrency
+	if concurrency.Limit != 2 || concurrency.MaxInFlight != 2 || concurrency.LimitedIntervals != 1 ||
+		concurrency.Throttled != 3 {
+		t.Fatalf("unexpected concurrency %+v", concurrency)
+	}
+	if len(r.Warnings) != 2 {
+		t.Fatal("expected concurrency and in-flight limit warnings, got", r.Warnings)
+	}
+}
+
+func TestNewReportAborts(t *testing.T) {
+	collector := stats.NewCollector()
+	collector.Record("mod", "slow", &module.Result{}, errors.New("fail"))
+	collector.RecordAbort("mod", "slow", &stats.Abort{Action: "backoff", Reason: "3 consecutive failures"})
+	collector.RecordAbort("mod", "down", &stats.Abort{
+		Action: "stop", Reason: "error rate 100.00% over 30s exceeds 50.00%",
+	})
+
+	snapshot := collector.Snapshot()
+	r := NewReport(snapshot.Time, snapshot, nil)
+
+	if aborts := r.Operation("mod", "slow").Aborts; len(aborts) != 1 || aborts[0].Action != "backoff" {
+		t.Fatal("unexpected aborts", aborts)
+	}
+	if r.Aborted != "mod.down: error rate 100.00% over 30s exceeds 50.00%" {
+		t.Fatal("expected the stop reason, got", r.Aborted)
+	}
+	if len(r.Warnings) != 2 {
+		t.Fatal("expected a warning per abort, got", r.Warnings)
+	}
+}
+
+func TestNewReportTimeline(t *testing.T) {
+	start := time.Now()
+	collector := stats.NewCollector()
+	collector.RecordRunEvent(&stats.RunEvent{
+		Time: start.Add(time.Second), Module: "mod", Op: "op", Kind: stats.RunEventRate, Detail: "120/min",
+	})
+	collector.RecordRunEvent(&stats.RunEvent{Time: start.Add(3 * time.Second), Kind: stats.RunEventPause})
+	collector.RecordAbort("mod", "op", &stats.Abort{
+		Time: start.Add(2 * time.Second), Action: "backoff", Reason: "3 consecutive failures",
+	})
+
+	snapshot := collector.Snapshot()
+	r := NewReport(start, snapshot, nil)
+
+	if len(r.Timeline) != 3 {
+		t.Fatal("expected 3 timeline entries, got", len(r.Timeline))
+	}
+	for i, event := range []string{stats.RunEventRate, timelineAbort, stats.RunEventPause} {
+		if r.Timeline[i].Event != event {
+			t.Fatalf("expected %s at %d, got %s", event, i, r.Timeline[i].Event)
+		}
+	}
+	if r.Timeline[1].Detail != "backoff: 3 consecutive failures" || r.Timeline[2].Module != "" {
+		t.Fatalf("unexpected timeline entries %+v %+v", r.Timeline[1], r.Timeline[2])
+	}
+}
@@ -0,0 +1,202 @@
+// Package progressreport provides a reporter that periodically prints a plain
+// text summary of the operations, meant for CI logs and other outputs that are
+// not a terminal.
+package progressreport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+type (
+	// Opts contains options for the progress reporter.
+	Opts struct {
+		// Interval between summaries. Defaults to 30 seconds.
+		Interval time.Duration
+		// Duration is the total test duration, printed next to the elapsed time
+		// if set.
+		Duration time.Duration
+		// Output the summaries are written to. Defaults to stdout.
+		Output io.Writer
+		// Stats is a collector shared with other reporters, which must receive
+		// the operation results. It is required, the summaries are read from it.
+		Stats *stats.Collector
+		// Logger is the logger used for info-level logging by the reporter.
+		Logger logr.Logger
+	}
+
+	// reporter implements the reporter interface.
+	reporter struct {
+		interval time.Duration
+		duration time.Duration
+		logger   logr.Logger
+
+		// stats aggregates the operation results.
+		stats *stats.Collector
+
+		// outLock serialises the writes of summaries and errors to out.
+		outLock sync.Mutex
+		out     io.Writer
+
+		start   time.Time
+		stopped chan struct{}
+	}
+)
+
+const (
+	defaultInterval = 30 * time.Second
+	// tabPadding is the padding between the columns of a summary.
+	tabPadding = 2
+)
+
+var _ report.Reporter = &reporter{}
+
+// New creates a new progress reporter.
+func New(opts *Opts) report.Reporter {
+	r := &reporter{
+		interval: opts.Interval,
+		duration: opts.Duration,
+		out:      opts.Output,
+		stats:    opts.Stats,
+		logger:   opts.Logger,
+		stopped:  make(chan struct{}),
+	}
+	if r.interval <= 0 {
+		r.interval = defaultInterval
+	}
+	if r.out == nil {
+		r.out = os.Stdout
+	}
+	return r
+}
+
+// Start prints a summary every interval until the context is cancelled, and
+// then a last one for the time since the previous summary.
+func (r *reporter) Start(ctx context.Context) {
+	r.logger.Info("Starting progress reporter", "interval", r.interval)
+	r.start = time.Now()
+	prev := r.stats.Snapshot()
+
+	go func() {
+		defer close(r.stopped)
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				next := r.stats.Snapshot()
+				r.print(prev, next, false)
+				prev = next
+			case <-ctx.Done():
+				r.print(prev, r.stats.Snapshot(), true)
+				return
+			}
+		}
+	}()
+}
+
+// ReportError prints the error between the summaries.
+func (r *reporter) ReportError(err error) {
+	r.outLock.Lock()
+	defer r.outLock.Unlock()
+
+	_, _ = fmt.Fprintf(r.out, "[%s] error: %v\n", formatElapsed(time.Since(r.start)), err)
+}
+
+// ReportOp implements report.Reporter. Operation results are read from the
+// shared collector instead.
+func (r *reporter) ReportOp(string, string, *module.Result, error) {}
+
+// Finalise waits for the last summary to be printed.
+func (r *reporter) Finalise() error {
+	<-r.stopped
+	return nil
+}
+
+/*INTERNAL*/
+
+// print writes a summary of the operations between two snapshots: their
+// achieved rate, their errors and the percentiles of their latencies. last is
+// set for the summary printed when the test ends.
+func (r *reporter) print(prev, next *stats.Snapshot, last bool) {
+	d := next.Time.Sub(prev.Time)
+	if d <= 0 {
+		return
+	}
+
+	r.outLock.Lock()
+	defer r.outLock.Unlock()
+
+	elapsed := formatElapsed(next.Time.Sub(r.start))
+	if r.duration > 0 {
+		elapsed += " / " + formatElapsed(r.duration)
+	}
+	title := "progress"
+	if last {
+		title = "progress, final"
+	}
+	_, _ = fmt.Fprintf(r.out, "[%s] %s, last %s\n", elapsed, title, d.Round(time.Second))
+
+	if len(next.Ops) == 0 {
+		_, _ = fmt.Fprintln(r.out, "no operations called yet")
+		return
+	}
+
+	tw := tabwriter.NewWriter(r.out, 0, 0, tabPadding, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "operation\trate/min\tcalls\terrors\tp50\tp95\tp99\t")
+	for _, op := range next.Ops {
+		delta := op.Sub(prev.Op(op.Module, op.Op))
+		_, _ = fmt.Fprintf(tw, "%s.%s\t%.1f\t%d\t%d\t%s\t%s\t%s\t\n",
+			op.Module, op.Op,
+			float64(delta.Executions)/d.Minutes(),
+			delta.Executions,
+			delta.NOK,
+			formatLatency(delta.Latency, 0.5),  //nolint:mnd // p50
+			formatLatency(delta.Latency, 0.95), //nolint:mnd // p95
+			formatLatency(delta.Latency, 0.99), //nolint:mnd // p99
+		)
+	}
+	_ = tw.Flush()
+}
+
+// formatLatency formats the quantile q of latencies to three significant
+// digits, or "-" if there are none.
+func formatLatency(latency *stats.HistogramSnapshot, q float64) string {
+	if latency.Count() == 0 {
+		return "-"
+	}
+
+	d := latency.Quantile(q)
+	precision := time.Duration(1)
+	for d/precision >= 1000 { //nolint:mnd // three digits
+		precision *= 10
+	}
+
+	return d.Round(precision).String()
+}
+
+// formatElapsed formats a duration as MM:SS or H:MM:SS.
+func formatElapsed(d time.Duration) string {
+	d = max(d, 0).Round(time.Second)
+
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60 //nolint:mnd // minutes per hour
+	s := int(d.Seconds()) % 60 //nolint:mnd // seconds per minute
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
@@ -0,0 +1,94 @@
+package progressreport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+func TestProgressReporter(t *testing.T) {
+	out := &bytes.Buffer{}
+	collector := stats.NewCollector()
+	r := New(&Opts{
+		Interval: 50 * time.Millisecond,
+		Duration: time.Minute,
+		Output:   out,
+		Stats:    collector,
+		Logger:   logr.Discard(),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	for range 10 {
+		collector.Record("mod", "op", &module.Result{Duration: 10 * time.Millisecond}, nil)
+	}
+	collector.Record("mod", "op", &module.Result{}, errors.New("operation error"))
+	time.Sleep(120 * time.Millisecond)
+
+	collector.Record("mod", "op2", &module.Result{Duration: time.Second}, nil)
+	cancel()
+	if err := r.Finalise(); err != nil {
+		t.Fatal("error on finalise", err)
+	}
+
+	summaries := strings.Split(out.String(), "[")
+	if len(summaries) < 3 {
+		t.Fatalf("expected at least 2 summaries, got:\n%s", out.String())
+	}
+
+	first := summaries[1]
+	if !strings.Contains(first, "/ 01:00] progress, last 0s") {
+		t.Errorf("unexpected title of the first summary:\n%s", first)
+	}
+	fields := opFields(first, "mod.op")
+	if len(fields) != 7 || fields[2] != "11" || fields[3] != "1" || fields[4] != "10ms" {
+		t.Errorf("unexpected mod.op row %v in:\n%s", fields, first)
+	}
+
+	final := summaries[len(summaries)-1]
+	if !strings.Contains(final, "progress, final") {
+		t.Errorf("expected the final summary last:\n%s", final)
+	}
+	if fields = opFields(final, "mod.op"); len(fields) != 7 || fields[2] != "0" || fields[4] != "-" {
+		t.Errorf("expected no mod.op calls in the final summary, got %v", fields)
+	}
+	if fields = opFields(final, "mod.op2"); len(fields) != 7 || fields[2] != "1" || fields[6] != "1s" {
+		t.Errorf("expected a mod.op2 call in the final summary, got %v", fields)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := New(&Opts{Output: out, Stats: stats.NewCollector(), Logger: logr.Discard()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+	r.ReportError(errors.New("traffic failure"))
+	cancel()
+	if err := r.Finalise(); err != nil {
+		t.Fatal("error on finalise", err)
+	}
+
+	if !strings.HasPrefix(out.String(), "[00:00] error: traffic failure\n") {
+		t.Errorf("expected the error first, got:\n%s", out.String())
+	}
+}
+
+// opFields returns the fields of the row of an operation in a summary.
+func opFields(summary, op string) []string {
+	for _, line := range strings.Split(summary, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == op {
+			return fields
+		}
+	}
+
+	return nil
+}
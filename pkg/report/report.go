@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report/stats"
 )
 
 type (
@@ -13,4 +14,19 @@ type (
 		ReportOp(module, op string, result *module.Result, err error)
 		Finalise() error
 	}
+	// RateReporter is implemented by reporters that receive the rate samples of
+	// the traffic scheduler, in addition to operation results.
+	RateReporter interface {
+		ReportRate(module, op string, sample *stats.RateSample)
+	}
+	// AbortReporter is implemented by reporters that are told when an abort
+	// condition of the traffic scheduler triggers for an operation.
+	AbortReporter interface {
+		ReportAbort(module, op string, abort *stats.Abort)
+	}
+	// RunEventReporter is implemented by reporters that are told about changes
+	// made to running traffic, such as rate changes made from the TUI.
+	RunEventReporter interface {
+		ReportRunEvent(event *stats.RunEvent)
+	}
 )
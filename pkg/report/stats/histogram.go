@@ -0,0 +1,203 @@
+package stats
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// The histogram uses log-linear buckets: durations below 2*subCount nanoseconds
+// are counted exactly, larger durations are split into subCount buckets per power
+// of two. This bounds the relative error of any quantile to 1/subCount (~1.6%)
+// while keeping the bucket count fixed.
+const (
+	subBits    = 6
+	subCount   = 1 << subBits
+	numBuckets = 64 * subCount
+)
+
+type (
+	// Histogram is a lock-free latency histogram. Its zero value is ready to use.
+	Histogram struct {
+		counts [numBuckets]atomic.Uint64
+	}
+
+	// HistogramSnapshot is a point-in-time copy of a Histogram. Only the range of
+	// buckets between the first and last non-empty bucket is stored.
+	HistogramSnapshot struct {
+		offset int
+		counts []uint64
+		total  uint64
+	}
+)
+
+// Record adds a duration to the histogram. Negative durations are counted as zero.
+func (h *Histogram) Record(d time.Duration) {
+	h.counts[bucketIndex(d)].Add(1)
+}
+
+// Snapshot copies the current bucket counts.
+func (h *Histogram) Snapshot() *HistogramSnapshot {
+	first, last := -1, -1
+	for i := range h.counts {
+		if h.counts[i].Load() > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	s := &HistogramSnapshot{}
+	if first < 0 {
+		return s
+	}
+
+	s.offset = first
+	s.counts = make([]uint64, last-first+1)
+	for i := range s.counts {
+		s.counts[i] = h.counts[first+i].Load()
+		s.total += s.counts[i]
+	}
+
+	return s
+}
+
+// Count returns the number of recorded durations.
+func (s *HistogramSnapshot) Count() uint64 {
+	return s.total
+}
+
+// Quantile returns the duration below which the fraction q of recorded durations
+// fall, e.g. 0.99 for the 99th percentile. Zero is returned for an empty snapshot.
+func (s *HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(s.total)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var cumulative uint64
+	for i, c := range s.counts {
+		cumulative += c
+		if cumulative >= rank {
+			return bucketValue(s.offset + i)
+		}
+	}
+
+	return bucketValue(s.offset + len(s.counts) - 1)
+}
+
+// Sub returns the durations recorded since prev was taken from the same histogram.
+// A nil prev returns a copy of s.
+func (s *HistogramSnapshot) Sub(prev *HistogramSnapshot) *HistogramSnapshot {
+	return s.combine(prev, func(a, b uint64) uint64 {
+		if b > a {
+			return 0
+		}
+		return a - b
+	})
+}
+
+// Add returns the sum of s and other, useful to merge consecutive intervals into a window.
+func (s *HistogramSnapshot) Add(other *HistogramSnapshot) *HistogramSnapshot {
+	return s.combine(other, func(a, b uint64) uint64 { return a + b })
+}
+
+// Buckets calls f for each non-empty bucket in ascending order, with the
+// bucket's lower and upper bounds and its count.
+func (s *HistogramSnapshot) Buckets(f func(lower, upper time.Duration, count uint64)) {
+	for i, c := range s.counts {
+		if c == 0 {
+			continue
+		}
+		lower, upper := bucketBounds(s.offset + i)
+		f(lower, upper, c)
+	}
+}
+
+/*INTERNAL*/
+
+// combine applies op to each bucket of s and other, covering the range of both.
+func (s *HistogramSnapshot) combine(other *HistogramSnapshot, op func(a, b uint64) uint64) *HistogramSnapshot {
+	if other == nil || len(other.counts) == 0 {
+		other = &HistogramSnapshot{offset: s.offset}
+	}
+	if len(s.counts) == 0 {
+		s = &HistogramSnapshot{offset: other.offset}
+	}
+
+	first := min(s.offset, other.offset)
+	last := max(s.offset+len(s.counts), other.offset+len(other.counts))
+
+	res := &HistogramSnapshot{offset: first, counts: make([]uint64, last-first)}
+	for i := range res.counts {
+		res.counts[i] = op(s.at(first+i), other.at(first+i))
+		res.total += res.counts[i]
+	}
+
+	return res.trim()
+}
+
+// at returns the count of the bucket with the given absolute index.
+func (s *HistogramSnapshot) at(idx int) uint64 {
+	if idx < s.offset || idx >= s.offset+len(s.counts) {
+		return 0
+	}
+	return s.counts[idx-s.offset]
+}
+
+// trim drops empty buckets at both ends.
+func (s *HistogramSnapshot) trim() *HistogramSnapshot {
+	start, end := 0, len(s.counts)
+	for start < end && s.counts[start] == 0 {
+		start++
+	}
+	for end > start && s.counts[end-1] == 0 {
+		end--
+	}
+
+	if start == end {
+		return &HistogramSnapshot{}
+	}
+
+	s.offset += start
+	s.counts = s.counts[start:end]
+	return s
+}
+
+// bucketIndex returns the index of the bucket counting d.
+func bucketIndex(d time.Duration) int {
+	if d < 0 {
+		d = 0
+	}
+
+	v := uint64(d)
+	if v < 2*subCount {
+		return int(v)
+	}
+
+	shift := bits.Len64(v) - subBits - 1
+	return shift*subCount + int(v>>shift)
+}
+
+// bucketBounds returns the inclusive lower and exclusive upper bound of a bucket.
+func bucketBounds(idx int) (time.Duration, time.Duration) {
+	if idx < 2*subCount {
+		return time.Duration(idx), time.Duration(idx + 1)
+	}
+
+	shift := idx/subCount - 1
+	mantissa := uint64(idx%subCount + subCount)
+	return time.Duration(mantissa << shift), time.Duration((mantissa + 1) << shift)
+}
+
+// bucketValue returns the value representing a bucket, its midpoint.
+func bucketValue(idx int) time.Duration {
+	lower, upper := bucketBounds(idx)
+	return lower + (upper-lower)/2
+}
@@ -0,0 +1,417 @@
+// Package stats implements the lock-free aggregation of operation results that
+// is shared by all reporters. Results are recorded synchronously into per-op
+// atomic counters and latency histograms, which are read through snapshots, so
+// nothing is queued and no result is lost when a test stops.
+package stats
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+)
+
+type (
+	// Collector aggregates operation results. It is safe for concurrent use and
+	// implements the report.Reporter, report.RateReporter,
+	// report.AbortReporter and report.RunEventReporter interfaces, so it can be
+	// added to a collection reporter to receive results on behalf of other
+	// reporters that read its snapshots.
+	Collector struct {
+		// ops maps an opKey to its *opCounters.
+		ops sync.Map
+
+		// Run events are rare, so they are kept in a slice behind a lock.
+		eventLock sync.Mutex
+		events    []RunEvent
+	}
+
+	// opKey identifies an operation.
+	opKey struct {
+		mod string
+		op  string
+	}
+
+	// opCounters holds the running totals of a single operation.
+	opCounters struct {
+		ok       atomic.Uint64
+		nok      atomic.Uint64
+		total    atomic.Int64
+		shortest atomic.Int64
+		longest  atomic.Int64
+		latency  Histogram
+
+		// Rate sample totals.
+		samples     atomic.Uint64
+		missed      atomic.Uint64
+		limited     atomic.Uint64
+		peakWorkers atomic.Int64
+		maxInFlight atomic.Int64
+		throttled   atomic.Uint64
+
+		// Aborts are rare, so they are kept in a slice behind a lock.
+		abortLock sync.Mutex
+		aborts    []Abort
+	}
+
+	// RateSample is the outcome of one sampling interval of the traffic
+	// scheduler, in which the calls made to an operation are compared to the
+	// target rate.
+	RateSample struct {
+		// Interval is the length of the sampling interval.
+		Interval time.Duration
+		// Calls is the number of calls made in the interval.
+		Calls uint64
+		// Expected is the number of calls the target rate requires per interval.
+		Expected float64
+		// Workers is the number of workers that made the calls.
+		Workers int
+		// MaxInFlight is the largest number of concurrent calls in the interval.
+		MaxInFlight int
+		// Throttled is the number of calls in the interval that waited for the
+		// global in-flight limit.
+		Throttled uint64
+		// Missed is set if the calls fell short of the expected calls by more
+		// than the scheduler's tolerance.
+		Missed bool
+		// WorkerLimited is set if the target rate was missed because the
+		// concurrency limit of the operation prevented the scheduler from adding
+		// the workers it needed.
+		WorkerLimited bool
+	}
+
+	// Abort is an abort condition of the traffic scheduler that triggered for
+	// an operation.
+	Abort struct {
+		// Time the condition triggered.
+		Time time.Time
+		// Action taken, one of stop, disable or backoff.
+		Action string
+		// Reason describes the condition that triggered.
+		Reason string
+	}
+
+	// RunEvent is a change made to running traffic, such as a new rate of an
+	// operation or a pause of all traffic.
+	RunEvent struct {
+		// Time the change was made.
+		Time time.Time
+		// Module and Op the change applies to, empty if it applies to all
+		// traffic.
+		Module string
+		Op     string
+		// Kind of change, one of the RunEvent kinds.
+		Kind string
+		// Detail describes the change, e.g. the new rate.
+		Detail string
+	}
+
+	// Snapshot is a point-in-time copy of all operation totals.
+	Snapshot struct {
+		// Time the snapshot was taken.
+		Time time.Time
+		// Ops sorted by module and operation name.
+		Ops []*OpSnapshot
+		// Events are the run events so far, in order.
+		Events []RunEvent
+	}
+
+	// OpSnapshot is a point-in-time copy of a single operation's totals. Timing
+	// stats only include successful invocations.
+	OpSnapshot struct {
+		Module     string
+		Op         string
+		Executions uint64
+		OK         uint64
+		NOK        uint64
+		Total      time.Duration
+		Shortest   time.Duration
+		Longest    time.Duration
+		Latency    *HistogramSnapshot
+
+		// Samples is the number of rate samples taken by the scheduler.
+		Samples uint64
+		// MissedSamples is the number of samples that missed the target rate.
+		MissedSamples uint64
+		// LimitedSamples is the number of samples that missed the target rate due
+		// to the concurrency limit of the operation.
+		LimitedSamples uint64
+		// PeakWorkers is the largest number of workers seen in a sample.
+		PeakWorkers int
+		// MaxInFlight is the largest number of concurrent invocations seen in a
+		// sample.
+		MaxInFlight int
+		// Throttled is the number of invocations that waited for the global
+		// in-flight limit.
+		Throttled uint64
+		// Aborts are the abort conditions that triggered, in order.
+		Aborts []Abort
+	}
+)
+
+// Actions of an Abort.
+const (
+	AbortActionStop    = "stop"
+	AbortActionDisable = "disable"
+	AbortActionBackoff = "backoff"
+)
+
+// Kinds of a RunEvent.
+const (
+	RunEventRate    = "rate"
+	RunEventEnable  = "enable"
+	RunEventDisable = "disable"
+	RunEventPause   = "pause"
+	RunEventResume  = "resume"
+)
+
+// NewCollector creates an empty Collector.
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Record adds the result of an operation invocation.
+func (c *Collector) Record(mod, op string, res *module.Result, err error) {
+	counters := c.counters(mod, op)
+
+	if err != nil {
+		counters.nok.Add(1)
+		return
+	}
+
+	d := res.Duration
+	counters.total.Add(int64(d))
+	counters.latency.Record(d)
+	for {
+		cur := counters.shortest.Load()
+		if int64(d) >= cur || counters.shortest.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+	for {
+		cur := counters.longest.Load()
+		if int64(d) <= cur || counters.longest.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+	// Incremented last so that timing stats are in place for a counted success.
+	counters.ok.Add(1)
+}
+
+// RecordRate adds a rate sample of an operation.
+func (c *Collector) RecordRate(mod, op string, sample *RateSample) {
+	counters := c.counters(mod, op)
+
+	counters.samples.Add(1)
+	if sample.Missed {
+		counters.missed.Add(1)
+	}
+	if sample.WorkerLimited {
+		counters.limited.Add(1)
+	}
+	counters.throttled.Add(sample.Throttled)
+	storeMax(&counters.peakWorkers, int64(sample.Workers))
+	storeMax(&counters.maxInFlight, int64(sample.MaxInFlight))
+}
+
+// RecordAbort adds an abort condition that triggered for an operation.
+func (c *Collector) RecordAbort(mod, op string, abort *Abort) {
+	counters := c.counters(mod, op)
+
+	counters.abortLock.Lock()
+	counters.aborts = append(counters.aborts, *abort)
+	counters.abortLock.Unlock()
+}
+
+// RecordRunEvent adds a change made to running traffic.
+func (c *Collector) RecordRunEvent(event *RunEvent) {
+	c.eventLock.Lock()
+	c.events = append(c.events, *event)
+	c.eventLock.Unlock()
+}
+
+// storeMax stores v in a if it is larger than the current value.
+func storeMax(a *atomic.Int64, v int64) {
+	for {
+		cur := a.Load()
+		if v <= cur || a.CompareAndSwap(cur, v) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the current totals of all operations.
+func (c *Collector) Snapshot() *Snapshot {
+	s := &Snapshot{Time: time.Now()}
+
+	c.ops.Range(func(k, v any) bool {
+		key, _ := k.(opKey)
+		counters, _ := v.(*opCounters)
+		s.Ops = append(s.Ops, counters.snapshot(key))
+		return true
+	})
+
+	slices.SortFunc(s.Ops, func(a, b *OpSnapshot) int {
+		return cmp.Or(cmp.Compare(a.Module, b.Module), cmp.Compare(a.Op, b.Op))
+	})
+
+	c.eventLock.Lock()
+	s.Events = slices.Clone(c.events)
+	c.eventLock.Unlock()
+
+	return s
+}
+
+// Start implements report.Reporter.
+func (c *Collector) Start(_ context.Context) {
+	// no-op
+}
+
+// ReportError implements report.Reporter.
+func (c *Collector) ReportError(_ error) {
+	// no-op
+}
+
+// ReportOp implements report.Reporter.
+func (c *Collector) ReportOp(mod, op string, res *module.Result, err error) {
+	c.Record(mod, op, res, err)
+}
+
+// ReportRate implements report.RateReporter.
+func (c *Collector) ReportRate(mod, op string, sample *RateSample) {
+	c.RecordRate(mod, op, sample)
+}
+
+// ReportAbort implements report.AbortReporter.
+func (c *Collector) ReportAbort(mod, op string, abort *Abort) {
+	c.RecordAbort(mod, op, abort)
+}
+
+// ReportRunEvent implements report.RunEventReporter.
+func (c *Collector) ReportRunEvent(event *RunEvent) {
+	c.RecordRunEvent(event)
+}
+
+// Finalise implements report.Reporter.
+func (c *Collector) Finalise() error {
+	return nil
+}
+
+// Op returns the snapshot of the given operation, or nil if it has no results.
+func (s *Snapshot) Op(mod, op string) *OpSnapshot {
+	for _, o := range s.Ops {
+		if o.Module == mod && o.Op == op {
+			return o
+		}
+	}
+
+	return nil
+}
+
+// MissedPerc returns the percentage of rate samples that missed the target rate.
+func (o *OpSnapshot) MissedPerc() float64 {
+	if o.Samples == 0 {
+		return 0
+	}
+
+	return float64(o.MissedSamples) / float64(o.Samples) * 100 //nolint:mnd // percentage
+}
+
+// Average returns the average duration of successful invocations.
+func (o *OpSnapshot) Average() time.Duration {
+	if o.OK == 0 {
+		return 0
+	}
+
+	//nolint:gosec // no risk of overflow since OK is a count of invocations
+	return o.Total / time.Duration(o.OK)
+}
+
+// Sub returns the totals accumulated since prev was taken for the same
+// operation. Shortest and longest are approximated from the latency histogram
+// since they cannot be derived from two snapshots. A nil prev returns a copy of o.
+func (o *OpSnapshot) Sub(prev *OpSnapshot) *OpSnapshot {
+	if prev == nil {
+		c := *o
+		return &c
+	}
+
+	delta := &OpSnapshot{
+		Module:     o.Module,
+		Op:         o.Op,
+		Executions: o.Executions - prev.Executions,
+		OK:         o.OK - prev.OK,
+		NOK:        o.NOK - prev.NOK,
+		Total:      o.Total - prev.Total,
+		Latency:    o.Latency.Sub(prev.Latency),
+
+		Samples:        o.Samples - prev.Samples,
+		MissedSamples:  o.MissedSamples - prev.MissedSamples,
+		LimitedSamples: o.LimitedSamples - prev.LimitedSamples,
+		PeakWorkers:    o.PeakWorkers,
+		MaxInFlight:    o.MaxInFlight,
+		Throttled:      o.Throttled - prev.Throttled,
+		Aborts:         o.Aborts[min(len(prev.Aborts), len(o.Aborts)):],
+	}
+	if delta.Latency.Count() > 0 {
+		delta.Shortest = delta.Latency.Quantile(0)
+		delta.Longest = delta.Latency.Quantile(1)
+	}
+
+	return delta
+}
+
+/*INTERNAL*/
+
+// counters returns the counters of an operation, creating them on first use.
+func (c *Collector) counters(mod, op string) *opCounters {
+	key := opKey{mod: mod, op: op}
+	if v, ok := c.ops.Load(key); ok {
+		counters, _ := v.(*opCounters)
+		return counters
+	}
+
+	counters := &opCounters{}
+	counters.shortest.Store(math.MaxInt64)
+	v, _ := c.ops.LoadOrStore(key, counters)
+	counters, _ = v.(*opCounters)
+	return counters
+}
+
+func (c *opCounters) snapshot(key opKey) *OpSnapshot {
+	// The counters are read without a lock, so a snapshot taken while traffic is
+	// running may be off by the invocations being recorded at the same time.
+	ok := c.ok.Load()
+	nok := c.nok.Load()
+
+	s := &OpSnapshot{
+		Module:     key.mod,
+		Op:         key.op,
+		Executions: ok + nok,
+		OK:         ok,
+		NOK:        nok,
+		Total:      time.Duration(c.total.Load()),
+		Longest:    time.Duration(c.longest.Load()),
+		Latency:    c.latency.Snapshot(),
+
+		Samples:        c.samples.Load(),
+		MissedSamples:  c.missed.Load(),
+		LimitedSamples: c.limited.Load(),
+		PeakWorkers:    int(c.peakWorkers.Load()),
+		MaxInFlight:    int(c.maxInFlight.Load()),
+		Throttled:      c.throttled.Load(),
+	}
+	c.abortLock.Lock()
+	s.Aborts = slices.Clone(c.aborts)
+	c.abortLock.Unlock()
+	if ok > 0 {
+		s.Shortest = time.Duration(c.shortest.Load())
+	}
+
+	return s
+}
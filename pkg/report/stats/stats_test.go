@@ -0,0 +1,174 @@
+package stats
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+)
+
+func TestRecord(t *testing.T) {
+	c := NewCollector()
+	c.Record("mod", "op", &module.Result{Duration: time.Second}, nil)
+
+	op := c.Snapshot().Op("mod", "op")
+	if op == nil {
+		t.Fatal("'op' expected in snapshot")
+	}
+	if op.Executions != 1 || op.OK != 1 {
+		t.Fatal("expected 1 successful execution")
+	}
+	if op.Longest != time.Second || op.Shortest != time.Second || op.Average() != time.Second {
+		t.Fatal("expected 1 second timings")
+	}
+
+	c.Record("mod", "op", &module.Result{Duration: time.Second}, errors.New("error"))
+	c.Record("mod", "op", &module.Result{Duration: 4 * time.Second}, nil)
+
+	op = c.Snapshot().Op("mod", "op")
+	if op.Executions != 3 || op.OK != 2 || op.NOK != 1 {
+		t.Fatal("unexpected counts", op.Executions, op.OK, op.NOK)
+	}
+	if op.Longest != 4*time.Second {
+		t.Fatal("expected longest 4 seconds")
+	}
+	if op.Shortest != time.Second {
+		t.Fatal("expected shortest 1 second")
+	}
+	if op.Average() != 2500*time.Millisecond {
+		t.Fatal("expected average 2.5 seconds, failures do not count towards timing")
+	}
+}
+
+func TestConcurrentRecord(t *testing.T) {
+	const (
+		goroutines = 8
+		perRoutine = 10000
+	)
+
+	c := NewCollector()
+	wg := sync.WaitGroup{}
+	for range goroutines {
+		wg.Go(func() {
+			for i := range perRoutine {
+				c.Record("mod", "op", &module.Result{Duration: time.Duration(i)}, nil)
+			}
+		})
+	}
+	wg.Wait()
+
+	op := c.Snapshot().Op("mod", "op")
+	if op.OK != goroutines*perRoutine {
+		t.Fatalf("expected %d results, got %d", goroutines*perRoutine, op.OK)
+	}
+	if op.Latency.Count() != goroutines*perRoutine {
+		t.Fatal("histogram count does not match")
+	}
+	if op.Shortest != 0 || op.Longest != perRoutine-1 {
+		t.Fatal("unexpected shortest or longest", op.Shortest, op.Longest)
+	}
+}
+
+func TestSub(t *testing.T) {
+	c := NewCollector()
+	c.Record("mod", "op", &module.Result{Duration: time.Second}, nil)
+	prev := c.Snapshot().Op("mod", "op")
+
+	c.Record("mod", "op", &module.Result{Duration: time.Millisecond}, nil)
+	c.Record("mod", "op", &module.Result{}, errors.New("error"))
+	delta := c.Snapshot().Op("mod", "op").Sub(prev)
+
+	if delta.Executions != 2 || delta.OK != 1 || delta.NOK != 1 {
+		t.Fatal("unexpected delta counts", delta.Executions, delta.OK, delta.NOK)
+	}
+	if delta.Latency.Count() != 1 {
+		t.Fatal("expected 1 latency sample in delta")
+	}
+	if delta.Longest > 2*time.Millisecond {
+		t.Fatal("longest of the delta should not include the first result")
+	}
+}
+
+func TestRecordRate(t *testing.T) {
+	c := NewCollector()
+	c.RecordRate("mod", "op", &RateSample{Workers: 2})
+	c.RecordRate("mod", "op", &RateSample{Workers: 5, Missed: true, WorkerLimited: true})
+	c.RecordRate("mod", "op", &RateSample{Workers: 3, Missed: true})
+
+	op := c.Snapshot().Op("mod", "op")
+	if op.Samples != 3 || op.MissedSamples != 2 || op.LimitedSamples != 1 {
+		t.Fatal("unexpected sample counts", op.Samples, op.MissedSamples, op.LimitedSamples)
+	}
+	if op.PeakWorkers != 5 {
+		t.Fatal("unexpected peak workers", op.PeakWorkers)
+	}
+	if perc := op.MissedPerc(); perc < 66 || perc > 67 {
+		t.Fatal("unexpected missed percentage", perc)
+	}
+}
+
+func TestRecordAbort(t *testing.T) {
+	c := NewCollector()
+	c.RecordAbort("mod", "op", &Abort{Action: "backoff", Reason: "first"})
+	prev := c.Snapshot().Op("mod", "op")
+	c.RecordAbort("mod", "op", &Abort{Action: "stop", Reason: "second"})
+
+	op := c.Snapshot().Op("mod", "op")
+	if len(op.Aborts) != 2 || op.Aborts[0].Reason != "first" || op.Aborts[1].Reason != "second" {
+		t.Fatal("unexpected aborts", op.Aborts)
+	}
+	if len(prev.Aborts) != 1 {
+		t.Fatal("expected the earlier snapshot to be unaffected", prev.Aborts)
+	}
+	if delta := op.Sub(prev); len(delta.Aborts) != 1 || delta.Aborts[0].Reason != "second" {
+		t.Fatal("expected only the new abort in the delta", delta.Aborts)
+	}
+}
+
+func TestRecordRunEvent(t *testing.T) {
+	c := NewCollector()
+	c.RecordRunEvent(&RunEvent{Module: "mod", Op: "op", Kind: RunEventRate, Detail: "120/min"})
+	c.RecordRunEvent(&RunEvent{Kind: RunEventPause})
+
+	events := c.Snapshot().Events
+	if len(events) != 2 || events[0].Kind != RunEventRate || events[1].Kind != RunEventPause {
+		t.Fatal("unexpected events", events)
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	h := &Histogram{}
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	s := h.Snapshot()
+	for _, tc := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.5, 500 * time.Millisecond},
+		{0.95, 950 * time.Millisecond},
+		{0.99, 990 * time.Millisecond},
+	} {
+		got := s.Quantile(tc.q)
+		if diff := float64(got-tc.want) / float64(tc.want); diff < -0.02 || diff > 0.02 {
+			t.Errorf("quantile %v: expected ~%s, got %s", tc.q, tc.want, got)
+		}
+	}
+
+	if (&HistogramSnapshot{}).Quantile(0.5) != 0 {
+		t.Fatal("empty snapshot should yield 0")
+	}
+}
+
+func TestBucketBounds(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 127, 128, 129, time.Microsecond, time.Second, time.Hour} {
+		lower, upper := bucketBounds(bucketIndex(d))
+		if d < lower || d >= upper {
+			t.Errorf("%d not within bucket bounds [%d, %d)", d, lower, upper)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package report
+
+import (
+	"fmt"
+	"time"
+)
+
+// Thresholds define the limits an operation must stay within to pass. Zero
+// valued fields are not checked. If no field is set at all, an operation
+// passes only if none of its invocations failed.
+type Thresholds struct {
+	// MaxErrorRate is the maximum allowed fraction of failed invocations, e.g.
+	// 0.05 for 5%.
+	MaxErrorRate float64
+	// MaxAverageLatency is the maximum allowed average duration of successful invocations.
+	MaxAverageLatency time.Duration
+	// MaxLatency is the maximum allowed duration of any successful invocation.
+	MaxLatency time.Duration
+}
+
+// IsZero reports whether no threshold has been set.
+func (t *Thresholds) IsZero() bool {
+	return t.MaxErrorRate == 0 && t.MaxAverageLatency == 0 && t.MaxLatency == 0
+}
+
+// Check returns a description of each threshold breached by an operation with the
+// given number of executions and failures, and average and longest durations.
+// An empty result means the operation passed.
+func (t *Thresholds) Check(executions, failures uint64, average, longest time.Duration) []string {
+	var violations []string
+
+	if t.IsZero() {
+		if failures > 0 {
+			violations = append(violations, fmt.Sprintf("%d of %d invocations failed", failures, executions))
+		}
+		return violations
+	}
+
+	if t.MaxErrorRate > 0 && executions > 0 {
+		if rate := float64(failures) / float64(executions); rate > t.MaxErrorRate {
+			violations = append(violations, fmt.Sprintf(
+				"error rate %.2f%% exceeds the threshold of %.2f%%",
+				rate*100, t.MaxErrorRate*100, //nolint:mnd // percentage
+			))
+		}
+	}
+
+	if t.MaxAverageLatency > 0 && average > t.MaxAverageLatency {
+		violations = append(violations, fmt.Sprintf(
+			"average latency %s exceeds the threshold of %s", average, t.MaxAverageLatency,
+		))
+	}
+
+	if t.MaxLatency > 0 && longest > t.MaxLatency {
+		violations = append(violations, fmt.Sprintf(
+			"longest latency %s exceeds the threshold of %s", longest, t.MaxLatency,
+		))
+	}
+
+	return violations
+}
@@ -2,12 +2,14 @@ package yamlreport
 
 import (
 	"context"
+	"io"
 	"os"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/maansaake/arbiter/pkg/module"
 	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
 	"gopkg.in/yaml.v3"
 )
 
@@ -19,9 +21,11 @@ type (
 		Start time.Time
 		// The final path of the YAML report.
 		Path string
-		// The buffer size sets the number of buffered report calls that are yet
-		// to be handled. Values < 1 will be ignored.
-		Buffer int
+		// RunMetadata is included in the report, if set.
+		RunMetadata *report.RunMetadata
+		// Stats is a collector shared with other reporters, which must receive
+		// the operation results. It is required, the report is built from it.
+		Stats *stats.Collector
 		// Logger is the logger used for info-level logging by the reporter.
 		Logger logr.Logger
 		// ErrorLogger is a logger for the reporter to log errors to.
@@ -31,16 +35,18 @@ type (
 	reporter struct {
 		// The final path of the YAML report.
 		path string
-		// The YAML report.
-		report *Report
+		// start of the test.
+		start time.Time
+		// runMetadata is included in the report.
+		runMetadata *report.RunMetadata
+		// The YAML report, set when finalised.
+		report *report.Report
+		// stats aggregates the operation results.
+		stats *stats.Collector
 		// logger is used for info-level logging.
 		logger logr.Logger
 		// errorLogger is used to log errors from failed operations.
 		errorLogger logr.Logger
-		// Synchronizer channel to limit access to the report to 1 thread. Also
-		// speeds up calls to the reporter interface.
-		synchronizer chan func()
-		stopped      chan struct{}
 	}
 )
 
@@ -51,13 +57,6 @@ const yamlIndent = 2
 // New creates a new YAML reporter.
 func New(opts *Opts) report.Reporter {
 	var start time.Time
-	var buffer int
-	if opts.Buffer > 0 {
-		buffer = opts.Buffer
-	} else {
-		buffer = 100
-	}
-
 	if opts.Start.IsZero() {
 		start = time.Now()
 	} else {
@@ -65,71 +64,38 @@ func New(opts *Opts) report.Reporter {
 	}
 
 	reporter := &reporter{
-		report: &Report{
-			Start:   start,
-			Modules: make(map[string]*ModuleReport),
-		},
-		logger:       opts.Logger,
-		errorLogger:  opts.ErrorLogger,
-		path:         opts.Path,
-		synchronizer: make(chan func(), buffer),
-		stopped:      make(chan struct{}),
+		start:       start,
+		runMetadata: opts.RunMetadata,
+		stats:       opts.Stats,
+		logger:      opts.Logger,
+		errorLogger: opts.ErrorLogger,
+		path:        opts.Path,
 	}
 
 	return reporter
 }
 
-// Start the YAML reporter and run until the context is cancelled.
-func (r *reporter) Start(ctx context.Context) {
+// Start the YAML reporter.
+func (r *reporter) Start(_ context.Context) {
 	r.logger.Info("Starting reporter")
-
-	go func() {
-		for {
-			select {
-			case f := <-r.synchronizer:
-				f()
-			case <-ctx.Done():
-				r.logger.Info("Reporter context closed, flushing synchronizer", "len", len(r.synchronizer))
-
-				// TODO: test buffer emptying
-			out:
-				// Empty the synchronizer buffer, up to 100 items, if not empty.
-				for range 100 {
-					select {
-					case f := <-r.synchronizer:
-						f()
-					default:
-						break out
-					}
-				}
-				r.logger.Info("Synchronizer flushed, stopping reporter")
-				close(r.stopped)
-				return
-			}
-		}
-	}()
 }
 
 func (r *reporter) ReportError(_ error) {
 	// no-op
 }
 
-func (r *reporter) ReportOp(mod, op string, res *module.Result, err error) {
-	r.synchronizer <- func() {
-		r.report.module(mod).addOp(op, res, err)
-		if err != nil {
-			r.errorLogger.Error(err, "Error in operation", "mod", mod, "op", op)
-		}
+func (r *reporter) ReportOp(mod, op string, _ *module.Result, err error) {
+	if err != nil {
+		r.errorLogger.Error(err, "Error in operation", "mod", mod, "op", op)
 	}
 }
 
+// Finalise writes the report from a final snapshot of the operation stats. It
+// must be called after traffic has stopped for the report to be complete.
 func (r *reporter) Finalise() error {
-	// Await synchronizer, no value expected
-	<-r.stopped
-	r.logger.Info("Synchronizer stopped, writing report")
+	r.logger.Info("Writing report", "path", r.path)
 
-	r.report.End = time.Now()
-	r.report.Duration = r.report.End.Sub(r.report.Start)
+	r.report = report.NewReport(r.start, r.stats.Snapshot(), r.runMetadata)
 
 	file, err := os.Create(r.path)
 	if err != nil {
@@ -137,20 +103,13 @@ func (r *reporter) Finalise() error {
 	}
 	defer file.Close()
 
-	encoder := yaml.NewEncoder(file)
-	defer encoder.Close()
-	encoder.SetIndent(yamlIndent)
-	return encoder.Encode(r.report)
+	return Write(file, r.report)
 }
 
-/*INTERNAL*/
-
-func (r *Report) module(mod string) *ModuleReport {
-	m, ok := r.Modules[mod]
-	if !ok {
-		m = newModuleReport()
-		r.Modules[mod] = m
-	}
-
-	return m
+// Write encodes the report as YAML to w.
+func Write(w io.Writer, rep *report.Report) error {
+	encoder := yaml.NewEncoder(w)
+	defer encoder.Close()
+	encoder.SetIndent(yamlIndent)
+	return encoder.Encode(rep)
 }
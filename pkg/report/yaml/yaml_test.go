@@ -9,14 +9,17 @@ import (
 
 	"github.com/go-logr/logr/funcr"
 	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
 	"gopkg.in/yaml.v3"
 )
 
 func TestYAMLReporter(t *testing.T) {
 	reportPath := "report.yaml"
+	collector := stats.NewCollector()
 	i := New(&Opts{
-		Buffer: 100,
 		Path:   reportPath,
+		Stats:  collector,
 		Logger: funcr.New(func(_, _ string) {}, funcr.Options{}),
 	})
 	yamlReporter := i.(*reporter)
@@ -25,17 +28,17 @@ func TestYAMLReporter(t *testing.T) {
 	ctx, cancel := context.WithCancel(ctx)
 	yamlReporter.Start(ctx)
 
-	if yamlReporter.report.Start.IsZero() {
+	if yamlReporter.start.IsZero() {
 		t.Fatal("should have been not zero")
 	}
-	if !yamlReporter.report.End.IsZero() {
-		t.Fatal("should have been zero")
+	if yamlReporter.report != nil {
+		t.Fatal("report should not be set before finalising")
 	}
 
-	yamlReporter.ReportOp("mod", "op", &module.Result{Duration: 1 * time.Second}, nil)
-	yamlReporter.ReportOp("mod", "op", &module.Result{Duration: 1 * time.Second}, errors.New("operation error"))
-	yamlReporter.ReportOp("mod", "op2", &module.Result{Duration: 11 * time.Millisecond}, nil)
-	yamlReporter.ReportOp("mod", "op2", &module.Result{Duration: 2 * time.Second}, nil)
+	collector.Record("mod", "op", &module.Result{Duration: 1 * time.Second}, nil)
+	collector.Record("mod", "op", &module.Result{Duration: 1 * time.Second}, errors.New("operation error"))
+	collector.Record("mod", "op2", &module.Result{Duration: 11 * time.Millisecond}, nil)
+	collector.Record("mod", "op2", &module.Result{Duration: 2 * time.Second}, nil)
 
 	cancel()
 
@@ -51,7 +54,7 @@ func TestYAMLReporter(t *testing.T) {
 	if err != nil {
 		t.Fatal("failed to read file:", reportPath)
 	}
-	parsedReport := &Report{}
+	parsedReport := &report.Report{}
 	err = yaml.Unmarshal(bs, parsedReport)
 	if err != nil {
 		t.Fatal("failed to unmarshal report")
@@ -63,4 +66,10 @@ func TestYAMLReporter(t *testing.T) {
 	if !end.Equal(parsedReport.End) {
 		t.Fatal("end should have matched", "old", end, "new", parsedReport.End)
 	}
+	if parsedReport.Modules["mod"].Operations["op"].Executions != 2 {
+		t.Fatal("expected 2 executions of op")
+	}
+	if parsedReport.Modules["mod"].Operations["op2"].OK != 2 {
+		t.Fatal("expected 2 successful executions of op2")
+	}
 }
@@ -1,47 +1,69 @@
 package cli
 
 import (
+	"encoding/csv"
 	"errors"
 	"fmt"
+	"os"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/maansaake/arbiter/pkg/module"
-	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-const FlagsetName = "cli"
+const (
+	FlagsetName         = "cli"
+	envPrefix           = "ABTR_"
+	secretFileSuffix    = "-file"
+	secretFileEnvSuffix = "_FILE"
+)
 
 var (
 	ErrNilPtr       = errors.New("either Arg.Value or Arg.Handler must not be a nil pointer")
 	ErrRequiredBool = errors.New("a boolean arg cannot be marked required")
 	ErrInvalid      = errors.New("validator failed")
 	ErrType         = errors.New("unsupported type")
+	ErrUnknownFlag  = errors.New("unknown flag")
+	ErrChoice       = errors.New("value must be one of")
+	ErrMapEntry     = errors.New("invalid map entry")
 )
 
-// registerFlags registers all args on cmd's flag set using prefix as a namespace.
+// registerFlags registers all args on the flag set using prefix as a namespace.
 // Required flag names are appended to required.
-func registerFlags(cmd *cobra.Command, prefix string, args module.Args, required *[]string) error {
+func registerFlags(flags *pflag.FlagSet, prefix string, args module.Args, required *[]string) error {
 	errs := make([]error, 0, len(args))
 	for _, arg := range args {
-		errs = append(errs, registerFlag(cmd, prefix, arg, required))
+		errs = append(errs, registerFlag(flags, prefix, arg, required))
 	}
 
 	return errors.Join(errs...)
 }
 
 // registerFlag dispatches to the type-specific registration function.
-func registerFlag(cmd *cobra.Command, prefix string, argument any, required *[]string) error {
+func registerFlag(flags *pflag.FlagSet, prefix string, argument any, required *[]string) error {
 	switch a := argument.(type) {
 	case *module.Arg[int]:
-		return registerIntFlag(cmd, prefix, a, required)
+		return registerValueFlag(flags, prefix, a, parseInt, "int", required)
 	case *module.Arg[uint]:
-		return registerUintFlag(cmd, prefix, a, required)
+		return registerValueFlag(flags, prefix, a, parseUint, "uint", required)
 	case *module.Arg[float64]:
-		return registerFloatFlag(cmd, prefix, a, required)
+		return registerValueFlag(flags, prefix, a, parseFloat, "float64", required)
 	case *module.Arg[string]:
-		return registerStringFlag(cmd, prefix, a, required)
+		return registerValueFlag(flags, prefix, a, parseString, "string", required)
 	case *module.Arg[bool]:
-		return registerBoolFlag(cmd, prefix, a)
+		return registerBoolFlag(flags, prefix, a)
+	case *module.Arg[time.Duration]:
+		return registerValueFlag(flags, prefix, a, time.ParseDuration, "duration", required)
+	case *module.Arg[[]string]:
+		return registerValueFlag(flags, prefix, a, parseStrings, "strings", required)
+	case *module.Arg[[]int]:
+		return registerValueFlag(flags, prefix, a, parseInts, "ints", required)
+	case *module.Arg[map[string]string]:
+		return registerValueFlag(flags, prefix, a, parseMap, "map", required)
 	}
 
 	return ErrType
@@ -53,14 +75,22 @@ type argFlagValue[T module.TypeConstraint] struct {
 	arg      *module.Arg[T]
 	parse    func(string) (T, error)
 	typeName string
+	// env is the name of the environment variable the arg can be set from.
+	env string
+}
+
+// envValue is implemented by flag values that can be set from an environment variable.
+type envValue interface {
+	envName() string
 }
 
 func (v *argFlagValue[T]) String() string {
-	if v.arg.Value == nil {
+	// The value of a secret is never shown, which also hides its default in the help.
+	if v.arg.Value == nil || v.arg.Secret {
 		return ""
 	}
 
-	return fmt.Sprintf("%v", *v.arg.Value)
+	return module.FormatValue(*v.arg.Value)
 }
 
 func (v *argFlagValue[T]) Set(s string) error {
@@ -69,6 +99,12 @@ func (v *argFlagValue[T]) Set(s string) error {
 		return err
 	}
 
+	if len(v.arg.Choices) > 0 && !slices.ContainsFunc(v.arg.Choices, func(c T) bool {
+		return reflect.DeepEqual(c, val)
+	}) {
+		return fmt.Errorf("%w: %s", ErrChoice, choices(v.arg.Choices))
+	}
+
 	*v.arg.Value = val
 
 	if v.arg.Valid != nil && !v.arg.Valid(val) {
@@ -86,6 +122,10 @@ func (v *argFlagValue[T]) Type() string {
 	return v.typeName
 }
 
+func (v *argFlagValue[T]) envName() string {
+	return v.env
+}
+
 func verifyArgValue[T module.TypeConstraint](arg *module.Arg[T]) error {
 	if arg.Handler == nil && arg.Value == nil {
 		return fmt.Errorf("%w: '%s'", ErrNilPtr, arg.Name)
@@ -97,20 +137,36 @@ func verifyArgValue[T module.TypeConstraint](arg *module.Arg[T]) error {
 	return nil
 }
 
-func registerIntFlag(cmd *cobra.Command, prefix string, arg *module.Arg[int], required *[]string) error {
+func registerValueFlag[T module.TypeConstraint](
+	flags *pflag.FlagSet,
+	prefix string,
+	arg *module.Arg[T],
+	parse func(string) (T, error),
+	typeName string,
+	required *[]string,
+) error {
 	if err := verifyArgValue(arg); err != nil {
 		return err
 	}
 
 	name := argPath(prefix, arg)
-	cmd.Flags().Var(&argFlagValue[int]{
-		arg: arg,
-		parse: func(s string) (int, error) {
-			iv, err := strconv.ParseInt(s, 10, 0)
-			return int(iv), err
-		},
-		typeName: "int",
-	}, name, arg.Desc)
+	env := envName(prefix, arg)
+	flags.Var(&argFlagValue[T]{
+		arg:      arg,
+		parse:    parse,
+		typeName: typeName,
+		env:      env,
+	}, name, usage(arg, env))
+
+	if arg.Secret {
+		flags.Var(&secretFileValue{
+			flags: flags,
+			name:  name,
+			env:   env + secretFileEnvSuffix,
+		}, name+secretFileSuffix, fmt.Sprintf(
+			"File to read the value of --%s from. [$%s%s]", name, env, secretFileEnvSuffix,
+		))
+	}
 
 	if arg.Required {
 		*required = append(*required, name)
@@ -119,88 +175,174 @@ func registerIntFlag(cmd *cobra.Command, prefix string, arg *module.Arg[int], re
 	return nil
 }
 
-func registerUintFlag(cmd *cobra.Command, prefix string, arg *module.Arg[uint], required *[]string) error {
-	if err := verifyArgValue(arg); err != nil {
+// secretFileValue implements pflag.Value for the flag of a secret arg that
+// reads the value of the secret from a file. Setting the value sets the flag of
+// the secret arg to the file contents, without trailing newlines.
+type secretFileValue struct {
+	flags *pflag.FlagSet
+	name  string
+	env   string
+	path  string
+}
+
+func (v *secretFileValue) String() string {
+	return v.path
+}
+
+func (v *secretFileValue) Set(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
 		return err
 	}
+	v.path = path
 
-	name := argPath(prefix, arg)
-	cmd.Flags().Var(&argFlagValue[uint]{
-		arg: arg,
-		parse: func(s string) (uint, error) {
-			iv, err := strconv.ParseUint(s, 10, 0)
-			return uint(iv), err
-		},
-		typeName: "uint",
-	}, name, arg.Desc)
+	return v.flags.Set(v.name, strings.TrimRight(string(b), "\r\n"))
+}
 
-	if arg.Required {
-		*required = append(*required, name)
-	}
+func (v *secretFileValue) Type() string {
+	return "path"
+}
 
-	return nil
+func (v *secretFileValue) envName() string {
+	return v.env
 }
 
-func registerFloatFlag(cmd *cobra.Command, prefix string, arg *module.Arg[float64], required *[]string) error {
+func registerBoolFlag(flags *pflag.FlagSet, prefix string, arg *module.Arg[bool]) error {
 	if err := verifyArgValue(arg); err != nil {
 		return err
 	}
 
-	name := argPath(prefix, arg)
-	cmd.Flags().Var(&argFlagValue[float64]{
-		arg: arg,
-		parse: func(s string) (float64, error) {
-			return strconv.ParseFloat(s, 64)
-		},
-		typeName: "float64",
-	}, name, arg.Desc)
-
 	if arg.Required {
-		*required = append(*required, name)
+		return fmt.Errorf("%w: '%s'", ErrRequiredBool, argPath(prefix, arg))
 	}
 
+	env := envName(prefix, arg)
+	flags.Var(&argFlagValue[bool]{
+		arg:      arg,
+		parse:    strconv.ParseBool,
+		typeName: "bool",
+		env:      env,
+	}, argPath(prefix, arg), usage(arg, env))
+
 	return nil
 }
 
-func registerStringFlag(cmd *cobra.Command, prefix string, arg *module.Arg[string], required *[]string) error {
-	if err := verifyArgValue(arg); err != nil {
-		return err
+// usage returns the help text of an arg, listing its choices if any and the
+// environment variable it can be set from.
+func usage[T module.TypeConstraint](arg *module.Arg[T], env string) string {
+	u := arg.Desc
+	if len(arg.Choices) > 0 {
+		u = fmt.Sprintf("%s (one of: %s)", u, choices(arg.Choices))
 	}
 
-	name := argPath(prefix, arg)
-	cmd.Flags().Var(&argFlagValue[string]{
-		arg: arg,
-		parse: func(s string) (string, error) {
-			return s, nil
-		},
-		typeName: "string",
-	}, name, arg.Desc)
+	return fmt.Sprintf("%s [$%s]", u, env)
+}
 
-	if arg.Required {
-		*required = append(*required, name)
+func choices[T module.TypeConstraint](values []T) string {
+	formatted := make([]string, len(values))
+	for i, v := range values {
+		formatted[i] = module.FormatValue(v)
 	}
 
-	return nil
+	return strings.Join(formatted, ", ")
 }
 
-func registerBoolFlag(cmd *cobra.Command, prefix string, arg *module.Arg[bool]) error {
-	if err := verifyArgValue(arg); err != nil {
-		return err
+func parseInt(s string) (int, error) {
+	iv, err := strconv.ParseInt(s, 10, 0)
+	return int(iv), err
+}
+
+func parseUint(s string) (uint, error) {
+	iv, err := strconv.ParseUint(s, 10, 0)
+	return uint(iv), err
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseString(s string) (string, error) {
+	return s, nil
+}
+
+// parseStrings parses a comma-separated list, trimming whitespace around each
+// element. As in CSV, elements that contain commas are double quoted.
+func parseStrings(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return []string{}, nil
 	}
 
-	if arg.Required {
-		return fmt.Errorf("%w: '%s'", ErrRequiredBool, argPath(prefix, arg))
+	r := csv.NewReader(strings.NewReader(s))
+	r.TrimLeadingSpace = true
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
 	}
 
-	cmd.Flags().Var(&argFlagValue[bool]{
-		arg:      arg,
-		parse:    strconv.ParseBool,
-		typeName: "bool",
-	}, argPath(prefix, arg), arg.Desc)
+	var parts []string
+	for _, record := range records {
+		for _, p := range record {
+			parts = append(parts, strings.TrimSpace(p))
+		}
+	}
 
-	return nil
+	return parts, nil
+}
+
+// parseInts parses a comma-separated list of integers.
+func parseInts(s string) ([]int, error) {
+	parts, err := parseStrings(s)
+	if err != nil {
+		return nil, err
+	}
+	ints := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := parseInt(p)
+		if err != nil {
+			return nil, err
+		}
+		ints[i] = n
+	}
+
+	return ints, nil
+}
+
+// parseMap parses comma-separated key=value pairs, which are double quoted if
+// they contain commas.
+func parseMap(s string) (map[string]string, error) {
+	parts, err := parseStrings(s)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(parts))
+	for _, p := range parts {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not a key=value pair", ErrMapEntry, p)
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return m, nil
 }
 
 func argPath[T module.TypeConstraint](prefix string, arg *module.Arg[T]) string {
 	return fmt.Sprintf("%s.%s", prefix, arg.Name)
 }
+
+// envName returns the environment variable an arg can be set from, which is
+// arg.Env if set, or else derived from the flag name as ABTR_<MODULE>_<ARG>.
+func envName[T module.TypeConstraint](prefix string, arg *module.Arg[T]) string {
+	if arg.Env != "" {
+		return arg.Env
+	}
+
+	return envPrefix + strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(argPath(prefix, arg)))
+}
@@ -3,8 +3,14 @@ package cli
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/maansaake/arbiter/pkg/module"
 	"github.com/spf13/cobra"
@@ -22,7 +28,7 @@ func TestRegisterMultiple(t *testing.T) {
 	cmd := newTestCmd()
 	var required []string
 
-	err := registerFlags(cmd, "ns", module.Args{&module.Arg[int]{
+	err := registerFlags(cmd.Flags(), "ns", module.Args{&module.Arg[int]{
 		Name:     "int",
 		Value:    new(int),
 		Required: true,
@@ -36,22 +42,22 @@ func TestRegisterRequired(t *testing.T) {
 	cmd := newTestCmd()
 	var required []string
 
-	err := registerFlag(cmd, "ns", &module.Arg[int]{Name: "int", Value: new(int), Required: true}, &required)
+	err := registerFlag(cmd.Flags(), "ns", &module.Arg[int]{Name: "int", Value: new(int), Required: true}, &required)
 	if err != nil {
 		t.Fatal("no error expected:", err)
 	}
 
-	err = registerFlag(cmd, "ns", &module.Arg[float64]{Name: "float", Value: new(float64), Required: true}, &required)
+	err = registerFlag(cmd.Flags(), "ns", &module.Arg[float64]{Name: "float", Value: new(float64), Required: true}, &required)
 	if err != nil {
 		t.Fatal("no error expected:", err)
 	}
 
-	err = registerFlag(cmd, "ns", &module.Arg[string]{Name: "string", Value: new(string), Required: true}, &required)
+	err = registerFlag(cmd.Flags(), "ns", &module.Arg[string]{Name: "string", Value: new(string), Required: true}, &required)
 	if err != nil {
 		t.Fatal("no error expected:", err)
 	}
 
-	err = registerFlag(cmd, "ns", &module.Arg[bool]{Name: "bool", Value: new(bool)}, &required)
+	err = registerFlag(cmd.Flags(), "ns", &module.Arg[bool]{Name: "bool", Value: new(bool)}, &required)
 	if err != nil {
 		t.Fatal("no error expected:", err)
 	}
@@ -69,7 +75,7 @@ func TestRequiredPresent(t *testing.T) {
 	cmd := newTestCmd()
 	var required []string
 
-	err := registerFlag(cmd, "prefix", &module.Arg[uint]{Name: "count", Value: new(uint), Required: true}, &required)
+	err := registerFlag(cmd.Flags(), "prefix", &module.Arg[uint]{Name: "count", Value: new(uint), Required: true}, &required)
 	if err != nil {
 		t.Fatal("should have not been an error")
 	}
@@ -94,7 +100,7 @@ func TestRequiredMissing(t *testing.T) {
 	cmd := newTestCmd()
 	var required []string
 
-	err := registerFlag(cmd, "prefix", &module.Arg[uint]{Name: "count", Value: new(uint), Required: true}, &required)
+	err := registerFlag(cmd.Flags(), "prefix", &module.Arg[uint]{Name: "count", Value: new(uint), Required: true}, &required)
 	if err != nil {
 		t.Fatal("should have not been an error")
 	}
@@ -125,7 +131,7 @@ func TestRequiredBoolean(t *testing.T) {
 	cmd := newTestCmd()
 	var required []string
 
-	err := registerFlag(cmd, "prefix", &module.Arg[bool]{
+	err := registerFlag(cmd.Flags(), "prefix", &module.Arg[bool]{
 		Name:     "master",
 		Value:    new(bool),
 		Required: true,
@@ -143,7 +149,7 @@ func TestFlagParseFailure(t *testing.T) {
 	cmd := newTestCmd()
 	var required []string
 
-	err := registerFlag(cmd, "prefix", &module.Arg[uint]{Name: "count", Value: new(uint), Required: true}, &required)
+	err := registerFlag(cmd.Flags(), "prefix", &module.Arg[uint]{Name: "count", Value: new(uint), Required: true}, &required)
 	if err != nil {
 		t.Fatal("should have not been an error")
 	}
@@ -309,7 +315,7 @@ func TestPanicRegisterNilPointer(t *testing.T) {
 	cmd := newTestCmd()
 	var required []string
 
-	err := registerFlag(cmd, "ns", &module.Arg[float64]{}, &required)
+	err := registerFlag(cmd.Flags(), "ns", &module.Arg[float64]{}, &required)
 	if err == nil {
 		t.Fatal("expected register error")
 	}
@@ -322,11 +328,11 @@ func TestParseArgs(t *testing.T) {
 	i := &module.Arg[int]{Name: "intt", Desc: "desc", Value: new(int)}
 	s := &module.Arg[string]{Name: "stringg", Desc: "desc", Value: new(string)}
 
-	if err := registerFlag(cmd, "ns", i, &required); err != nil {
+	if err := registerFlag(cmd.Flags(), "ns", i, &required); err != nil {
 		t.Fatal("should have not been an error:", err)
 	}
 
-	if err := registerFlag(cmd, "ns", s, &required); err != nil {
+	if err := registerFlag(cmd.Flags(), "ns", s, &required); err != nil {
 		t.Fatal("should have not been an error:", err)
 	}
 
@@ -342,3 +348,165 @@ func TestParseArgs(t *testing.T) {
 		t.Fatal("string should have been 'strvalue'")
 	}
 }
+
+func TestParseTypes(t *testing.T) {
+	cmd := newTestCmd()
+	var required []string
+
+	d := &module.Arg[time.Duration]{Name: "delay", Value: new(time.Duration)}
+	hosts := &module.Arg[[]string]{Name: "hosts", Value: new([]string)}
+	ports := &module.Arg[[]int]{Name: "ports", Value: new([]int)}
+	headers := &module.Arg[map[string]string]{Name: "headers", Value: new(map[string]string)}
+
+	for _, arg := range (module.Args{d, hosts, ports, headers}) {
+		if err := registerFlag(cmd.Flags(), "ns", arg, &required); err != nil {
+			t.Fatal("should have not been an error:", err)
+		}
+	}
+
+	if err := cmd.ParseFlags([]string{
+		"--ns.delay", "150ms",
+		"--ns.hosts", "a.example, b.example",
+		"--ns.ports", "80,443",
+		"--ns.headers", "X-A=1, X-B=2",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if *d.Value != 150*time.Millisecond {
+		t.Fatalf("unexpected duration %s", *d.Value)
+	}
+	if !slices.Equal(*hosts.Value, []string{"a.example", "b.example"}) {
+		t.Fatalf("unexpected hosts %v", *hosts.Value)
+	}
+	if !slices.Equal(*ports.Value, []int{80, 443}) {
+		t.Fatalf("unexpected ports %v", *ports.Value)
+	}
+	if !maps.Equal(*headers.Value, map[string]string{"X-A": "1", "X-B": "2"}) {
+		t.Fatalf("unexpected headers %v", *headers.Value)
+	}
+
+	if got := cmd.Flags().Lookup("ns.headers").Value.String(); got != "X-A=1,X-B=2" {
+		t.Fatalf("unexpected formatted headers %q", got)
+	}
+}
+
+func TestParseQuoted(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: `"a,b", c`, want: []string{"a,b", "c"}},
+		{value: `"say ""hi""",bye`, want: []string{`say "hi"`, "bye"}},
+		{value: `5" screen, x`, want: []string{`5" screen`, "x"}},
+		{value: " ", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseStrings(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("expected %q to parse as %q, got %q", tt.value, tt.want, got)
+		}
+	}
+
+	headers, err := parseMap(`"Accept=text/html, application/json",X-A=1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"Accept": "text/html, application/json", "X-A": "1"}; !maps.Equal(headers, want) {
+		t.Fatalf("expected %v, got %v", want, headers)
+	}
+}
+
+func TestParseTypesFailure(t *testing.T) {
+	tests := []struct {
+		arg   any
+		value string
+	}{
+		{&module.Arg[time.Duration]{Name: "arg", Value: new(time.Duration)}, "10"},
+		{&module.Arg[[]int]{Name: "arg", Value: new([]int)}, "1,x"},
+		{&module.Arg[map[string]string]{Name: "arg", Value: new(map[string]string)}, "a=1,b"},
+	}
+
+	for _, tt := range tests {
+		cmd := newTestCmd()
+		var required []string
+		if err := registerFlag(cmd.Flags(), "ns", tt.arg, &required); err != nil {
+			t.Fatal("should have not been an error:", err)
+		}
+
+		if err := cmd.ParseFlags([]string{"--ns.arg", tt.value}); err == nil {
+			t.Fatalf("expected %q to fail parsing", tt.value)
+		}
+	}
+}
+
+func TestChoices(t *testing.T) {
+	cmd := newTestCmd()
+	var required []string
+
+	mode := &module.Arg[string]{
+		Name:    "mode",
+		Desc:    "Mode.",
+		Value:   new(string),
+		Choices: []string{"read", "write"},
+	}
+	if err := registerFlag(cmd.Flags(), "ns", mode, &required); err != nil {
+		t.Fatal("should have not been an error:", err)
+	}
+
+	if usage := cmd.Flags().Lookup("ns.mode").Usage; usage != "Mode. (one of: read, write) [$ABTR_NS_MODE]" {
+		t.Fatalf("unexpected usage %q", usage)
+	}
+
+	if err := cmd.Flags().Set("ns.mode", "delete"); !errors.Is(err, ErrChoice) {
+		t.Fatalf("expected choice error, got %v", err)
+	}
+	if *mode.Value != "" {
+		t.Fatal("value should not have been set")
+	}
+
+	if err := cmd.Flags().Set("ns.mode", "write"); err != nil {
+		t.Fatal(err)
+	}
+	if *mode.Value != "write" {
+		t.Fatal("value should have been 'write'")
+	}
+}
+
+func TestSecret(t *testing.T) {
+	cmd := newTestCmd()
+	var required []string
+
+	value := "default-secret"
+	token := &module.Arg[string]{Name: "token", Desc: "Token.", Value: &value, Secret: true, Required: true}
+	if err := registerFlag(cmd.Flags(), "ns", token, &required); err != nil {
+		t.Fatal("should have not been an error:", err)
+	}
+
+	if usage := cmd.Flags().FlagUsages(); strings.Contains(usage, "default-secret") {
+		t.Fatalf("help should not show the secret default:\n%s", usage)
+	}
+
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.ParseFlags([]string{"--ns.token-file", path}); err != nil {
+		t.Fatal(err)
+	}
+
+	if *token.Value != "from-file" {
+		t.Fatalf("expected secret to be read from file, got %q", *token.Value)
+	}
+	if !cmd.Flags().Changed("ns.token") {
+		t.Fatal("secret flag should have been marked as set")
+	}
+	if s := cmd.Flags().Lookup("ns.token").Value.String(); s != "" {
+		t.Fatalf("secret value should not be formatted, got %q", s)
+	}
+}
@@ -2,39 +2,78 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/maansaake/arbiter/pkg/module"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-const argsPerOp = 2 // each op contributes a disable flag and a rate flag
+// Binding holds the flags registered for the args and operations of a set of
+// modules. Setting a flag, either through command line parsing or Set, updates
+// the bound module arg or operation.
+type Binding struct {
+	// Metadata of the bound modules.
+	Metadata module.Metadata
+
+	flags    *pflag.FlagSet
+	required []string
+}
+
+const argsPerOp = 4 // each op contributes a disable, a rate, a max concurrency and an iterations flag
 
 // NewCommand creates a cobra command for the 'cli' subcommand populated with
 // flags derived from the given modules. The provided run function is called
 // with the resolved metadata when the command executes.
 func NewCommand(modules module.Modules, run func(module.Metadata) error) (*cobra.Command, error) {
-	metadata := make(module.Metadata, len(modules))
-
-	var required []string
-
 	cmd := &cobra.Command{
 		Use:   FlagsetName,
 		Short: "Run using CLI flags.",
-		Long: `Run using CLI flags. Flags are generated from the provided modules and their operations. 
+		Long: `Run using CLI flags. Flags are generated from the provided modules and their operations.
 Each module's arguments for operations and pure args are prefixed with the module name.
 
 Included modules are:`,
 	}
 
-	for i, mod := range modules {
+	for _, mod := range modules {
 		cmd.Long = fmt.Sprintf(`%s
 
   %s: %s`, cmd.Long, mod.Name(), mod.Desc())
+	}
+
+	binding, err := Bind(cmd.Flags(), modules)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.RunE = func(_ *cobra.Command, _ []string) error {
+		if err := binding.SetFromEnv(); err != nil { //nolint:govet // shad
+			return err
+		}
+
+		if err := binding.CheckRequired(); err != nil { //nolint:govet // shad
+			return err
+		}
+
+		return run(binding.Metadata)
+	}
+
+	return cmd, nil
+}
 
-		meta := &module.Meta{Module: mod}
-		metadata[i] = meta
+// Bind registers a flag for each arg and operation option of the given modules
+// on the flag set, prefixed with the module name.
+func Bind(flags *pflag.FlagSet, modules module.Modules) (*Binding, error) {
+	b := &Binding{
+		Metadata: make(module.Metadata, len(modules)),
+		flags:    flags,
+	}
+
+	for i, mod := range modules {
+		b.Metadata[i] = &module.Meta{Module: mod}
 
 		modArgs := make(module.Args, 0, len(mod.Args())+len(mod.Ops())*argsPerOp)
 		modArgs = append(modArgs, mod.Args()...)
@@ -42,24 +81,79 @@ Included modules are:`,
 		for _, op := range mod.Ops() {
 			modArgs = append(modArgs, disableArg(op))
 			modArgs = append(modArgs, rateArg(op))
+			modArgs = append(modArgs, maxConcurrencyArg(op))
+			modArgs = append(modArgs, iterationsArg(op))
 		}
 
-		if err := registerFlags(cmd, strings.ToLower(mod.Name()), modArgs, &required); err != nil {
+		if err := registerFlags(flags, strings.ToLower(mod.Name()), modArgs, &b.required); err != nil {
 			return nil, err
 		}
 	}
 
-	cmd.RunE = func(cmd *cobra.Command, _ []string) error {
-		for _, name := range required {
-			if !cmd.Flags().Changed(name) {
-				return fmt.Errorf("%w: --%s is required", module.ErrArgRequired, name)
+	return b, nil
+}
+
+// Set sets the flag with the given name, without the leading dashes, as if it
+// was given on the command line.
+func (b *Binding) Set(name, value string) error {
+	if !b.Has(name) {
+		return fmt.Errorf("%w: --%s", ErrUnknownFlag, name)
+	}
+
+	return b.flags.Set(name, value)
+}
+
+// SetFromEnv sets each flag that has not been set from its environment
+// variable, if that is set.
+func (b *Binding) SetFromEnv() error {
+	var errs []error
+	b.flags.VisitAll(func(f *pflag.Flag) {
+		v, ok := f.Value.(envValue)
+		if !ok || f.Changed {
+			return
+		}
+		// A secret set by a flag or its own variable is not overridden from a file.
+		if file, isFile := f.Value.(*secretFileValue); isFile && b.flags.Changed(file.name) {
+			return
+		}
+
+		if value, ok := os.LookupEnv(v.envName()); ok {
+			if err := b.flags.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("$%s: %w", v.envName(), err))
 			}
 		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// Changed reports whether the flag with the given name, without the leading
+// dashes, has been set.
+func (b *Binding) Changed(name string) bool {
+	return b.flags.Changed(name)
+}
+
+// Has reports whether a flag with the given name, without the leading dashes,
+// is bound.
+func (b *Binding) Has(name string) bool {
+	return b.flags.Lookup(name) != nil
+}
 
-		return run(metadata)
+// CheckRequired returns an error for each required flag that has not been set.
+func (b *Binding) CheckRequired() error {
+	var errs []error
+	for _, name := range b.required {
+		if !b.flags.Changed(name) {
+			errs = append(errs, fmt.Errorf("%w: --%s is required", module.ErrArgRequired, name))
+		}
 	}
 
-	return cmd, nil
+	return errors.Join(errs...)
+}
+
+// OpFlagName returns the name of the flag for an operation option, e.g. "rate".
+func OpFlagName(mod, op, option string) string {
+	return fmt.Sprintf("%s.op.%s.%s", strings.ToLower(mod), strings.ToLower(op), option)
 }
 
 func disableArg(op *module.Op) *module.Arg[bool] {
@@ -77,3 +171,21 @@ func rateArg(op *module.Op) *module.Arg[uint] {
 		Value: &op.Rate,
 	}
 }
+
+func maxConcurrencyArg(op *module.Op) *module.Arg[uint] {
+	return &module.Arg[uint]{
+		Name: fmt.Sprintf("op.%s.max-concurrency", strings.ToLower(op.Name)),
+		Desc: fmt.Sprintf(
+			"Maximum number of concurrent invocations of the %s operation, the worker limit applies if 0.", op.Name,
+		),
+		Value: &op.MaxConcurrency,
+	}
+}
+
+func iterationsArg(op *module.Op) *module.Arg[uint] {
+	return &module.Arg[uint]{
+		Name:  fmt.Sprintf("op.%s.iterations", strings.ToLower(op.Name)),
+		Desc:  fmt.Sprintf("Number of times to call the %s operation, unlimited if 0.", op.Name),
+		Value: &op.Iterations,
+	}
+}
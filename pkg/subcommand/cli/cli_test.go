@@ -1,11 +1,15 @@
 package cli
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/maansaake/arbiter/pkg/module"
 	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func TestNewCommand(t *testing.T) {
@@ -33,6 +37,7 @@ func TestNewCommand(t *testing.T) {
 		"--mod.count=12",
 		"--mod.op.do.rate=100",
 		"--mod.op.more.disable=true",
+		"--mod.op.do.max-concurrency=4",
 	})
 
 	if err = root.Execute(); err != nil {
@@ -47,7 +52,112 @@ func TestNewCommand(t *testing.T) {
 		t.Fatal("do rate should have been 100")
 	}
 
+	if do.MaxConcurrency != 4 {
+		t.Fatal("do max concurrency should have been 4")
+	}
+
 	if *count.Value != 12 {
 		t.Fatal("module arg count should have been 12")
 	}
 }
+
+func TestSetFromEnv(t *testing.T) {
+	count := &module.Arg[int]{Name: "count", Required: true, Value: new(int)}
+	token := &module.Arg[string]{Name: "token", Env: "MY_TOKEN", Value: new(string)}
+	do := &module.Op{Name: "do", Rate: 1}
+
+	mod := &modulemock.Module{
+		SetName: "mod",
+		SetArgs: module.Args{count, token},
+		SetOps:  module.Ops{do},
+	}
+
+	t.Setenv("ABTR_MOD_COUNT", "12")
+	t.Setenv("MY_TOKEN", "secret")
+	t.Setenv("ABTR_MOD_OP_DO_RATE", "100")
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	binding, err := Bind(flags, module.Modules{mod})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A flag takes precedence over the environment.
+	if err = flags.Parse([]string{"--mod.op.do.rate=50"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = binding.SetFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = binding.CheckRequired(); err != nil {
+		t.Fatal("required arg should have been set from env:", err)
+	}
+
+	if *count.Value != 12 {
+		t.Fatal("count should have been 12")
+	}
+	if *token.Value != "secret" {
+		t.Fatal("token should have been set from its explicit env var")
+	}
+	if do.Rate != 50 {
+		t.Fatal("rate flag should have taken precedence over env")
+	}
+
+	if usage := flags.Lookup("mod.token").Usage; !strings.HasSuffix(usage, "[$MY_TOKEN]") {
+		t.Fatalf("expected usage to name the env var, got %q", usage)
+	}
+}
+
+func TestSetFromEnvInvalid(t *testing.T) {
+	count := &module.Arg[int]{Name: "count", Value: new(int)}
+	mod := &modulemock.Module{SetName: "mod", SetArgs: module.Args{count}}
+
+	t.Setenv("ABTR_MOD_COUNT", "x")
+
+	binding, err := Bind(pflag.NewFlagSet("test", pflag.ContinueOnError), module.Modules{mod})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = binding.SetFromEnv(); err == nil {
+		t.Fatal("expected an error for an invalid env value")
+	}
+}
+
+func TestSetFromEnvSecretFile(t *testing.T) {
+	token := &module.Arg[string]{Name: "token", Secret: true, Value: new(string)}
+	mod := &modulemock.Module{SetName: "mod", SetArgs: module.Args{token}}
+
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("from-file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ABTR_MOD_TOKEN_FILE", path)
+
+	binding, err := Bind(pflag.NewFlagSet("test", pflag.ContinueOnError), module.Modules{mod})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = binding.SetFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if *token.Value != "from-file" {
+		t.Fatalf("expected secret from file, got %q", *token.Value)
+	}
+
+	// The secret's own variable takes precedence over the file.
+	t.Setenv("ABTR_MOD_TOKEN", "from-env")
+	*token.Value = ""
+	binding, err = Bind(pflag.NewFlagSet("test", pflag.ContinueOnError), module.Modules{mod})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = binding.SetFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if *token.Value != "from-env" {
+		t.Fatalf("expected secret from env, got %q", *token.Value)
+	}
+}
@@ -1,14 +1,209 @@
 // Package file implements support for the 'file' subcommand.
+//
+// A test model file is a YAML document that mirrors the CLI flags of the
+// modules. Each dot-separated part of a flag name is a nested key, so the flag
+// --sample.op.test.rate is set by:
+//
+//	sample:
+//	  op:
+//	    test:
+//	      rate: 60
+//
+// Values are parsed like the corresponding flags, lists may be given as YAML
+// sequences and maps as YAML mappings.
 package file
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
 	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/subcommand/cli"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
-// TODO: implement
-
 const FlagsetName = "file"
 
-func Parse(_ []string, _ module.Modules) ([]*module.Meta, error) {
-	return nil, nil
+var ErrFormat = errors.New("invalid test model file")
+
+// NewCommand creates a cobra command for the 'file' subcommand, which reads
+// the test model file given as its only arg. Module flags are registered as
+// for the 'cli' subcommand, and take precedence over environment variables,
+// which take precedence over the file. The provided run function is called
+// with the resolved metadata when the command executes.
+func NewCommand(modules module.Modules, run func(module.Metadata) error) (*cobra.Command, error) {
+	cmd := &cobra.Command{
+		Use:   FlagsetName + " <path>",
+		Short: "Run from a test model file.",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	binding, err := cli.Bind(cmd.Flags(), modules)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+		f, err := os.Open(args[0]) //nolint:govet // shad
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err = apply(f, binding); err != nil {
+			return err
+		}
+
+		return run(binding.Metadata)
+	}
+
+	return cmd, nil
+}
+
+// Read reads a test model from r and applies it to the modules, with
+// environment variables taking precedence over the file. Unlike the command
+// of NewCommand, no flags are registered, e.g. to read a model in tests.
+func Read(r io.Reader, modules module.Modules) (module.Metadata, error) {
+	binding, err := cli.Bind(pflag.NewFlagSet(FlagsetName, pflag.ContinueOnError), modules)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = apply(r, binding); err != nil {
+		return nil, err
+	}
+
+	return binding.Metadata, nil
+}
+
+// Apply reads a test model from r and sets the bound flags it contains, except
+// those that have already been set.
+func Apply(r io.Reader, binding *cli.Binding) error {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %w", ErrFormat, err)
+	}
+
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: line %d: expected a mapping of modules", ErrFormat, root.Line)
+	}
+
+	return set(binding, "", root)
+}
+
+/*INTERNAL*/
+
+// apply sets the flags of the binding that have not been set from the
+// environment, then from the test model in r, and checks that all required
+// flags have been set.
+func apply(r io.Reader, binding *cli.Binding) error {
+	if err := binding.SetFromEnv(); err != nil {
+		return err
+	}
+
+	if err := Apply(r, binding); err != nil {
+		return err
+	}
+
+	return binding.CheckRequired()
+}
+
+// set walks a mapping node, setting the flag named by the path of keys to each
+// value. Nested mappings are walked unless the path so far names a flag.
+func set(binding *cli.Binding, prefix string, node *yaml.Node) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		name := key.Value
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if binding.Has(name) {
+			// A null value leaves the flag unset, e.g. for secrets in a generated file.
+			if binding.Changed(name) || value.Tag == "!!null" {
+				continue
+			}
+
+			v, err := flagValue(value)
+			if err == nil {
+				err = binding.Set(name, v)
+			}
+			if err != nil {
+				return fmt.Errorf("%w: line %d: %s: %w", ErrFormat, value.Line, name, err)
+			}
+			continue
+		}
+
+		if value.Kind == yaml.MappingNode {
+			if err := set(binding, name, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return fmt.Errorf("%w: line %d: %w: %s", ErrFormat, key.Line, cli.ErrUnknownFlag, name)
+	}
+
+	return nil
+}
+
+// flagValue converts a node to a flag value, sequences become comma-separated
+// lists and mappings comma-separated key=value pairs. Elements are quoted as in
+// CSV, so that those containing commas are kept whole.
+func flagValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		parts := make([]string, len(node.Content))
+		for i, n := range node.Content {
+			if n.Kind != yaml.ScalarNode {
+				return "", errors.New("list elements must be scalars")
+			}
+			parts[i] = n.Value
+		}
+		return joinList(parts)
+	case yaml.MappingNode:
+		parts := make([]string, 0, len(node.Content)/2) //nolint:mnd // key-value pairs
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if v.Kind != yaml.ScalarNode {
+				return "", errors.New("map values must be scalars")
+			}
+			parts = append(parts, k.Value+"="+v.Value)
+		}
+		return joinList(parts)
+	case yaml.AliasNode:
+		return flagValue(node.Alias)
+	}
+
+	return "", errors.New("unsupported value")
+}
+
+// joinList joins the elements of a list flag value with commas, quoting those
+// that contain commas, quotes or newlines.
+func joinList(parts []string) (string, error) {
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	if err := w.Write(parts); err != nil {
+		return "", err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n"), nil
 }
@@ -0,0 +1,175 @@
+package file
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+	"github.com/maansaake/arbiter/pkg/subcommand/cli"
+	"github.com/spf13/pflag"
+)
+
+type testArgs struct {
+	count   *module.Arg[int]
+	delay   *module.Arg[time.Duration]
+	hosts   *module.Arg[[]string]
+	headers *module.Arg[map[string]string]
+	op      *module.Op
+}
+
+func newTestModule() (module.Modules, *testArgs) {
+	a := &testArgs{
+		count:   &module.Arg[int]{Name: "count", Required: true, Value: new(int)},
+		delay:   &module.Arg[time.Duration]{Name: "delay", Value: new(time.Duration)},
+		hosts:   &module.Arg[[]string]{Name: "hosts", Value: new([]string)},
+		headers: &module.Arg[map[string]string]{Name: "headers", Value: new(map[string]string)},
+		op:      &module.Op{Name: "do", Rate: 10},
+	}
+
+	return module.Modules{&modulemock.Module{
+		SetName: "mod",
+		SetArgs: module.Args{a.count, a.delay, a.hosts, a.headers},
+		SetOps:  module.Ops{a.op},
+	}}, a
+}
+
+func TestRead(t *testing.T) {
+	modules, a := newTestModule()
+
+	meta, err := Read(strings.NewReader(`
+mod:
+  count: 12
+  delay: 1s
+  hosts: [a, b]
+  headers:
+    X-A: "1"
+  op:
+    do:
+      rate: 120
+      disable: true
+`), modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(meta) != 1 {
+		t.Fatal("expected metadata for one module")
+	}
+	if *a.count.Value != 12 {
+		t.Fatal("count should have been 12")
+	}
+	if *a.delay.Value != time.Second {
+		t.Fatal("delay should have been 1s")
+	}
+	if !slices.Equal(*a.hosts.Value, []string{"a", "b"}) {
+		t.Fatalf("unexpected hosts %v", *a.hosts.Value)
+	}
+	if !maps.Equal(*a.headers.Value, map[string]string{"X-A": "1"}) {
+		t.Fatalf("unexpected headers %v", *a.headers.Value)
+	}
+	if a.op.Rate != 120 || !a.op.Disabled {
+		t.Fatal("op should have had rate 120 and been disabled")
+	}
+}
+
+func TestReadCommas(t *testing.T) {
+	modules, a := newTestModule()
+
+	_, err := Read(strings.NewReader(`
+mod:
+  count: 1
+  hosts: ["a,b", c, 'say "hi", bye']
+  headers:
+    Accept: "text/html, application/json"
+    X-A: a=b
+`), modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"a,b", "c", `say "hi", bye`}; !slices.Equal(*a.hosts.Value, want) {
+		t.Fatalf("expected hosts %q, got %q", want, *a.hosts.Value)
+	}
+	want := map[string]string{"Accept": "text/html, application/json", "X-A": "a=b"}
+	if !maps.Equal(*a.headers.Value, want) {
+		t.Fatalf("expected headers %v, got %v", want, *a.headers.Value)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    error
+	}{
+		{"empty", "", module.ErrArgRequired},
+		{"required missing", "mod:\n  delay: 1s\n", module.ErrArgRequired},
+		{"unknown key", "mod:\n  count: 1\n  unknown: 1\n", cli.ErrUnknownFlag},
+		{"unknown module", "other:\n  count: 1\n", cli.ErrUnknownFlag},
+		{"invalid value", "mod:\n  count: x\n", ErrFormat},
+		{"not a mapping", "- mod\n", ErrFormat},
+		{"invalid yaml", "mod: [\n", ErrFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modules, _ := newTestModule()
+			if _, err := Read(strings.NewReader(tt.content), modules); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCommandPath(t *testing.T) {
+	modules, _ := newTestModule()
+	cmd, err := NewCommand(modules, func(module.Metadata) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Args(cmd, nil); err == nil {
+		t.Fatal("expected a missing path to be rejected")
+	}
+}
+
+func TestApplyPrecedence(t *testing.T) {
+	modules, a := newTestModule()
+
+	t.Setenv("ABTR_MOD_DELAY", "2s")
+	t.Setenv("ABTR_MOD_OP_DO_RATE", "30")
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	binding, err := cli.Bind(flags, modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = flags.Parse([]string{"--mod.op.do.rate=90"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = apply(strings.NewReader(`
+mod:
+  count: 1
+  delay: 1s
+  op:
+    do:
+      rate: 120
+`), binding); err != nil {
+		t.Fatal(err)
+	}
+
+	if *a.count.Value != 1 {
+		t.Fatal("count should have been set from the file")
+	}
+	if *a.delay.Value != 2*time.Second {
+		t.Fatal("env should have taken precedence over the file")
+	}
+	if a.op.Rate != 90 {
+		t.Fatal("flag should have taken precedence over env and the file")
+	}
+}
@@ -1,12 +1,146 @@
-// Package gen implements support for the 'gen' subcommand.
+// Package gen implements support for the 'gen' subcommand, which generates a
+// test model file for the 'file' subcommand with the modules' default values.
 package gen
 
-import "github.com/maansaake/arbiter/pkg/module"
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
-// TODO: implement
+	"github.com/maansaake/arbiter/pkg/module"
+	"github.com/maansaake/arbiter/pkg/subcommand/cli"
+	"gopkg.in/yaml.v3"
+)
 
 const FlagsetName = "gen"
 
-func Generate(_ []string, _ module.Modules) error {
-	return nil
+const yamlIndent = 2
+
+// Generate writes a test model file to the path given as the first arg, or to
+// stdout if no path is given.
+func Generate(args []string, modules module.Modules) error {
+	if len(args) == 0 {
+		return Write(os.Stdout, modules)
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return Write(f, modules)
+}
+
+// Write writes a test model for the modules to w. Descriptions are written as
+// comments.
+func Write(w io.Writer, modules module.Modules) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+
+	for _, mod := range modules {
+		modNode := &yaml.Node{Kind: yaml.MappingNode}
+
+		for _, arg := range mod.Args() {
+			key, value, err := argNodes(arg)
+			if err != nil {
+				return fmt.Errorf("module %s: %w", mod.Name(), err)
+			}
+			modNode.Content = append(modNode.Content, key, value)
+		}
+
+		opsNode := &yaml.Node{Kind: yaml.MappingNode}
+		for _, op := range mod.Ops() {
+			opNode := &yaml.Node{Kind: yaml.MappingNode}
+			opNode.Content = append(opNode.Content,
+				keyNode("rate", ""), scalarNode(op.Rate),
+				keyNode("disable", ""), scalarNode(op.Disabled),
+				keyNode("max-concurrency", ""), scalarNode(op.MaxConcurrency),
+				keyNode("iterations", ""), scalarNode(op.Iterations),
+			)
+			opsNode.Content = append(opsNode.Content, keyNode(strings.ToLower(op.Name), op.Desc), opNode)
+		}
+		if len(opsNode.Content) > 0 {
+			modNode.Content = append(modNode.Content, keyNode("op", ""), opsNode)
+		}
+
+		root.Content = append(root.Content, keyNode(strings.ToLower(mod.Name()), mod.Desc()), modNode)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	defer encoder.Close()
+	encoder.SetIndent(yamlIndent)
+	return encoder.Encode(&yaml.Node{
+		Kind:        yaml.DocumentNode,
+		HeadComment: "Arbiter test model, run with: <binary> file <path>",
+		Content:     []*yaml.Node{root},
+	})
+}
+
+/*INTERNAL*/
+
+// argNodes dispatches to the type-specific node builder.
+func argNodes(argument any) (*yaml.Node, *yaml.Node, error) {
+	switch a := argument.(type) {
+	case *module.Arg[int]:
+		return argNode(a)
+	case *module.Arg[uint]:
+		return argNode(a)
+	case *module.Arg[float64]:
+		return argNode(a)
+	case *module.Arg[string]:
+		return argNode(a)
+	case *module.Arg[bool]:
+		return argNode(a)
+	case *module.Arg[time.Duration]:
+		return argNode(a)
+	case *module.Arg[[]string]:
+		return argNode(a)
+	case *module.Arg[[]int]:
+		return argNode(a)
+	case *module.Arg[map[string]string]:
+		return argNode(a)
+	}
+
+	return nil, nil, cli.ErrType
+}
+
+// argNode returns the key and value nodes of an arg, with its default value.
+func argNode[T module.TypeConstraint](arg *module.Arg[T]) (*yaml.Node, *yaml.Node, error) {
+	var value T
+	if arg.Value != nil {
+		value = *arg.Value
+	}
+
+	comment := arg.Desc
+	if len(arg.Choices) > 0 {
+		choices := make([]string, len(arg.Choices))
+		for i, c := range arg.Choices {
+			choices[i] = module.FormatValue(c)
+		}
+		comment += " (one of: " + strings.Join(choices, ", ") + ")"
+	}
+	if arg.Required {
+		comment += " (required)"
+	}
+
+	valueNode := &yaml.Node{}
+	if arg.Secret {
+		// The default of a secret is never written, the null value leaves it unset.
+		comment += " (secret, prefer " + arg.Name + "-file or the environment)"
+		valueNode.Kind, valueNode.Tag, valueNode.Value = yaml.ScalarNode, "!!null", "null"
+	} else if err := valueNode.Encode(value); err != nil {
+		return nil, nil, err
+	}
+
+	return keyNode(arg.Name, comment), valueNode, nil
+}
+
+func keyNode(key, comment string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: key, HeadComment: comment}
+}
+
+func scalarNode(value any) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(value)}
 }
@@ -0,0 +1,65 @@
+package gen
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+	"github.com/maansaake/arbiter/pkg/subcommand/file"
+)
+
+func TestWrite(t *testing.T) {
+	delay := 10 * time.Millisecond
+	hosts := []string{"a", "b"}
+	op := &module.Op{Name: "do", Desc: "Does it.", Rate: 60}
+	mode := "read"
+	token := "default-secret"
+	modules := module.Modules{&modulemock.Module{
+		SetName: "mod",
+		SetDesc: "A module.",
+		SetArgs: module.Args{
+			&module.Arg[int]{Name: "count", Desc: "Count.", Required: true, Handler: func(int) {}},
+			&module.Arg[time.Duration]{Name: "delay", Value: &delay},
+			&module.Arg[[]string]{Name: "hosts", Value: &hosts},
+			&module.Arg[string]{Name: "token", Value: &token, Secret: true},
+			&module.Arg[string]{Name: "mode", Desc: "Mode.", Value: &mode, Choices: []string{"read", "write"}},
+		},
+		SetOps: module.Ops{op},
+	}}
+
+	var b bytes.Buffer
+	if err := Write(&b, modules); err != nil {
+		t.Fatal(err)
+	}
+
+	out := b.String()
+	for _, want := range []string{
+		"# A module.\nmod:",
+		"# Count. (required)\n  count: 0",
+		"delay: 10ms",
+		"token: null",
+		"# Mode. (one of: read, write)",
+		"# Does it.\n    do:\n      rate: 60",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "default-secret") {
+		t.Fatalf("secret default should not be written:\n%s", out)
+	}
+
+	// The generated file is read back to the same values.
+	delay, hosts, op.Rate = 0, nil, 0
+	if _, err := file.Read(&b, modules); err != nil {
+		t.Fatal(err)
+	}
+	if delay != 10*time.Millisecond || !slices.Equal(hosts, []string{"a", "b"}) || op.Rate != 60 {
+		t.Fatalf("unexpected values after reading generated file: %s %v %d", delay, hosts, op.Rate)
+	}
+}
@@ -0,0 +1,198 @@
+package traffic
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+// AbortAction is the action taken when an abort condition triggers for an
+// operation.
+type AbortAction string
+
+const (
+	// AbortStop stops the test.
+	AbortStop AbortAction = stats.AbortActionStop
+	// AbortDisable stops calling the operation, the rest of the test goes on.
+	AbortDisable AbortAction = stats.AbortActionDisable
+	// AbortBackoff halves the rate of the operation, down to 1 per minute.
+	AbortBackoff AbortAction = stats.AbortActionBackoff
+)
+
+const (
+	// DefaultAbortWindow is the Window of AbortConditions that leave it unset.
+	DefaultAbortWindow = 30 * time.Second
+	// DefaultAbortMinCalls is the MinCalls of AbortConditions that leave it
+	// unset.
+	DefaultAbortMinCalls = 10
+
+	// abortBuckets is the number of buckets the error rate window is split
+	// into, the window slides one bucket at a time.
+	abortBuckets = 10
+)
+
+// ErrAbortAction is returned when parsing an unknown abort action.
+var ErrAbortAction = errors.New("unknown abort action")
+
+// AbortConditions end the traffic of an operation that keeps failing, so that
+// a system under test that falls over is not kept under load. Conditions are
+// evaluated per operation. Zero valued conditions are not checked, and no
+// conditions are checked if none is set.
+type AbortConditions struct {
+	// MaxErrorRate is the fraction of invocations within Window, e.g. 0.5 for
+	// 50%, that may fail before the condition triggers.
+	MaxErrorRate float64
+	// Window is the sliding window the error rate is measured over. Defaults to
+	// 30 seconds.
+	Window time.Duration
+	// MinCalls is the number of invocations within Window required before the
+	// error rate is checked. Defaults to 10.
+	MinCalls uint
+	// ConsecutiveFailures is the number of failed invocations in a row that
+	// triggers the condition.
+	ConsecutiveFailures uint
+	// Action taken when a condition triggers. Defaults to AbortStop.
+	Action AbortAction
+}
+
+// ParseAbortAction parses the name of an abort action.
+func ParseAbortAction(s string) (AbortAction, error) {
+	switch action := AbortAction(s); action {
+	case AbortStop, AbortDisable, AbortBackoff:
+		return action, nil
+	default:
+		return "", fmt.Errorf("%w: %q, must be %s, %s or %s", ErrAbortAction, s, AbortStop, AbortDisable, AbortBackoff)
+	}
+}
+
+// IsZero reports whether no condition has been set.
+func (c *AbortConditions) IsZero() bool {
+	return c.MaxErrorRate == 0 && c.ConsecutiveFailures == 0
+}
+
+// WithDefaults returns a copy of the conditions with defaults for unset fields,
+// which are the conditions evaluated.
+func (c AbortConditions) WithDefaults() AbortConditions {
+	if c.Window == 0 {
+		c.Window = DefaultAbortWindow
+	}
+	if c.MinCalls == 0 {
+		c.MinCalls = DefaultAbortMinCalls
+	}
+	if c.Action == "" {
+		c.Action = AbortStop
+	}
+
+	return c
+}
+
+type (
+	// breaker evaluates the abort conditions of a workload against the results
+	// of its invocations.
+	breaker struct {
+		conditions AbortConditions
+		start      time.Time
+		width      time.Duration
+
+		lock        sync.Mutex
+		buckets     [abortBuckets]abortBucket
+		consecutive uint
+		// tripped is set once a condition triggered with an action that ends the
+		// traffic of the workload, after which nothing is evaluated.
+		tripped bool
+	}
+	// abortBucket counts the invocations of bucket n of the window.
+	abortBucket struct {
+		n        int64
+		calls    uint64
+		failures uint64
+	}
+)
+
+// newBreaker creates a breaker for the conditions, with a window starting at
+// start. Nil is returned if no condition is set.
+func newBreaker(conditions AbortConditions, start time.Time) *breaker {
+	if conditions.IsZero() {
+		return nil
+	}
+
+	conditions = conditions.WithDefaults()
+	return &breaker{
+		conditions: conditions,
+		start:      start,
+		width:      max(conditions.Window/abortBuckets, 1),
+	}
+}
+
+// record adds the result of an invocation made at now, and returns the reason
+// if an abort condition triggered, or an empty string. A nil breaker never
+// triggers. After a backoff, the window and failure count start over so that
+// the condition has to trigger again at the lower rate.
+func (b *breaker) record(now time.Time, failed bool) string {
+	if b == nil {
+		return ""
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.tripped {
+		return ""
+	}
+
+	if failed {
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+
+	n := max(int64(now.Sub(b.start)/b.width), 0)
+	bucket := &b.buckets[n%abortBuckets]
+	if bucket.n != n {
+		*bucket = abortBucket{n: n}
+	}
+	bucket.calls++
+	if failed {
+		bucket.failures++
+	}
+
+	if limit := b.conditions.ConsecutiveFailures; limit > 0 && b.consecutive >= limit {
+		return b.trip(fmt.Sprintf("%d consecutive failures", b.consecutive))
+	}
+
+	if b.conditions.MaxErrorRate > 0 {
+		var calls, failures uint64
+		for _, bucket := range b.buckets {
+			if bucket.n > n-abortBuckets {
+				calls += bucket.calls
+				failures += bucket.failures
+			}
+		}
+
+		if rate := float64(failures) / float64(calls); calls >= uint64(b.conditions.MinCalls) &&
+			rate > b.conditions.MaxErrorRate {
+			return b.trip(fmt.Sprintf(
+				"error rate %.2f%% over %s exceeds %.2f%%",
+				rate*100, b.conditions.Window, b.conditions.MaxErrorRate*100, //nolint:mnd // percentage
+			))
+		}
+	}
+
+	return ""
+}
+
+// trip resets the breaker for another round after a backoff, or marks it as
+// tripped for good. The reason is passed through.
+func (b *breaker) trip(reason string) string {
+	if b.conditions.Action == AbortBackoff {
+		b.buckets = [abortBuckets]abortBucket{}
+		b.consecutive = 0
+	} else {
+		b.tripped = true
+	}
+
+	return reason
+}
@@ -0,0 +1,85 @@
+package traffic
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseAbortAction(t *testing.T) {
+	for _, s := range []string{"stop", "disable", "backoff"} {
+		if action, err := ParseAbortAction(s); err != nil || string(action) != s {
+			t.Fatal("expected to parse", s, err)
+		}
+	}
+	if _, err := ParseAbortAction("explode"); !errors.Is(err, ErrAbortAction) {
+		t.Fatal("expected an unknown action error, got", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	start := time.Now()
+
+	if newBreaker(AbortConditions{Action: AbortStop}, start) != nil {
+		t.Fatal("expected no breaker without conditions")
+	}
+
+	t.Run("consecutive failures", func(t *testing.T) {
+		b := newBreaker(AbortConditions{ConsecutiveFailures: 3}, start)
+		for i, failed := range []bool{true, true, false, true, true} {
+			if reason := b.record(start, failed); reason != "" {
+				t.Fatalf("unexpected trigger at %d: %s", i, reason)
+			}
+		}
+		if reason := b.record(start, true); reason != "3 consecutive failures" {
+			t.Fatal("expected a trigger, got", reason)
+		}
+		// The stop action trips the breaker for good.
+		for range 5 {
+			if b.record(start, true) != "" {
+				t.Fatal("expected no trigger once tripped")
+			}
+		}
+	})
+
+	t.Run("error rate", func(t *testing.T) {
+		b := newBreaker(AbortConditions{MaxErrorRate: 0.5, MinCalls: 4, Window: 10 * time.Second}, start)
+
+		// Failures that have left the window are not counted.
+		for range 3 {
+			b.record(start, true)
+		}
+		now := start.Add(20 * time.Second)
+		for i, failed := range []bool{false, true, false, true} {
+			if reason := b.record(now, failed); reason != "" {
+				t.Fatalf("unexpected trigger at %d: %s", i, reason)
+			}
+		}
+
+		reason := b.record(now.Add(time.Second), true)
+		if reason != "error rate 60.00% over 10s exceeds 50.00%" {
+			t.Fatal("expected a trigger, got", reason)
+		}
+	})
+
+	t.Run("min calls", func(t *testing.T) {
+		b := newBreaker(AbortConditions{MaxErrorRate: 0.5}, start)
+		for range DefaultAbortMinCalls - 1 {
+			if b.record(start, true) != "" {
+				t.Fatal("expected no trigger below the minimum calls")
+			}
+		}
+		if b.record(start, true) == "" {
+			t.Fatal("expected a trigger at the minimum calls")
+		}
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		b := newBreaker(AbortConditions{ConsecutiveFailures: 2, Action: AbortBackoff}, start)
+		for round := range 3 {
+			if b.record(start, true) != "" || b.record(start, true) == "" {
+				t.Fatal("expected a trigger every other failure, round", round)
+			}
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package traffic
+
+import "time"
+
+type (
+	// Clock is the source of time of a Scheduler. Tests can replace the system
+	// clock with a fake, such as the one of package traffictest, to run traffic
+	// without waiting in real time.
+	Clock interface {
+		Now() time.Time
+		NewTimer(d time.Duration) Timer
+		NewTicker(d time.Duration) Ticker
+	}
+	// Timer is a time.Timer of a Clock.
+	Timer interface {
+		C() <-chan time.Time
+		Reset(d time.Duration) bool
+		Stop() bool
+	}
+	// Ticker is a time.Ticker of a Clock.
+	Ticker interface {
+		C() <-chan time.Time
+		Stop()
+	}
+
+	// realClock is the clock of the time package.
+	realClock  struct{}
+	realTimer  struct{ t *time.Timer }
+	realTicker struct{ t *time.Ticker }
+)
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{t: time.NewTimer(d)} }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{t: time.NewTicker(d)} }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+func (t realTimer) Stop() bool { return t.t.Stop() }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+
+func (t realTicker) Stop() { t.t.Stop() }
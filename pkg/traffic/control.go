@@ -0,0 +1,150 @@
+package traffic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+)
+
+var (
+	ErrNotRunning = errors.New("traffic is not running")
+	ErrUnknownOp  = errors.New("operation is not running")
+)
+
+type (
+	// controlKind is the kind of a control.
+	controlKind int
+	// control is a change to a running workload, applied by its dispatcher.
+	control struct {
+		kind controlKind
+		// rate is the new rate per minute of a controlRate.
+		rate uint64
+	}
+)
+
+const (
+	controlRate controlKind = iota
+	controlEnable
+	controlDisable
+	controlPause
+	controlResume
+)
+
+// SetRate changes the rate per minute of a running operation. The schedule of
+// the operation starts over at the new rate.
+func (s *scheduler) SetRate(mod, op string, rate uint) error {
+	if rate == 0 {
+		return fmt.Errorf("%w: %s.%s", ErrZeroRate, mod, op)
+	}
+
+	wl, err := s.workload(mod, op)
+	if err != nil {
+		return err
+	}
+	if err = s.control(wl, control{kind: controlRate, rate: uint64(rate)}); err != nil {
+		return err
+	}
+
+	s.reportRunEvent(wl.mod, wl.op.Name, stats.RunEventRate, fmt.Sprintf("%d/min", rate))
+	return nil
+}
+
+// SetEnabled enables or disables a running operation. A disabled operation is
+// not called until it is enabled again. Unlike an operation disabled by an
+// abort condition, it does not count as done.
+func (s *scheduler) SetEnabled(mod, op string, enabled bool) error {
+	wl, err := s.workload(mod, op)
+	if err != nil {
+		return err
+	}
+
+	c, kind := control{kind: controlDisable}, stats.RunEventDisable
+	if enabled {
+		c, kind = control{kind: controlEnable}, stats.RunEventEnable
+	}
+	if err = s.control(wl, c); err != nil {
+		return err
+	}
+
+	s.reportRunEvent(wl.mod, wl.op.Name, kind, "")
+	return nil
+}
+
+// Pause stops calling all operations until Resume is called.
+func (s *scheduler) Pause() error {
+	return s.controlAll(control{kind: controlPause}, stats.RunEventPause)
+}
+
+// Resume resumes the operations after Pause. Their schedules start over, so
+// calls missed while paused are not made up for.
+func (s *scheduler) Resume() error {
+	return s.controlAll(control{kind: controlResume}, stats.RunEventResume)
+}
+
+/*INTERNAL*/
+
+// workload returns the running workload of an operation. The module name is
+// matched case-insensitively, as in flag names.
+func (s *scheduler) workload(mod, op string) (*workload, error) {
+	if !s.isRunning() {
+		return nil, ErrNotRunning
+	}
+
+	for _, wl := range s.workloads {
+		if strings.EqualFold(wl.mod, mod) && wl.op.Name == op {
+			return wl, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s.%s", ErrUnknownOp, mod, op)
+}
+
+// isRunning reports whether Run has started the workloads.
+func (s *scheduler) isRunning() bool {
+	select {
+	case <-s.running:
+		return true
+	default:
+		return false
+	}
+}
+
+// control passes c to the dispatcher of the workload.
+func (s *scheduler) control(wl *workload, c control) error {
+	select {
+	case wl.controls <- c:
+		return nil
+	case <-s.ctx.Done():
+		return ErrNotRunning
+	}
+}
+
+// controlAll passes c to the dispatchers of all workloads, and reports the
+// change as a run event of the given kind.
+func (s *scheduler) controlAll(c control, kind string) error {
+	if !s.isRunning() {
+		return ErrNotRunning
+	}
+
+	for _, wl := range s.workloads {
+		if err := s.control(wl, c); err != nil {
+			return err
+		}
+	}
+
+	s.reportRunEvent("", "", kind, "")
+	return nil
+}
+
+// reportRunEvent passes a change made to running traffic on to the reporter,
+// if it accepts run events.
+func (s *scheduler) reportRunEvent(mod, op, kind, detail string) {
+	s.logger.Info("Traffic changed", "mod", mod, "op", op, "kind", kind, "detail", detail)
+
+	if er, ok := s.reporter.(report.RunEventReporter); ok {
+		er.ReportRunEvent(&stats.RunEvent{Time: s.clock.Now(), Module: mod, Op: op, Kind: kind, Detail: detail})
+	}
+}
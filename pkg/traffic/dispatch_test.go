@@ -0,0 +1,467 @@
+package traffic_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/maansaake/arbiter/pkg/module"
+	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
+	"github.com/maansaake/arbiter/pkg/report/stats"
+	"github.com/maansaake/arbiter/pkg/traffic"
+	"github.com/maansaake/arbiter/pkg/traffic/traffictest"
+)
+
+// workloadTimers is the number of timers of a running workload, its dispatch
+// timer and rate check ticker.
+const workloadTimers = 2
+
+func TestDispatchRate(t *testing.T) {
+	tests := []struct {
+		rate     uint
+		duration time.Duration
+		step     time.Duration
+	}{
+		{rate: 1, duration: time.Hour, step: time.Second},
+		{rate: 60, duration: 10 * time.Minute, step: 100 * time.Millisecond},
+		{rate: 100000, duration: time.Minute, step: 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d per minute", tt.rate), func(t *testing.T) {
+			var calls atomic.Uint64
+			op := &module.Op{Name: "test", Rate: tt.rate, Do: func() (module.Result, error) {
+				calls.Add(1)
+				return module.Result{}, nil
+			}}
+
+			// The first invocation is due at the start.
+			due := func(elapsed time.Duration) uint64 {
+				return uint64(elapsed)*uint64(tt.rate)/uint64(time.Minute) + 1
+			}
+
+			clock, sched, cancel := startScheduler(t, op)
+			start := clock.Now()
+			advance(clock, tt.duration, tt.step, func() {
+				// Invocations due are awaited before moving on, so none are late.
+				expected := due(clock.Now().Sub(start))
+				waitFor(t, func() bool { return calls.Load() >= expected })
+			})
+
+			cancel()
+			if err := sched.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			if expected := due(tt.duration); calls.Load() != expected {
+				t.Fatalf("expected %d calls, got %d", expected, calls.Load())
+			}
+		})
+	}
+}
+
+func TestDispatchWorkerLimit(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Uint64
+	op := &module.Op{Name: "test", Rate: 600, MaxConcurrency: 3, Do: func() (module.Result, error) {
+		calls.Add(1)
+		<-release
+		return module.Result{}, nil
+	}}
+
+	clock, sched, cancel := startScheduler(t, op)
+	advance(clock, 30*time.Second, 100*time.Millisecond, nil)
+
+	// The worker pool is saturated, so no further invocations are made.
+	waitFor(t, func() bool { return calls.Load() >= 3 })
+	if calls.Load() != 3 {
+		t.Fatal("expected 3 calls while saturated, got", calls.Load())
+	}
+
+	// Once released, invocations more than a sampling interval late are
+	// skipped: 301 are due, of which the first 201 are late.
+	close(release)
+	waitFor(t, func() bool { return calls.Load() >= 103 })
+	cancel()
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 103 {
+		t.Fatal("expected 103 calls, got", calls.Load())
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	var once sync.Once
+	op := &module.Op{Name: "test", Rate: 60, Do: func() (module.Result, error) {
+		once.Do(func() { close(started) })
+		<-release
+		return module.Result{}, nil
+	}}
+
+	clock, sched, cancel := startScheduler(t, op)
+	// Stopped before the invocation starts, the workload would stop cleanly.
+	waitFor(t, func() bool { return isClosed(started) })
+	cancel()
+
+	stopErr := make(chan error)
+	go func() {
+		stopErr <- sched.Stop()
+	}()
+
+	// The stop timeout runs on the clock, alongside the timers of the workload
+	// awaiting its worker.
+	waitFor(t, func() bool { return clock.Waiting() >= workloadTimers+1 })
+	clock.Advance(5 * time.Second)
+	select {
+	case err := <-stopErr:
+		if !errors.Is(err, traffic.ErrCleanupTimeout) {
+			t.Fatal("expected a cleanup timeout, got", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the scheduler to stop")
+	}
+}
+
+// startScheduler runs traffic for the op with a fake clock, and waits for the
+// workload to start.
+func startScheduler(t *testing.T, op *module.Op) (*traffictest.Clock, traffic.Scheduler, context.CancelFunc) {
+	t.Helper()
+
+	mod := modulemock.NewMock()
+	mod.SetOps = module.Ops{op}
+
+	clock := traffictest.NewClock(time.Time{})
+	sched := traffic.New(&traffic.Opts{Logger: logr.Discard(), Clock: clock})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := sched.Run(ctx, []*module.Meta{{Module: mod}}, stats.NewCollector()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return clock.Waiting() >= workloadTimers })
+
+	return clock, sched, cancel
+}
+
+// advance advances the clock by d in steps, letting the workload handle its
+// timers between steps. If set, wait is called after each step.
+func advance(clock *traffictest.Clock, d, step time.Duration, wait func()) {
+	for elapsed := time.Duration(0); elapsed < d; elapsed += step {
+		clock.Advance(step)
+		clock.BlockUntil(workloadTimers)
+		if wait != nil {
+			wait()
+		}
+	}
+}
+
+// waitFor waits in real time for cond to hold.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestIterations(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       *traffic.Opts
+		iterations [2]uint
+		latency    time.Duration
+		expected   func(a, b uint64) bool
+		done       bool
+	}{
+		{
+			name:       "per op",
+			opts:       &traffic.Opts{IterationsPerOp: 3},
+			iterations: [2]uint{5, 0},
+			expected:   func(a, b uint64) bool { return a == 5 && b == 3 },
+			done:       true,
+		},
+		{
+			name:     "total",
+			opts:     &traffic.Opts{Iterations: 10},
+			expected: func(a, b uint64) bool { return a+b == 10 },
+			done:     true,
+		},
+		{
+			name:       "total before per op",
+			opts:       &traffic.Opts{Iterations: 4},
+			iterations: [2]uint{5, 5},
+			expected:   func(a, b uint64) bool { return a+b == 4 },
+			done:       true,
+		},
+		{
+			name:     "max in flight",
+			opts:     &traffic.Opts{IterationsPerOp: 5, MaxInFlight: 1},
+			latency:  time.Millisecond,
+			expected: func(a, b uint64) bool { return a == 5 && b == 5 },
+			done:     true,
+		},
+		{
+			name:     "total max in flight",
+			opts:     &traffic.Opts{Iterations: 6, MaxInFlight: 1},
+			latency:  time.Millisecond,
+			expected: func(a, b uint64) bool { return a+b == 6 },
+			done:     true,
+		},
+		{
+			name:       "unbounded op",
+			opts:       &traffic.Opts{},
+			iterations: [2]uint{5, 0},
+			expected:   func(a, _ uint64) bool { return a == 5 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls [2]atomic.Uint64
+			mod := modulemock.NewMock()
+			for i := range calls {
+				mod.SetOps = append(mod.SetOps, &module.Op{
+					Name:       fmt.Sprint("op", i),
+					Rate:       60000,
+					Iterations: tt.iterations[i],
+					Do: func() (module.Result, error) {
+						time.Sleep(tt.latency)
+						calls[i].Add(1)
+						return module.Result{}, nil
+					},
+				})
+			}
+
+			clock := traffictest.NewClock(time.Time{})
+			tt.opts.Logger = logr.Discard()
+			tt.opts.Clock = clock
+			sched := traffic.New(tt.opts)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if err := sched.Run(ctx, []*module.Meta{{Module: mod}}, stats.NewCollector()); err != nil {
+				t.Fatal(err)
+			}
+
+			// Like Execute, the test ends as soon as the scheduler is done.
+			go func() {
+				select {
+				case <-sched.Done():
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			// The clock is advanced until the calls are made, a workload done with
+			// its iterations no longer waits for its dispatch timer.
+			clock.BlockUntil(len(calls) * workloadTimers)
+			waitFor(t, func() bool {
+				clock.Advance(time.Millisecond)
+				return tt.expected(calls[0].Load(), calls[1].Load())
+			})
+			if tt.done {
+				waitFor(t, func() bool { return isClosed(sched.Done()) })
+			} else if isClosed(sched.Done()) {
+				t.Fatal("expected the scheduler to never be done")
+			}
+
+			cancel()
+			if err := sched.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			if a, b := calls[0].Load(), calls[1].Load(); !tt.expected(a, b) {
+				t.Fatal("unexpected calls", a, b)
+			}
+		})
+	}
+}
+
+// isClosed returns true if ch is closed.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestAbort(t *testing.T) {
+	tests := []struct {
+		action  traffic.AbortAction
+		aborted bool
+		done    bool
+	}{
+		{action: traffic.AbortStop, aborted: true},
+		{action: traffic.AbortDisable, done: true},
+		{action: traffic.AbortBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.action), func(t *testing.T) {
+			mod := modulemock.NewMock()
+			mod.SetName = "mod"
+			mod.SetOps = module.Ops{{Name: "test", Rate: 60000, Do: func() (module.Result, error) {
+				return module.Result{}, errors.New("down")
+			}}}
+
+			collector := stats.NewCollector()
+			sched := traffic.New(&traffic.Opts{
+				Logger: logr.Discard(),
+				Abort:  traffic.AbortConditions{ConsecutiveFailures: 3, Action: tt.action},
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if err := sched.Run(ctx, []*module.Meta{{Module: mod}}, collector); err != nil {
+				t.Fatal(err)
+			}
+
+			// Wait for the condition to trigger.
+			waitFor(t, func() bool {
+				op := collector.Snapshot().Op("mod", "test")
+				return op != nil && len(op.Aborts) > 0
+			})
+
+			select {
+			case <-sched.Aborted():
+				if !tt.aborted {
+					t.Fatal("expected the test not to be aborted")
+				}
+			case <-sched.Done():
+				if !tt.done {
+					t.Fatal("expected the scheduler not to be done")
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tt.aborted || tt.done {
+					t.Fatal("expected the scheduler to be aborted or done")
+				}
+			}
+
+			cancel()
+			if err := sched.Stop(); err != nil {
+				t.Fatal(err)
+			}
+
+			op := collector.Snapshot().Op("mod", "test")
+			for _, abort := range op.Aborts {
+				if abort.Action != string(tt.action) || abort.Reason != "3 consecutive failures" {
+					t.Fatalf("unexpected abort %+v", abort)
+				}
+			}
+			if tt.action != traffic.AbortBackoff && len(op.Aborts) != 1 {
+				t.Fatal("expected a single abort, got", len(op.Aborts))
+			}
+		})
+	}
+}
+
+func TestControl(t *testing.T) {
+	if err := traffic.New(nil).Pause(); !errors.Is(err, traffic.ErrNotRunning) {
+		t.Fatal("expected traffic not to be running, got", err)
+	}
+
+	var calls atomic.Uint64
+	mod := modulemock.NewMock()
+	mod.SetName = "mod"
+	mod.SetOps = module.Ops{{Name: "test", Rate: 60, Do: func() (module.Result, error) {
+		calls.Add(1)
+		return module.Result{}, nil
+	}}}
+
+	clock := traffictest.NewClock(time.Time{})
+	collector := stats.NewCollector()
+	sched := traffic.New(&traffic.Opts{Logger: logr.Discard(), Clock: clock})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := sched.Run(ctx, []*module.Meta{{Module: mod}}, collector); err != nil {
+		t.Fatal(err)
+	}
+	clock.BlockUntil(workloadTimers)
+
+	// run advances the clock by d, awaiting each call due at the rate, and
+	// returns the calls made on the way.
+	run := func(d time.Duration, rate uint64) uint64 {
+		before, start := calls.Load(), clock.Now()
+		advance(clock, d, 100*time.Millisecond, func() {
+			expected := before + uint64(clock.Now().Sub(start))*rate/uint64(time.Minute)
+			waitFor(t, func() bool { return calls.Load() >= expected })
+		})
+		return calls.Load() - before
+	}
+	// await waits for the call due when a schedule starts over.
+	await := func(expected uint64) {
+		waitFor(t, func() bool { return calls.Load() == expected })
+		clock.BlockUntil(workloadTimers)
+	}
+
+	await(1)
+	if n := run(10*time.Second, 60); n != 10 {
+		t.Fatal("expected 10 calls at 60/min, got", n)
+	}
+
+	if err := sched.SetRate("mod", "test", 120); err != nil {
+		t.Fatal(err)
+	}
+	await(12)
+	if n := run(10*time.Second, 120); n != 20 {
+		t.Fatal("expected 20 calls at 120/min, got", n)
+	}
+
+	for _, hold := range []struct{ stop, start func() error }{
+		{stop: sched.Pause, start: sched.Resume},
+		{
+			stop:  func() error { return sched.SetEnabled("mod", "test", false) },
+			start: func() error { return sched.SetEnabled("mod", "test", true) },
+		},
+	} {
+		before := calls.Load()
+		if err := hold.stop(); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(10 * time.Second)
+		if err := hold.start(); err != nil {
+			t.Fatal(err)
+		}
+		// No calls are made while held, and the schedule starts over.
+		await(before + 1)
+	}
+
+	if err := sched.SetRate("mod", "unknown", 60); !errors.Is(err, traffic.ErrUnknownOp) {
+		t.Fatal("expected an unknown operation, got", err)
+	}
+	if err := sched.SetRate("mod", "test", 0); !errors.Is(err, traffic.ErrZeroRate) {
+		t.Fatal("expected a zero rate error, got", err)
+	}
+
+	cancel()
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sched.Resume(); !errors.Is(err, traffic.ErrNotRunning) {
+		t.Fatal("expected traffic not to be running, got", err)
+	}
+
+	var kinds []string
+	for _, event := range collector.Snapshot().Events {
+		kinds = append(kinds, event.Kind)
+	}
+	expected := []string{
+		stats.RunEventRate, stats.RunEventPause, stats.RunEventResume, stats.RunEventDisable, stats.RunEventEnable,
+	}
+	if !slices.Equal(kinds, expected) {
+		t.Fatal("unexpected run events", kinds)
+	}
+}
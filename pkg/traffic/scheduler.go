@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -17,6 +18,8 @@ var (
 	ErrZeroRate        = errors.New("operation has a zero rate")
 	ErrCleanupTimeout  = errors.New("cleanup timed out")
 	ErrRateIssue       = errors.New("rate issue")
+	ErrWorkerStart     = errors.New("worker start failed")
+	ErrWorkerStop      = errors.New("worker stop failed")
 )
 
 const (
@@ -33,9 +36,23 @@ type Opts struct {
 	// Logger is used for traffic scheduler logs. Defaults to a discard logger if not set.
 	Logger logr.Logger
 	// WorkerLimit is the maximum number of concurrent workers per workload. Defaults to DefaultWorkerLimit.
+	// Operations with a MaxConcurrency override it.
 	WorkerLimit int
-	// SampleTolerancePerc is the tolerance percentage used when comparing sampled rates in tests.
-	// Defaults to 0.05 (5%).
+	// MaxInFlight is the maximum number of concurrent invocations across all workloads. Unlimited if 0.
+	MaxInFlight int
+	// Iterations is the total number of invocations to make across all workloads. Unlimited if 0.
+	Iterations uint
+	// IterationsPerOp is the number of invocations to make of each operation without Iterations of
+	// its own. Unlimited if 0.
+	IterationsPerOp uint
+	// Abort are the conditions under which the traffic of an operation is
+	// aborted. None are checked if not set.
+	Abort AbortConditions
+	// Clock is the source of time of the scheduler. Defaults to the system clock if not set. With a
+	// fake clock, Stop only times out when the clock is advanced.
+	Clock Clock
+	// SampleTolerancePerc is the fraction of the expected calls a sampling interval may fall short
+	// by before it counts as having missed the target rate. Defaults to 0.05 (5%).
 	SampleTolerancePerc float64
 }
 
@@ -47,15 +64,49 @@ type Scheduler interface {
 	Run(ctx context.Context, metadata module.Metadata, reporter report.Reporter) error
 	// Stop waits for all workloads to finish after the context passed to Run is cancelled.
 	Stop() error
+	// Done is closed once the invocations of all iterations have completed, either the total
+	// iterations or the iterations of every operation, once every operation has been disabled by
+	// an abort condition, or once a feeder that ends the test is exhausted. It is never closed
+	// while an operation with unlimited iterations is running and there is no total.
+	Done() <-chan struct{}
+	// Aborted is closed once an abort condition with the AbortStop action triggers.
+	Aborted() <-chan struct{}
+	// SetRate changes the rate per minute of a running operation.
+	SetRate(mod, op string, rate uint) error
+	// SetEnabled enables or disables a running operation.
+	SetEnabled(mod, op string, enabled bool) error
+	// Pause stops calling all operations until Resume is called.
+	Pause() error
+	// Resume resumes calling the operations after Pause.
+	Resume() error
 }
 
 type scheduler struct {
+	clock               Clock
 	logger              logr.Logger
 	workerLimit         int
+	maxInFlight         int
+	iterations          uint
+	iterationsPerOp     uint
+	abort               AbortConditions
 	sampleTolerancePerc float64
 
 	workloads []*workload
 	stopChan  chan *workload
+	// ctx and reporter are those passed to Run, used to control running
+	// traffic once running is closed.
+	ctx      context.Context //nolint:containedctx // controls are only valid while Run's context is
+	reporter report.Reporter
+	running  chan struct{}
+
+	// unfinished counts the workloads that have not used up their iterations,
+	// and done is closed by finish.
+	unfinished atomic.Int64
+	done       chan struct{}
+	doneOnce   sync.Once
+	// aborted is closed by stop.
+	aborted     chan struct{}
+	abortedOnce sync.Once
 }
 
 // New creates a Scheduler with the given options. A nil opts uses all defaults.
@@ -66,13 +117,24 @@ func New(opts *Opts) Scheduler {
 	if opts.WorkerLimit == 0 {
 		opts.WorkerLimit = DefaultWorkerLimit
 	}
+	if opts.Clock == nil {
+		opts.Clock = realClock{}
+	}
 	if opts.SampleTolerancePerc == 0 {
 		opts.SampleTolerancePerc = defaultSampleTolerancePerc
 	}
 	return &scheduler{
+		clock:               opts.Clock,
 		logger:              opts.Logger,
 		workerLimit:         opts.WorkerLimit,
+		maxInFlight:         opts.MaxInFlight,
+		iterations:          opts.Iterations,
+		iterationsPerOp:     opts.IterationsPerOp,
+		abort:               opts.Abort,
 		sampleTolerancePerc: opts.SampleTolerancePerc,
+		done:                make(chan struct{}),
+		aborted:             make(chan struct{}),
+		running:             make(chan struct{}),
 	}
 }
 
@@ -87,9 +149,23 @@ func (s *scheduler) Run(
 	reporter report.Reporter,
 ) error {
 	s.logger.Info("Running traffic generator")
+	s.reporter = reporter
+
+	// Invocations of all workloads share the in-flight slots, if limited.
+	var slots chan struct{}
+	if s.maxInFlight > 0 {
+		slots = make(chan struct{}, s.maxInFlight)
+	}
+
+	// Iterations of the total are shared by all workloads, if limited.
+	var total *budget
+	if s.iterations > 0 {
+		total = &budget{remaining: uint64(s.iterations), empty: s.finish}
+	}
 
 	s.workloads = make([]*workload, 0, len(metadata))
 	for _, meta := range metadata {
+		hooks, _ := meta.Module.(module.WorkerHooks)
 		for _, op := range meta.Ops() {
 			if op.Disabled {
 				s.logger.Info("Skipping disabled operation", "mod", meta.Name(), "op", op.Name)
@@ -100,13 +176,34 @@ func (s *scheduler) Run(
 				return fmt.Errorf("%w: %s", ErrZeroRate, op.Name)
 			}
 
+			workerLimit := s.workerLimit
+			if op.MaxConcurrency > 0 {
+				workerLimit = int(op.MaxConcurrency)
+			}
+
+			iterations := s.iterationsPerOp
+			if op.Iterations > 0 {
+				iterations = op.Iterations
+			}
+
 			s.workloads = append(s.workloads, &workload{
-				workerLimit: s.workerLimit,
-				statLock:    &sync.Mutex{},
-				mod:         meta.Name(),
-				op:          op,
-				reporter:    reporter,
-				logger:      s.logger,
+				clock:               s.clock,
+				iterations:          uint64(iterations),
+				budget:              total,
+				exhausted:           s.exhausted,
+				end:                 s.finish,
+				breaker:             newBreaker(s.abort, s.clock.Now()),
+				stop:                s.stop,
+				controls:            make(chan control),
+				workerLimit:         workerLimit,
+				slots:               slots,
+				sampleTolerancePerc: s.sampleTolerancePerc,
+				statLock:            &sync.Mutex{},
+				mod:                 meta.Name(),
+				op:                  op,
+				hooks:               hooks,
+				reporter:            reporter,
+				logger:              s.logger,
 			})
 		}
 	}
@@ -115,6 +212,8 @@ func (s *scheduler) Run(
 		return ErrNoOpsToSchedule
 	}
 
+	s.unfinished.Store(int64(len(s.workloads)))
+
 	// Create stop channel that workloads will report to when stopping.
 	s.stopChan = make(chan *workload, len(s.workloads))
 	for _, wl := range s.workloads {
@@ -126,6 +225,9 @@ func (s *scheduler) Run(
 		go wl.run(ctx)
 	}
 
+	s.ctx = ctx
+	close(s.running)
+
 	return nil
 }
 
@@ -133,10 +235,13 @@ func (s *scheduler) Run(
 func (s *scheduler) Stop() error {
 	s.logger.Info("Stopping traffic generator", "workload_count", len(s.workloads))
 
+	timeout := s.clock.NewTimer(cleanupTimeout)
+	defer timeout.Stop()
+
 	stopCount := 0
 	for {
 		select {
-		case <-time.After(cleanupTimeout):
+		case <-timeout.C():
 			s.logger.Error(ErrCleanupTimeout, "Cleanup timed out after "+cleanupTimeout.String())
 			return ErrCleanupTimeout
 		case wl := <-s.stopChan:
@@ -150,6 +255,40 @@ func (s *scheduler) Stop() error {
 	}
 }
 
+// Done returns a channel that is closed once the invocations of all iterations have completed.
+func (s *scheduler) Done() <-chan struct{} {
+	return s.done
+}
+
+// Aborted returns a channel that is closed once an abort condition stops the test.
+func (s *scheduler) Aborted() <-chan struct{} {
+	return s.aborted
+}
+
+// exhausted is called by each workload whose own iterations have completed, or
+// that has been disabled by an abort condition.
+func (s *scheduler) exhausted() {
+	if s.unfinished.Add(-1) == 0 {
+		s.finish()
+	}
+}
+
+// finish closes the done channel, once.
+func (s *scheduler) finish() {
+	s.doneOnce.Do(func() {
+		s.logger.Info("All iterations completed")
+		close(s.done)
+	})
+}
+
+// stop closes the aborted channel, once.
+func (s *scheduler) stop() {
+	s.abortedOnce.Do(func() {
+		s.logger.Info("Abort condition triggered, stopping")
+		close(s.aborted)
+	})
+}
+
 func getSampleInterval(op *module.Op) time.Duration {
 	if op.Rate < minRateForDefaultSample {
 		// Minimum 5 samples, this should be a super corner case. Add some time
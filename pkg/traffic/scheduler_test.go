@@ -3,7 +3,11 @@ package traffic
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,6 +15,7 @@ import (
 	"github.com/maansaake/arbiter/pkg/module"
 	modulemock "github.com/maansaake/arbiter/pkg/module/mock"
 	reportmock "github.com/maansaake/arbiter/pkg/report/mock"
+	"github.com/maansaake/arbiter/pkg/report/stats"
 	log "github.com/trebent/zerologr"
 )
 
@@ -25,6 +30,7 @@ func newTestScheduler() Scheduler {
 func TestRunAndAwaitStop(t *testing.T) {
 	opWg := sync.WaitGroup{}
 	opWg.Add(2)
+	calls := atomic.Int32{}
 
 	mod := modulemock.NewMock()
 	mod.SetOps = module.Ops{
@@ -32,7 +38,10 @@ func TestRunAndAwaitStop(t *testing.T) {
 			Name: "test",
 			Rate: 60000,
 			Do: func() (module.Result, error) {
-				opWg.Done()
+				// More calls may be made before the context is cancelled.
+				if calls.Add(1) <= 2 {
+					opWg.Done()
+				}
 				log.Info("Doing OP")
 				return module.Result{}, nil
 			},
@@ -189,34 +198,337 @@ func TestReportOpErr(t *testing.T) {
 	}
 }
 
-func TestWorkerTickerInterval(t *testing.T) {
-	workload := &workload{
-		workerLimit: DefaultWorkerLimit,
-		op:          &module.Op{Rate: 1000},
-		calls:       999,
-		totalDur:    999 * time.Millisecond,
+func TestRateSample(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		calls   float64
+		missed  bool
+		limited bool
+	}{
+		{name: "on target", workers: 1, calls: 100},
+		{name: "within tolerance", workers: 1, calls: 96},
+		{name: "missed", workers: 1, calls: 90, missed: true},
+		{name: "missed at worker limit", workers: 2, calls: 90, missed: true, limited: true},
+		{name: "on target at worker limit", workers: 2, calls: 100},
 	}
-	// 1ms / op
-	maxRate := workload.getMaxRate()
 
-	if maxRate != float64(1*time.Minute)/float64(workload.getAverageDuration()) {
-		t.Fatal("unexpected max rate")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &workload{
+				workerLimit:         2,
+				sampleTolerancePerc: 0.05,
+				workers:             make([]*worker, tt.workers),
+			}
+
+			sample := w.rateSample(10*time.Second, tt.calls, 100)
+			if sample.Missed != tt.missed {
+				t.Fatalf("expected missed %t, got %t", tt.missed, sample.Missed)
+			}
+			if sample.WorkerLimited != tt.limited {
+				t.Fatalf("expected worker limited %t, got %t", tt.limited, sample.WorkerLimited)
+			}
+			if sample.Workers != tt.workers || sample.Calls != uint64(tt.calls) {
+				t.Fatalf("unexpected sample %+v", sample)
+			}
+		})
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	do := func(once *sync.Once) module.Do {
+		return func() (module.Result, error) {
+			once.Do(wg.Done)
+			return module.Result{}, nil
+		}
+	}
+
+	mod := modulemock.NewMock()
+	mod.SetOps = module.Ops{
+		{Name: "default", Rate: 60000, Do: do(&sync.Once{})},
+		{Name: "limited", Rate: 60000, MaxConcurrency: 20, Do: do(&sync.Once{})},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New(&Opts{Logger: logr.Discard(), WorkerLimit: 5, MaxInFlight: 3}).(*scheduler)
+	if err := s.Run(ctx, []*module.Meta{{Module: mod}}, reportmock.NewMock()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Await one invocation of each operation, so all workers have started.
+	wg.Wait()
+	cancel()
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.workloads[0].workerLimit != 5 || s.workloads[1].workerLimit != 20 {
+		t.Fatal("unexpected worker limits", s.workloads[0].workerLimit, s.workloads[1].workerLimit)
+	}
+	if s.workloads[0].slots == nil || s.workloads[0].slots != s.workloads[1].slots {
+		t.Fatal("expected workloads to share in-flight slots")
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	w := &workload{slots: make(chan struct{}, 1)}
+
+	if !w.acquire(context.Background()) {
+		t.Fatal("expected a free slot")
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- w.acquire(context.Background())
+	}()
+
+	// The second invocation waits until the first releases its slot.
+	select {
+	case <-acquired:
+		t.Fatal("expected to wait for a slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	w.release()
+	if !<-acquired {
+		t.Fatal("expected the released slot")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if w.acquire(ctx) {
+		t.Fatal("expected no slot once the context is done")
 	}
-	t.Log("max rate:", maxRate)
 
-	workerCount := workload.getWorkerCount()
-	if workerCount != 1 {
-		t.Fatal("unexpected worker count")
+	sample := w.rateSample(time.Second, 2, 2)
+	if sample.Throttled != 2 {
+		t.Fatal("expected 2 throttled invocations, got", sample.Throttled)
+	}
+	if sample.MaxInFlight != 1 {
+		t.Fatal("expected max in-flight 1, got", sample.MaxInFlight)
+	}
+	if w.throttled.Load() != 0 || w.maxInFlight.Load() != 1 {
+		t.Fatal("expected the interval accounting to be reset")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	start := time.Now()
+	for _, rate := range []uint64{1, 7, 60, 100000} {
+		s := &schedule{start: start, rate: rate}
+		if s.due(start.Add(-time.Nanosecond)) != 0 || s.due(start) != 1 {
+			t.Fatal("expected the first invocation to be due at start")
+		}
+
+		for n := range uint64(1000) {
+			at := s.at(n)
+			if s.due(at) != n+1 || s.due(at.Add(-time.Nanosecond)) != n {
+				t.Fatalf("rate %d: invocation %d not due exactly at %s", rate, n, at.Sub(start))
+			}
+		}
+
+		if due := s.due(start.Add(time.Hour)); due != 60*rate+1 {
+			t.Fatalf("rate %d: expected %d invocations due after an hour, got %d", rate, 60*rate+1, due)
+		}
+	}
+}
+
+// hookedModule is a module with worker hooks, which give each worker a
+// context carrying its number.
+type hookedModule struct {
+	*modulemock.Module
+	started, stopped atomic.Int32
+	startErr         error
+}
+
+type workerKey struct{}
+
+func (m *hookedModule) WorkerStart(ctx context.Context, _ string) (context.Context, error) {
+	if m.startErr != nil {
+		return nil, m.startErr
+	}
+
+	return context.WithValue(ctx, workerKey{}, m.started.Add(1)), nil
+}
+
+func (m *hookedModule) WorkerStop(ctx context.Context, _ string) error {
+	if ctx.Value(workerKey{}) == nil {
+		return errors.New("missing worker context")
+	}
+	m.stopped.Add(1)
+	return nil
+}
+
+func TestWorkerHooks(t *testing.T) {
+	calls := atomic.Int32{}
+	mod := &hookedModule{Module: modulemock.NewMock()}
+	mod.SetOps = module.Ops{
+		{
+			Name: "test",
+			Rate: 60000,
+			DoCtx: func(ctx context.Context) (module.Result, error) {
+				if _, ok := ctx.Value(workerKey{}).(int32); !ok {
+					return module.Result{}, errors.New("missing worker context")
+				}
+				calls.Add(1)
+				return module.Result{}, nil
+			},
+		},
+	}
+
+	collector := stats.NewCollector()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	sched := newTestScheduler()
+	if err := sched.Run(ctx, []*module.Meta{{Module: mod}}, collector); err != nil {
+		t.Fatal(err)
+	}
+	<-ctx.Done()
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
 	}
 
-	ratePerWorker := workload.ratePerWorker(workerCount)
-	if ratePerWorker != 1000 {
-		t.Fatal("unexpected worker rate")
+	op := collector.Snapshot().Op("", "test")
+	if op == nil || op.Executions == 0 || op.NOK != 0 || calls.Load() != int32(op.Executions) {
+		t.Fatal("expected successful invocations with the worker context")
+	}
+	if mod.started.Load() == 0 || mod.stopped.Load() != mod.started.Load() {
+		t.Fatalf("expected every started worker to stop, started %d, stopped %d",
+			mod.started.Load(), mod.stopped.Load())
+	}
+}
+
+func TestWorkerStartFailure(t *testing.T) {
+	feeder := newTestFeeder(t, module.FeedUnique, false)
+	mod := &hookedModule{Module: modulemock.NewMock(), startErr: errors.New("no connection")}
+	mod.SetOps = module.Ops{
+		{
+			Name:    "test",
+			Rate:    6000,
+			Feeders: []*module.Feeder{feeder},
+			DoCtx: func(context.Context) (module.Result, error) {
+				t.Error("operation invoked by a worker that failed to start")
+				return module.Result{}, nil
+			},
+		},
+	}
+
+	collector := stats.NewCollector()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	sched := newTestScheduler()
+	if err := sched.Run(ctx, []*module.Meta{{Module: mod}}, collector); err != nil {
+		t.Fatal(err)
+	}
+	<-ctx.Done()
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	op := collector.Snapshot().Op("", "test")
+	if op == nil || op.Executions == 0 || op.NOK != op.Executions {
+		t.Fatal("expected every invocation to fail")
+	}
+	if mod.stopped.Load() != 0 {
+		t.Fatal("expected no worker to stop that did not start")
+	}
+	for range 3 {
+		if _, err := feeder.Next(); err != nil {
+			t.Fatal("expected no record to be taken by workers that did not start, got", err)
+		}
+	}
+}
+
+// newTestFeeder creates a loaded feeder of the records 1, 2 and 3.
+func newTestFeeder(t *testing.T, strategy module.FeedStrategy, endTest bool) *module.Feeder {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ids.csv")
+	if err := os.WriteFile(path, []byte("id\n1\n2\n3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	feeder := &module.Feeder{Name: "ids", Path: path, Strategy: strategy, EndTest: endTest}
+	if err := feeder.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	return feeder
+}
+
+func TestFeederEndsTest(t *testing.T) {
+	feeder := newTestFeeder(t, module.FeedUnique, true)
+	var lock sync.Mutex
+	var ids []string
+	mod := modulemock.NewMock()
+	mod.SetOps = module.Ops{
+		{
+			Name:    "test",
+			Rate:    60000,
+			Feeders: []*module.Feeder{feeder},
+			DoCtx: func(ctx context.Context) (module.Result, error) {
+				lock.Lock()
+				ids = append(ids, feeder.Record(ctx)["id"])
+				lock.Unlock()
+				return module.Result{}, nil
+			},
+		},
+	}
+
+	collector := stats.NewCollector()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	sched := newTestScheduler()
+	if err := sched.Run(ctx, []*module.Meta{{Module: mod}}, collector); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sched.Done():
+	case <-ctx.Done():
+		t.Fatal("expected the exhausted feeder to end the test")
+	}
+	cancel()
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(ids)
+	if want := []string{"1", "2", "3"}; !slices.Equal(ids, want) {
+		t.Fatalf("expected every record once, got %v", ids)
+	}
+	if op := collector.Snapshot().Op("", "test"); op == nil || op.Executions != 3 || op.NOK != 0 {
+		t.Fatal("expected an invocation per record")
+	}
+}
+
+func TestFeederExhausted(t *testing.T) {
+	feeder := newTestFeeder(t, module.FeedSequential, false)
+	mod := modulemock.NewMock()
+	mod.SetOps = module.Ops{
+		{
+			Name:    "test",
+			Rate:    60000,
+			Feeders: []*module.Feeder{feeder},
+			DoCtx: func(context.Context) (module.Result, error) {
+				return module.Result{}, nil
+			},
+		},
+	}
+
+	collector := stats.NewCollector()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	sched := newTestScheduler()
+	if err := sched.Run(ctx, []*module.Meta{{Module: mod}}, collector); err != nil {
+		t.Fatal(err)
+	}
+	<-ctx.Done()
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
 	}
 
-	workerTickerInterval := workload.workerTickerInterval(workerCount)
-	t.Log(workerTickerInterval)
-	if workerTickerInterval != 1*time.Minute/time.Duration(workload.op.Rate) {
-		t.Fatal("unexpected worker ticker interval")
+	op := collector.Snapshot().Op("", "test")
+	if op == nil || op.Executions <= 3 || op.NOK != op.Executions-3 {
+		t.Fatal("expected invocations to fail once the feeder is exhausted")
 	}
 }
@@ -0,0 +1,173 @@
+// Package traffictest provides utilities for testing traffic without waiting
+// in real time.
+package traffictest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/maansaake/arbiter/pkg/traffic"
+)
+
+type (
+	// Clock is a traffic.Clock that only moves when advanced, firing the timers
+	// and tickers that are due on the way. It is safe for concurrent use.
+	//
+	// A scheduler using the clock reacts to a fired timer asynchronously, use
+	// BlockUntil to await the scheduler between advances:
+	//
+	//	clock := traffictest.NewClock(time.Time{})
+	//	sched := traffic.New(&traffic.Opts{Clock: clock})
+	//	...
+	//	for range 3600 {
+	//		clock.Advance(time.Second)
+	//		clock.BlockUntil(2) // the dispatch timer and rate check ticker of one operation
+	//	}
+	Clock struct {
+		mu     sync.Mutex
+		cond   *sync.Cond
+		now    time.Time
+		timers map[*timer]struct{}
+	}
+	// timer is a traffic.Timer, or a ticker if period is set, of a Clock.
+	timer struct {
+		clock  *Clock
+		c      chan time.Time
+		when   time.Time
+		period time.Duration
+	}
+	// ticker is the traffic.Ticker view of a timer with a period.
+	ticker struct{ *timer }
+)
+
+var _ traffic.Clock = &Clock{}
+
+// NewClock returns a Clock set to start. A zero start sets the clock to an
+// arbitrary fixed time.
+func NewClock(start time.Time) *Clock {
+	if start.IsZero() {
+		start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	c := &Clock{
+		now:    start,
+		timers: make(map[*timer]struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+
+	return c
+}
+
+// Now implements traffic.Clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer implements traffic.Clock.
+func (c *Clock) NewTimer(d time.Duration) traffic.Timer {
+	t := &timer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+
+	return t
+}
+
+// NewTicker implements traffic.Clock.
+func (c *Clock) NewTicker(d time.Duration) traffic.Ticker {
+	t := &timer{clock: c, c: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+
+	return ticker{t}
+}
+
+// Advance moves the clock forward by d, firing due timers and tickers in
+// order. Like a time.Ticker, a ticker whose channel is full drops ticks.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := c.now.Add(d)
+	for {
+		var next *timer
+		for t := range c.timers {
+			if !t.when.After(target) && (next == nil || t.when.Before(next.when)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		c.now = next.when
+		next.fire()
+	}
+	c.now = target
+}
+
+// BlockUntil blocks until at least n timers and tickers are waiting to fire.
+// A timer that has fired waits again once it is reset.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Waiting returns the number of timers and tickers waiting to fire.
+func (c *Clock) Waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+func (t *timer) C() <-chan time.Time { return t.c }
+
+func (t *timer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, active := t.clock.timers[t]
+	t.when = t.clock.now.Add(d)
+	if d <= 0 && t.period == 0 {
+		delete(t.clock.timers, t)
+		t.fire()
+		return active
+	}
+
+	t.clock.timers[t] = struct{}{}
+	t.clock.cond.Broadcast()
+
+	return active
+}
+
+func (t *timer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+
+	return active
+}
+
+func (t ticker) Stop() { t.timer.Stop() }
+
+// fire sends the current time if the channel is not full, like a time.Timer,
+// and rearms a ticker. The clock lock must be held.
+func (t *timer) fire() {
+	select {
+	case t.c <- t.clock.now:
+	default:
+	}
+
+	if t.period > 0 {
+		t.when = t.when.Add(t.period)
+	} else {
+		delete(t.clock.timers, t)
+	}
+}
@@ -0,0 +1,66 @@
+package traffictest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+
+	timer := c.NewTimer(time.Minute)
+	ticker := c.NewTicker(10 * time.Second)
+	if c.Waiting() != 2 {
+		t.Fatal("expected 2 waiting, got", c.Waiting())
+	}
+
+	c.Advance(15 * time.Second)
+	if got := <-ticker.C(); !got.Equal(start.Add(10 * time.Second)) {
+		t.Fatal("unexpected tick", got)
+	}
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	// Ticks are dropped while the channel is full, like a time.Ticker.
+	c.Advance(time.Hour)
+	if got := <-timer.C(); !got.Equal(start.Add(time.Minute)) {
+		t.Fatal("unexpected timer fire", got)
+	}
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatal("expected dropped ticks")
+	default:
+	}
+	if !c.Now().Equal(start.Add(time.Hour + 15*time.Second)) {
+		t.Fatal("unexpected now", c.Now())
+	}
+
+	// A fired timer waits again once reset.
+	if c.Waiting() != 1 || timer.Reset(time.Second) || c.Waiting() != 2 {
+		t.Fatal("unexpected waiting timers after reset")
+	}
+	if !timer.Stop() || c.Waiting() != 1 {
+		t.Fatal("expected the timer to stop")
+	}
+	ticker.Stop()
+	if c.Waiting() != 0 {
+		t.Fatal("expected no waiting timers")
+	}
+}
+
+func TestClockBlockUntil(t *testing.T) {
+	c := NewClock(time.Time{})
+	done := make(chan struct{})
+	go func() {
+		c.BlockUntil(1)
+		close(done)
+	}()
+
+	c.NewTimer(time.Second)
+	<-done
+}
@@ -2,52 +2,72 @@ package traffic
 
 import (
 	"context"
-	"time"
+	"fmt"
 )
 
 const workerVerboseLogLevel = 100
 
+// worker is a member of the worker pool of a workload, invoking the operation
+// once for each token it receives.
 type worker struct {
-	done   chan bool
 	parent *workload
-	ticker *time.Ticker
+	// ctx is passed to the invocations of the worker. err is set if the worker
+	// hooks of the module failed to start the worker, and fails each of its
+	// invocations.
+	ctx context.Context //nolint:containedctx // the context of the worker's invocations
+	err error
 }
 
-func (worker *worker) run(ctx context.Context) {
+// run invokes the operation for each token received until tokens is closed.
+func (worker *worker) run(ctx context.Context, tokens <-chan struct{}) {
+	defer worker.parent.workerWg.Done()
 	worker.parent.logger.Info("Starting worker", "mod", worker.parent.mod, "op", worker.parent.op.Name)
-	worker.done = make(chan bool)
-
-	for {
-		select {
-		case <-ctx.Done():
-			worker.parent.logger.Info(
-				"Context closed, stopping worker",
-				"mod",
-				worker.parent.mod,
-				"op",
-				worker.parent.op.Name,
-			)
-			worker.ticker.Stop()
-
-			close(worker.done)
-			return
-		case t := <-worker.ticker.C:
-			worker.parent.logger.V(workerVerboseLogLevel).
-				Info("Worker tick", "time", t, "mod", worker.parent.mod, "op", worker.parent.op.Name)
-			worker.parent.doOp()
-		}
+	worker.start(ctx)
+
+	for range tokens {
+		worker.parent.logger.V(workerVerboseLogLevel).
+			Info("Worker token", "mod", worker.parent.mod, "op", worker.parent.op.Name)
+		worker.parent.doOp(ctx, worker)
+	}
+
+	worker.stop()
+	worker.parent.logger.Info("Worker stopped", "mod", worker.parent.mod, "op", worker.parent.op.Name)
+}
+
+// start creates the context of the worker's invocations, which are not
+// cancelled with ctx so that they run to completion when traffic stops. If the
+// module has worker hooks, the context is the one returned by WorkerStart.
+func (worker *worker) start(ctx context.Context) {
+	worker.ctx = context.WithoutCancel(ctx)
+
+	hooks := worker.parent.hooks
+	if hooks == nil {
+		return
+	}
+
+	hookCtx, err := hooks.WorkerStart(worker.ctx, worker.parent.op.Name)
+	if err != nil {
+		worker.parent.logger.Info("Worker start failed", "mod", worker.parent.mod, "op", worker.parent.op.Name,
+			"error", err.Error())
+		worker.err = fmt.Errorf("%w: %w", ErrWorkerStart, err)
+		return
+	}
+	if hookCtx != nil {
+		worker.ctx = hookCtx
 	}
 }
 
-func (worker *worker) reset(tickerInterval time.Duration) {
-	worker.parent.logger.Info(
-		"Resetting worker ticker",
-		"mod",
-		worker.parent.mod,
-		"op",
-		worker.parent.op.Name,
-		"interval_µs",
-		tickerInterval.Microseconds(),
-	)
-	worker.ticker.Reset(tickerInterval)
+// stop calls WorkerStop of the module's worker hooks, if the worker was
+// started by them. An error is reported, as the invocations are done.
+func (worker *worker) stop() {
+	hooks := worker.parent.hooks
+	if hooks == nil || worker.err != nil {
+		return
+	}
+
+	if err := hooks.WorkerStop(worker.ctx, worker.parent.op.Name); err != nil {
+		worker.parent.reporter.ReportError(
+			fmt.Errorf("%w: %s.%s: %w", ErrWorkerStop, worker.parent.mod, worker.parent.op.Name, err),
+		)
+	}
 }
@@ -2,21 +2,64 @@ package traffic
 
 import (
 	"context"
-	"math"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/maansaake/arbiter/pkg/module"
 	"github.com/maansaake/arbiter/pkg/report"
+	"github.com/maansaake/arbiter/pkg/report/stats"
 )
 
 type workload struct {
-	mod string
-	op  *module.Op
-
-	workerLimit int
-	workers     []*worker
+	mod   string
+	op    *module.Op
+	clock Clock
+	// hooks are the worker hooks of the module, nil if it has none.
+	hooks module.WorkerHooks
+
+	// workerLimit bounds the worker pool, which receives invocation tokens from
+	// the dispatcher through tokens.
+	workerLimit         int
+	sampleTolerancePerc float64
+	workers             []*worker
+	workerWg            sync.WaitGroup
+	tokens              chan struct{}
+
+	// iterations is the number of invocations the workload makes, unlimited if
+	// 0, and budget the iterations shared by all workloads, nil if unlimited.
+	// exhausted is called once the invocations of the workload's own
+	// iterations have completed, counted by completed, and finished is set
+	// once it has been called.
+	iterations uint64
+	budget     *budget
+	exhausted  func()
+	completed  atomic.Uint64
+	finished   atomic.Bool
+	// end is called to end the test once a feeder of the operation that ends
+	// it is exhausted.
+	end func()
+
+	// breaker evaluates the abort conditions against the results of the
+	// workload, nil if there are none. Triggered actions are passed to the
+	// dispatcher through trips, and stop is called to stop the test.
+	breaker *breaker
+	trips   chan AbortAction
+	stop    func()
+	// controls receives changes made to the running workload.
+	controls chan control
+
+	// slots are the in-flight slots shared by all workloads, nil if unlimited.
+	slots chan struct{}
+	// inFlight is the number of invocations in progress, and maxInFlight the
+	// largest number in the current sampling interval.
+	inFlight    atomic.Int64
+	maxInFlight atomic.Int64
+	// throttled counts the invocations in the current sampling interval that
+	// had to wait for an in-flight slot.
+	throttled atomic.Uint64
 
 	statLock *sync.Mutex
 	calls    float64
@@ -29,19 +72,27 @@ type workload struct {
 
 const workloadVerboseLogLevel = 100
 
-// run runs the workload, which in turn spawns workers to do the actual invocations. The workload
-// will monitor call-rates and scale the number of workers as needed.
+// errEndTest is returned by feed once a feeder that ends the test is exhausted.
+var errEndTest = errors.New("feeder ended the test")
+
+// run runs the workload until ctx is done. A single dispatcher, the loop of
+// run, emits invocation tokens at the times given by the rate of the operation
+// into a pool of workers, which is grown up to the worker limit whenever no
+// worker is idle to take a token. Dispatching ends early once the iterations
+// of the workload, or the shared budget, are used up, or an abort condition
+// disables the workload, and an abort condition may lower the rate. Controls
+// change the rate, or hold dispatching while the workload is disabled or
+// paused. Rates are sampled at a fixed interval and reported.
 func (w *workload) run(ctx context.Context) {
 	w.logger.Info("Starting workload", "mod", w.mod, "op", w.op.Name, "rate", w.op.Rate)
 
-	// All workload start with exactly one worker. After the first sampling
-	// period, this may be increased.
-	w.workers = make([]*worker, 0, 1)
-	w.addWorker(ctx)
+	w.tokens = make(chan struct{})
+	w.trips = make(chan AbortAction, 1)
 	w.calls = 0
 
+	rate := uint64(w.op.Rate)
 	samplingInterval := getSampleInterval(w.op)
-	expectedCalls := float64(samplingInterval) / float64(time.Minute) * float64(w.op.Rate)
+	expectedCalls := float64(samplingInterval) / float64(time.Minute) * float64(rate)
 	w.logger.Info(
 		"Setting sampling interval",
 		"mod",
@@ -53,24 +104,158 @@ func (w *workload) run(ctx context.Context) {
 		"expected_calls",
 		expectedCalls,
 	)
-	rateCheckTicker := time.NewTicker(samplingInterval)
+	rateCheckTicker := w.clock.NewTicker(samplingInterval)
+	defer rateCheckTicker.Stop()
+
+	sched := &schedule{start: w.clock.Now(), rate: rate}
+	// due is the number of invocations due so far, and sent the number handed
+	// to the worker pool or skipped. dispatched counts only those handed to the
+	// worker pool, and reserved is set while an invocation pending dispatch
+	// holds an iteration of the shared budget. disabled and paused are set by
+	// controls, and hold dispatching like done, but only until cleared.
+	var due, sent, dispatched uint64
+	var reserved, done, disabled, paused bool
+	dispatchTimer := w.clock.NewTimer(0)
+	defer dispatchTimer.Stop()
+
+	active := func() bool {
+		return !done && !disabled && !paused
+	}
+
+	// restart starts the schedule over from now at the current rate.
+	restart := func() {
+		sched = &schedule{start: w.clock.Now(), rate: rate}
+		due, sent = 0, 0
+		expectedCalls = float64(samplingInterval) / float64(time.Minute) * float64(rate)
+		dispatchTimer.Reset(0)
+	}
+
+	// halt stops dispatching. An iteration of the shared budget reserved by an
+	// invocation that is no longer dispatched counts as completed.
+	halt := func() {
+		done = true
+		if reserved {
+			reserved = false
+			w.budget.complete()
+		}
+	}
+
+	dispatch := func() {
+		sent++
+		dispatched++
+		reserved = false
+
+		// The workload is finished once the invocations have completed.
+		if w.iterations > 0 && dispatched == w.iterations {
+			w.logger.Info("Iterations dispatched", "mod", w.mod, "op", w.op.Name, "iterations", w.iterations)
+			done = true
+		}
+	}
 
 	for {
+		// tokens is only ready to send on while an invocation is pending.
+		var tokens chan struct{}
+		if sent < due && active() && !reserved {
+			if reserved = w.budget.take(); !reserved {
+				w.logger.Info("Shared iteration budget used up", "mod", w.mod, "op", w.op.Name)
+				done = true
+			}
+		}
+		if sent < due && active() && reserved {
+			select {
+			case w.tokens <- struct{}{}:
+				dispatch()
+				continue
+			default:
+			}
+
+			// No worker is idle, add one if the limit allows or wait for one.
+			if len(w.workers) < w.workerLimit {
+				w.addWorker(ctx)
+			}
+			tokens = w.tokens
+		}
+
 		select {
 		case <-ctx.Done():
 			w.logger.Info("Context closed, stopping workload", "mod", w.mod, "op", w.op.Name)
-			rateCheckTicker.Stop()
 
-			for i, worker := range w.workers {
-				w.logger.Info("Awaiting worker", "mod", w.mod, "op", w.op.Name, "worker", i)
-				// Await the stop of each worker
-				<-worker.done
-				w.logger.Info("Worker stopped", "mod", w.mod, "op", w.op.Name, "worker", i)
-			}
+			close(w.tokens)
+			w.logger.Info("Awaiting workers", "mod", w.mod, "op", w.op.Name, "workers", len(w.workers))
+			w.workerWg.Wait()
 
 			w.stopChan <- w
 			return
-		case <-rateCheckTicker.C:
+		case tokens <- struct{}{}:
+			dispatch()
+		case action := <-w.trips:
+			if done {
+				continue
+			}
+
+			switch action {
+			case AbortBackoff:
+				// The schedule starts over at the lower rate.
+				rate = max(rate/2, 1) //nolint:mnd // halved
+				w.logger.Info("Backing off", "mod", w.mod, "op", w.op.Name, "rate", rate)
+				if active() {
+					restart()
+				}
+			case AbortDisable:
+				w.logger.Info("Disabling workload", "mod", w.mod, "op", w.op.Name)
+				halt()
+				w.finish()
+			case AbortStop:
+				halt()
+			}
+		case c := <-w.controls:
+			wasActive := active()
+			switch c.kind {
+			case controlRate:
+				rate = c.rate
+			case controlEnable:
+				disabled = false
+			case controlDisable:
+				disabled = true
+			case controlPause:
+				paused = true
+			case controlResume:
+				paused = false
+			}
+
+			// Calls missed while held are not made up for.
+			if active() && (!wasActive || c.kind == controlRate) {
+				restart()
+			}
+		case <-dispatchTimer.C():
+			if !active() {
+				continue
+			}
+
+			now := w.clock.Now()
+			due = sched.due(now)
+
+			// Invocations late by more than a sampling interval are skipped, to not
+			// burst when catching up after the worker pool has been saturated.
+			if skip := sched.due(now.Add(-samplingInterval)); sent < skip {
+				w.logger.Info("Skipping late invocations", "mod", w.mod, "op", w.op.Name, "count", skip-sent)
+				sent = skip
+			}
+
+			dispatchTimer.Reset(sched.at(due).Sub(now))
+		case <-rateCheckTicker.C():
+			var calls float64
+			var totalDur time.Duration
+			w.withStatLock(func() {
+				calls = w.calls
+				totalDur = w.totalDur
+				w.calls = 0
+				w.totalDur = 0
+			})
+			if !active() {
+				// Not dispatching, so the rate is not targeted.
+				continue
+			}
 			w.logger.Info(
 				"Running rate check",
 				"mod",
@@ -78,113 +263,259 @@ func (w *workload) run(ctx context.Context) {
 				"op",
 				w.op.Name,
 				"calls",
-				w.calls,
+				calls,
 				"expected_calls",
 				expectedCalls,
 			)
-
-			if w.calls > 0 {
-				avgUs := (w.totalDur / time.Duration(w.calls)).Microseconds()
+			if calls > 0 {
+				avgUs := (totalDur / time.Duration(calls)).Microseconds()
 				w.logger.Info("Average exec time", "mod", w.mod, "op", w.op.Name, "avg_µs", avgUs)
-
-				w.scale(ctx)
 			}
 
-			// Reset check # of executions next time the checker is run.
-			w.withStatLock(func() {
-				w.calls = 0
-				w.totalDur = 0
-			})
+			w.reportRate(w.rateSample(samplingInterval, calls, expectedCalls))
 		}
 	}
 }
 
-// withStatLock calls the input function after obtaining the statLock mutex first.
-func (w *workload) withStatLock(f func()) {
-	w.statLock.Lock()
-	f()
-	w.statLock.Unlock()
+// abort reports an abort condition that triggered for the workload, with the
+// given reason, and takes its action.
+func (w *workload) abort(reason string) {
+	action := w.breaker.conditions.Action
+	w.logger.Info("Abort condition triggered", "mod", w.mod, "op", w.op.Name, "reason", reason, "action", action)
+
+	if ar, ok := w.reporter.(report.AbortReporter); ok {
+		ar.ReportAbort(w.mod, w.op.Name, &stats.Abort{Time: w.clock.Now(), Action: string(action), Reason: reason})
+	}
+
+	if action == AbortStop {
+		w.stop()
+	}
+
+	// An action still pending is not repeated.
+	select {
+	case w.trips <- action:
+	default:
+	}
 }
 
-// scale checks if the current worker count of the workload is enough to satisfy the desired rate.
-// If not, more workers are added. The ticker interval of all workers is reset to match the new
-// rate per worker when this is called.
-func (w *workload) scale(ctx context.Context) {
-	requiredWorkers := w.getWorkerCount()
-	w.logger.Info("Required worker count", "required_workers", requiredWorkers, "mod", w.mod, "op", w.op.Name)
+// finish tells the scheduler the workload is done, once.
+func (w *workload) finish() {
+	if w.finished.CompareAndSwap(false, true) {
+		w.exhausted()
+	}
+}
 
-	if int(requiredWorkers) > len(w.workers) {
-		w.logger.Info("Adding workers", "count", int(requiredWorkers)-len(w.workers), "mod", w.mod, "op", w.op.Name)
-		for i := int(requiredWorkers) - len(w.workers); i > 0; i-- {
-			w.addWorker(ctx)
-		}
+// complete counts a dispatched invocation as completed, whether or not it
+// was made, against the iterations of the workload and the shared budget.
+// Iterations are used up once their invocations have completed, rather than
+// when dispatched, so that none in flight are lost when the test ends.
+func (w *workload) complete() {
+	w.budget.complete()
+
+	if w.iterations > 0 && w.completed.Add(1) == w.iterations {
+		w.logger.Info("Iterations used up", "mod", w.mod, "op", w.op.Name, "iterations", w.iterations)
+		w.finish()
 	}
+}
+
+// budget is a number of iterations shared by workloads. Iterations are taken
+// when invocations are dispatched, and the budget is used up once the
+// invocation of the last has completed.
+type budget struct {
+	lock sync.Mutex
+	// remaining is the number of iterations left to take, and pending the
+	// number taken whose invocations have not completed.
+	remaining uint64
+	pending   uint64
+	// empty is called when the invocation of the last iteration completes.
+	empty func()
+}
 
-	// Reset the worker tickers to match the new rate. This applies to both
-	// scaling up and down.
-	for _, worker := range w.workers {
-		worker.reset(w.workerTickerInterval(requiredWorkers))
+// take takes an iteration from the budget, returning false if none is left.
+// A nil budget is unlimited.
+func (b *budget) take() bool {
+	if b == nil {
+		return true
 	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.remaining == 0 {
+		return false
+	}
+	b.remaining--
+	b.pending++
+
+	return true
 }
 
-// workerTickerInterval works out the ticker interval for each worker.
-// Ex: 60000ms / 60 = 1000ms ticker interval.
-func (w *workload) workerTickerInterval(workerCount float64) time.Duration {
-	return time.Duration(
-		float64(1*time.Minute) / w.ratePerWorker(workerCount),
-	)
+// complete marks the invocation of an iteration taken as completed.
+func (b *budget) complete() {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.pending--
+	if b.remaining == 0 && b.pending == 0 {
+		b.empty()
+	}
 }
 
-// ratePerWorker returns the rate per worker, based on the desired rate and worker count.
-func (w *workload) ratePerWorker(workerCount float64) float64 {
-	return float64(w.op.Rate) / workerCount
+// schedule gives the times of invocations at a fixed rate per minute from a
+// start time. Times are computed from the start rather than accumulated, so
+// they do not drift.
+type schedule struct {
+	start time.Time
+	rate  uint64
 }
 
-// getWorkerCount yields a number either below or above 1, if below, 1 worker is enough.
-// If above, at least 2 workers are needed to satisfy the rate. Basically, if
-// the maximum rate of 1 worker is much higher than the target rate, a number
-// below zero is produced, indicating no more than 1 worker is needed. Returns
-// a maximum of 50 workers.
-func (w *workload) getWorkerCount() float64 {
-	return math.Min(math.Ceil(float64(w.op.Rate)/w.getMaxRate()), float64(w.workerLimit))
+// due returns the number of invocations due at t, the first is due at start.
+func (s *schedule) due(t time.Time) uint64 {
+	if t.Before(s.start) {
+		return 0
+	}
+
+	// Split on whole minutes to not overflow on long runs at high rates.
+	elapsed := t.Sub(s.start)
+	minutes, rem := uint64(elapsed/time.Minute), uint64(elapsed%time.Minute)
+
+	return minutes*s.rate + rem*s.rate/uint64(time.Minute) + 1
 }
 
-// getMaxRate returns the maximum rate of a single worker, derived from the actual average
-// execution time of the operation.
-func (w *workload) getMaxRate() float64 {
-	return float64(1*time.Minute) / float64(w.getAverageDuration())
+// at returns the time invocation n, counted from 0, is due.
+func (s *schedule) at(n uint64) time.Time {
+	minutes, rem := n/s.rate, n%s.rate
+	// Rounded up, so that the invocation is due at the returned time.
+	offset := (rem*uint64(time.Minute) + s.rate - 1) / s.rate
+
+	return s.start.Add(time.Duration(minutes)*time.Minute + time.Duration(offset)) //nolint:gosec // run durations fit a time.Duration
 }
 
-// getAverageDuration returns the average execution time of the operation, derived from the
-// total duration and number of calls.
-func (w *workload) getAverageDuration() time.Duration {
-	return w.totalDur / time.Duration(w.calls)
+// rateSample compares the calls made in a sampling interval to the expected
+// calls. The target is missed if the calls fall short by more than the sample
+// tolerance, and the miss is attributed to the worker limit if the workload
+// already runs the maximum number of workers. The in-flight accounting of the
+// interval is included and reset.
+func (w *workload) rateSample(interval time.Duration, calls, expected float64) *stats.RateSample {
+	sample := &stats.RateSample{
+		Interval:    interval,
+		Calls:       uint64(calls),
+		Expected:    expected,
+		Workers:     len(w.workers),
+		MaxInFlight: int(w.maxInFlight.Swap(w.inFlight.Load())),
+		Throttled:   w.throttled.Swap(0),
+		Missed:      calls < expected*(1-w.sampleTolerancePerc),
+	}
+	sample.WorkerLimited = sample.Missed && sample.Workers >= w.workerLimit
+
+	return sample
 }
 
-func (w *workload) addWorker(ctx context.Context) {
-	w.logger.Info("Adding worker", "mod", w.mod, "op", w.op.Name)
+// reportRate logs a warning if the sample was limited by the worker limit, and
+// passes the sample on if the reporter accepts rate samples.
+func (w *workload) reportRate(sample *stats.RateSample) {
+	if sample.WorkerLimited {
+		w.logger.Info(
+			"Warning: worker limit reached, target rate not met",
+			"mod", w.mod,
+			"op", w.op.Name,
+			"calls", sample.Calls,
+			"expected_calls", sample.Expected,
+			"worker_limit", w.workerLimit,
+		)
+	}
 
-	worker := &worker{
-		parent: w,
-		//nolint:gosec // rate is validated to be non-zero before scheduling
-		ticker: time.NewTicker(time.Minute / time.Duration(w.op.Rate)),
+	if rr, ok := w.reporter.(report.RateReporter); ok {
+		rr.ReportRate(w.mod, w.op.Name, sample)
 	}
+}
+
+// withStatLock calls the input function after obtaining the statLock mutex first.
+func (w *workload) withStatLock(f func()) {
+	w.statLock.Lock()
+	f()
+	w.statLock.Unlock()
+}
 
+func (w *workload) addWorker(ctx context.Context) {
+	w.logger.Info("Adding worker", "mod", w.mod, "op", w.op.Name, "workers", len(w.workers)+1)
+
+	worker := &worker{parent: w}
 	w.workers = append(w.workers, worker)
-	go worker.run(ctx)
+	w.workerWg.Add(1)
+	go worker.run(ctx, w.tokens)
+}
+
+// acquire takes an in-flight slot, waiting for one if all are taken, and
+// updates the in-flight accounting. False is returned if ctx is done before a
+// slot is free.
+func (w *workload) acquire(ctx context.Context) bool {
+	if w.slots != nil {
+		select {
+		case w.slots <- struct{}{}:
+		default:
+			w.throttled.Add(1)
+			select {
+			case w.slots <- struct{}{}:
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+
+	inFlight := w.inFlight.Add(1)
+	for {
+		peak := w.maxInFlight.Load()
+		if inFlight <= peak || w.maxInFlight.CompareAndSwap(peak, inFlight) {
+			return true
+		}
+	}
 }
 
-// doOp executes the workload operation and reports the result to the reporter. It also updates
-// the total duration and call count for the workload, which are used to calculate the average execution time.
-func (w *workload) doOp() {
+// release returns the in-flight slot taken by acquire.
+func (w *workload) release() {
+	w.inFlight.Add(-1)
+	if w.slots != nil {
+		<-w.slots
+	}
+}
+
+// doOp executes the workload operation with the context of the worker and reports the result to the
+// reporter. It also updates the total duration and call count for the workload, which are used to
+// calculate the average execution time. The invocation fails if the worker failed to start, or if a
+// feeder of the operation is exhausted, unless the feeder ends the test and the invocation is skipped.
+func (w *workload) doOp(ctx context.Context, worker *worker) {
+	defer w.complete()
+
+	if !w.acquire(ctx) {
+		return
+	}
+	defer w.release()
+
+	// A worker that failed to start takes no records, they are left for others.
+	invokeCtx, err := worker.ctx, worker.err
+	if err == nil {
+		invokeCtx, err = w.feed(worker.ctx)
+		if errors.Is(err, errEndTest) {
+			return
+		}
+	}
+
 	w.logger.V(workloadVerboseLogLevel).Info("Triggering workload op", "mod", w.mod, "op", w.op.Name)
 
-	start := time.Now()
-	res, err := w.op.Do()
+	start := w.clock.Now()
+	res := module.Result{}
+	if err == nil {
+		res, err = w.op.Invoke(invokeCtx)
+	}
 	w.logger.V(workloadVerboseLogLevel).Info("Ran op", "mod", w.mod, "op", w.op.Name)
 
 	if res.Duration == 0 {
-		res.Duration = time.Since(start)
+		res.Duration = w.clock.Now().Sub(start)
 	}
 
 	// Increase invocation counter and total duration to calculate average
@@ -197,6 +528,32 @@ func (w *workload) doOp() {
 
 	w.reporter.ReportOp(w.mod, w.op.Name, &res, err)
 
+	if reason := w.breaker.record(w.clock.Now(), err != nil); reason != "" {
+		w.abort(reason)
+	}
+
 	w.logger.V(workloadVerboseLogLevel).
-		Info("Trigger done", "mod", w.mod, "op", w.op.Name, "duration_µs", time.Since(start).Microseconds())
+		Info("Trigger done", "mod", w.mod, "op", w.op.Name, "duration_µs", w.clock.Now().Sub(start).Microseconds())
+}
+
+// feed returns a copy of ctx carrying the next record of each feeder of the operation. An error is
+// returned if a feeder is exhausted, and errEndTest after ending the test if the feeder ends it.
+func (w *workload) feed(ctx context.Context) (context.Context, error) {
+	for _, feeder := range w.op.Feeders {
+		record, err := feeder.Next()
+		if err != nil {
+			if feeder.EndTest && errors.Is(err, module.ErrFeederExhausted) {
+				w.logger.Info("Feeder exhausted, ending test", "mod", w.mod, "op", w.op.Name, "feeder", feeder.Name)
+				w.end()
+
+				return ctx, errEndTest
+			}
+
+			return ctx, err
+		}
+
+		ctx = module.WithRecord(ctx, feeder, record)
+	}
+
+	return ctx, nil
 }